@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+	"github.com/roman-mazur/architecture-lab-3/ui"
+)
+
+// config holds the painter settings. Values come from the defaults, then the JSON config file, then the flags
+// set on the command line.
+type config struct {
+	Listen       string   `json:"listen"`         // HTTP listen address
+	Lines        string   `json:"lines"`          // Optional line protocol listener, tcp://host:port or unix:///path
+	CanvasSize   string   `json:"canvas_size"`    // Canvas size as WIDTHxHEIGHT
+	Scale        string   `json:"scale"`          // How the canvas is scaled to the window: fit, fill or stretch
+	Script       string   `json:"script"`         // Optional script file executed on the default canvas at start
+	LogLevel     string   `json:"log_level"`      // debug, info, warn or error
+	TLSCert      string   `json:"tls_cert"`       // TLS certificate file; HTTPS is served when set with TLSKey
+	TLSKey       string   `json:"tls_key"`        // TLS private key file
+	ReadTimeout  duration `json:"read_timeout"`   // Maximum duration for reading a request
+	WriteTimeout duration `json:"write_timeout"`  // Maximum duration for writing a response, streams excluded
+	MaxBodyBytes int64    `json:"max_body_bytes"` // Maximum request body size
+
+	SnapshotDir string            `json:"snapshot_dir"` // Directory of the PNG snapshots saved from the window
+	Keys        map[string]string `json:"keys"`         // Window key bindings over the defaults; an empty action unbinds
+	Fonts       map[string]string `json:"fonts"`        // TrueType or OpenType font files by the name the text command uses
+	AssetsDir   string            `json:"assets_dir"`   // Directory of the images drawn by the blit command
+}
+
+func defaultConfig() config {
+	return config{
+		Listen:       "localhost:17000",
+		CanvasSize:   "800x800",
+		Scale:        "fit",
+		LogLevel:     "info",
+		ReadTimeout:  duration(10 * time.Second),
+		WriteTimeout: duration(10 * time.Second),
+		MaxBodyBytes: 1 << 20,
+	}
+}
+
+// duration is a time.Duration encoded in JSON as a string such as "10s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = duration(v)
+	return err
+}
+
+func (d *duration) String() string { return time.Duration(*d).String() }
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	*d = duration(v)
+	return err
+}
+
+// loadConfig parses the command line and the config file it points to.
+func loadConfig(args []string) (config, error) {
+	cfg := defaultConfig()
+	fs, configPath := newFlagSet(&cfg)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configPath != "" {
+		cfg = defaultConfig()
+		if err := readConfigFile(*configPath, &cfg); err != nil {
+			return cfg, err
+		}
+		// Parse the flags again on top of the file so that the command line takes precedence.
+		fs, _ = newFlagSet(&cfg)
+		if err := fs.Parse(args); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, cfg.validate()
+}
+
+func newFlagSet(cfg *config) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("painter", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "HTTP listen address")
+	fs.StringVar(&cfg.Lines, "lines", cfg.Lines, "optional line protocol listener, e.g. tcp://localhost:17001 or unix:///tmp/painter.sock")
+	fs.StringVar(&cfg.CanvasSize, "canvas-size", cfg.CanvasSize, "canvas size as WIDTHxHEIGHT")
+	fs.StringVar(&cfg.Scale, "scale", cfg.Scale, "how the canvas is scaled to the window: fit, fill or stretch")
+	fs.StringVar(&cfg.Script, "script", cfg.Script, "script file executed on the default canvas at start")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "TLS certificate file")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "TLS private key file")
+	fs.Var(&cfg.ReadTimeout, "read-timeout", "maximum duration for reading a request")
+	fs.Var(&cfg.WriteTimeout, "write-timeout", "maximum duration for writing a response")
+	fs.StringVar(&cfg.SnapshotDir, "snapshot-dir", cfg.SnapshotDir, "directory of the PNG snapshots saved from the window")
+	fs.Int64Var(&cfg.MaxBodyBytes, "max-body-bytes", cfg.MaxBodyBytes, "maximum request body size")
+	fs.StringVar(&cfg.AssetsDir, "assets-dir", cfg.AssetsDir, "directory of the images drawn by the blit command")
+	fs.Func("font", "font file for the text command as NAME=PATH; may be repeated", func(s string) error {
+		name, path, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("font %q must be given as NAME=PATH", s)
+		}
+		if cfg.Fonts == nil {
+			cfg.Fonts = make(map[string]string)
+		}
+		cfg.Fonts[name] = path
+		return nil
+	})
+	return fs, configPath
+}
+
+func readConfigFile(path string, cfg *config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg config) validate() error {
+	if _, err := cfg.canvasSize(); err != nil {
+		return err
+	}
+	if _, err := cfg.scaleMode(); err != nil {
+		return err
+	}
+	if _, err := cfg.keyMap(); err != nil {
+		return err
+	}
+	if _, err := cfg.logLevel(); err != nil {
+		return err
+	}
+	for name := range cfg.Fonts {
+		if name == "" || strings.ContainsAny(name, " \t\",=") {
+			return fmt.Errorf("invalid font name %q", name)
+		}
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		return errors.New("max_body_bytes must be positive")
+	}
+	return nil
+}
+
+func (cfg config) canvasSize() (image.Point, error) {
+	w, h, ok := strings.Cut(cfg.CanvasSize, "x")
+	x, errX := strconv.Atoi(w)
+	y, errY := strconv.Atoi(h)
+	if !ok || errX != nil || errY != nil || x <= 0 || y <= 0 || x > lang.MaxCanvasDimension || y > lang.MaxCanvasDimension {
+		return image.Point{}, fmt.Errorf("invalid canvas size %q: must be WIDTHxHEIGHT, each from 1 to %d", cfg.CanvasSize, lang.MaxCanvasDimension)
+	}
+	return image.Pt(x, y), nil
+}
+
+func (cfg config) scaleMode() (ui.ScaleMode, error) {
+	var mode ui.ScaleMode
+	err := mode.UnmarshalText([]byte(cfg.Scale))
+	return mode, err
+}
+
+func (cfg config) keyMap() (ui.KeyMap, error) {
+	keys := ui.DefaultKeyMap()
+	for name, action := range cfg.Keys {
+		chord, err := ui.ParseChord(name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case action == "":
+			delete(keys, chord)
+		case slices.Contains(lang.EditorActions, action):
+			keys[chord] = action
+		default:
+			return nil, fmt.Errorf("unknown action %q for key %s", action, name)
+		}
+	}
+	return keys, nil
+}
+
+// loadFonts reads the font files and registers them for the text command.
+func (cfg config) loadFonts() error {
+	for name, path := range cfg.Fonts {
+		f, err := painter.LoadFont(path)
+		if err != nil {
+			return fmt.Errorf("font %s: %w", name, err)
+		}
+		lang.RegisterFont(name, f)
+	}
+	return nil
+}
+
+func (cfg config) logLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(cfg.LogLevel))
+	return level, err
+}
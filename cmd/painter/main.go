@@ -1,37 +1,236 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/shiny/screen"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 	"github.com/roman-mazur/architecture-lab-3/painter/lang"
 	"github.com/roman-mazur/architecture-lab-3/ui"
 )
 
+// Exit status codes. A termination signal exits with 128 + the signal number, as shells report it.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+const shutdownTimeout = 5 * time.Second
+
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	cfg, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	level, _ := cfg.logLevel()
+	slog.SetLogLoggerLevel(level)
+	size, _ := cfg.canvasSize()
+	scale, _ := cfg.scaleMode()
+	keys, _ := cfg.keyMap()
+	if err := cfg.loadFonts(); err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+
 	var (
-		pv ui.Visualizer // The visualizer creates a window and draws in it.
+		pv = ui.NewVisualizer() // The visualizer creates a window and draws in it.
 
-		// Needed for part 2.
-		eventLoop painter.EventLoop // Event loop for processing operations.
-		processor lang.CommandProcessor // Command processor.
-		artboard  lang.ArtboardState // Artboard state.
+		// Canvases with their event loops, artboard states and command processors.
+		canvases = lang.NewCanvasManager(pv)
 	)
 
-	//pv.Debug = true
+	pv.Debug = level <= slog.LevelDebug
 	pv.Title = "Simple painter"
+	pv.Size = size
+	pv.Scale = scale
+	canvases.Size = size
+	canvases.AssetsDir = cfg.AssetsDir
+
+	// The default canvas is drawn on the window screen, other canvases are created off-screen over HTTP.
+	defaultCanvas, err := canvases.AddWindowCanvas("default")
+	if err != nil {
+		log.Print(err)
+		return exitFailure
+	}
+	// Mouse and keyboard edits in the window become commands on the displayed canvas.
+	editor := lang.NewEditor(canvases)
+	editor.SnapshotDir = cfg.SnapshotDir
+	pv.OnMouse = editor.HandleMouse
+	pv.Keys = keys
+	pv.OnAction = func(action string) {
+		if err := editor.Perform(action); err != nil {
+			log.Printf("%s: %s", action, err)
+		}
+	}
+	pv.Stats = func() ui.Stats {
+		c, err := canvases.Get(canvases.Displayed())
+		if err != nil {
+			return ui.Stats{}
+		}
+		return ui.Stats{
+			Frame:       c.Loop.Frame(),
+			FPS:         c.Loop.FPS(),
+			QueueLength: c.Loop.QueueLength(),
+			LastScript:  c.Processor.History.Last(),
+		}
+	}
+	pv.OnScreenReady = func(s screen.Screen) {
+		// Mirrored textures keep a copy of the pixels so that frames can be streamed over HTTP, while someone
+		// watches the stream.
+		defaultCanvas.Start(painter.MirrorScreen{Screen: s, Active: defaultCanvas.Stream.Watched})
+	}
+
+	if cfg.Script != "" {
+		if err := runScript(defaultCanvas, cfg.Script); err != nil {
+			log.Printf("Initial script %s failed: %s", cfg.Script, err)
+			return exitFailure
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", defaultCanvas.Handler())
+	canvasHandler := lang.CanvasHttpHandler(canvases)
+	mux.Handle("/canvas", canvasHandler)
+	mux.Handle("/canvas/", canvasHandler)
+
+	server := &http.Server{
+		Addr:         cfg.Listen,
+		Handler:      http.MaxBytesHandler(mux, cfg.MaxBodyBytes),
+		ReadTimeout:  time.Duration(cfg.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
+	}
+	// Streams never become idle, so they are ended as soon as the shutdown starts.
+	server.RegisterOnShutdown(canvases.CloseStreams)
+	// The key pair is loaded before opening the window so that a bad one is reported right away.
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			log.Print(err)
+			return exitFailure
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
 
-	pv.OnScreenReady = eventLoop.Initiate
-	eventLoop.Receiver = &pv
+	// Listen before opening the window so that a busy port is reported right away.
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		log.Print(err)
+		return exitFailure
+	}
 
-	// Initialize the command processor with the artboard state.
-	processor = *lang.NewCommandProcessor(&artboard)
+	var lines *lang.LineServer
+	if cfg.Lines != "" {
+		l, err := listenLines(cfg.Lines)
+		if err != nil {
+			_ = listener.Close()
+			log.Print(err)
+			return exitFailure
+		}
+		lines = &lang.LineServer{Loop: defaultCanvas.Loop, Processor: defaultCanvas.Processor}
+		go func() {
+			if err := lines.Serve(l); !errors.Is(err, lang.ErrLineServerClosed) {
+				log.Printf("Line protocol listener failed: %s", err)
+			}
+		}()
+	}
 
+	var status atomic.Int32
+	stop := func(code int) {
+		status.CompareAndSwap(exitOK, int32(code))
+		pv.Close()
+	}
+
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server failed: %s", err)
+			stop(exitFailure)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		http.Handle("/", lang.CommandHttpHandler(&eventLoop, &processor))
-		_ = http.ListenAndServe("localhost:17000", nil)
+		sig := <-signals
+		log.Printf("Received %s, shutting down", sig)
+		code := exitFailure
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		stop(code)
 	}()
 
 	pv.Main()
-	eventLoop.Terminate()
+	signal.Stop(signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %s", err)
+		_ = server.Close()
+	}
+	if lines != nil {
+		_ = lines.Close()
+	}
+	// Terminate waits until every queued operation has been applied.
+	canvases.Terminate()
+
+	return int(status.Load())
+}
+
+// runScript executes the script file on the canvas.
+func runScript(c *lang.Canvas, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = c.Processor.ExecuteCommands(f, c.Loop)
+	return err
+}
+
+// listenLines opens the line protocol listener described by a tcp:// or unix:// URL.
+func listenLines(addr string) (net.Listener, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return net.Listen("tcp", u.Host)
+	case "unix":
+		return net.Listen("unix", u.Path)
+	default:
+		return nil, fmt.Errorf("unsupported line protocol address %q", addr)
+	}
 }
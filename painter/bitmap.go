@@ -0,0 +1,155 @@
+package painter
+
+import (
+	"image"
+	"image/draw"
+	"log"
+	"sync"
+
+	"golang.org/x/exp/shiny/screen"
+	xdraw "golang.org/x/image/draw"
+)
+
+// Bitmap is a decoded image drawn by Blit operations. It keeps a copy of its pixels in a buffer of the screen
+// it was last uploaded to, so that an image drawn at its own size is uploaded without converting it again.
+// It is safe for concurrent use.
+type Bitmap struct {
+	img    *image.RGBA
+	opaque bool
+
+	mu       sync.Mutex
+	screen   screen.Screen
+	buf      screen.Buffer
+	released bool
+}
+
+// NewBitmap copies the image into a new Bitmap.
+func NewBitmap(img image.Image) *Bitmap {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return &Bitmap{img: rgba, opaque: rgba.Opaque()}
+}
+
+// Size returns the size of the image in pixels.
+func (b *Bitmap) Size() image.Point {
+	return b.img.Rect.Size()
+}
+
+// Release releases the cached buffer. Blit operations that still refer to the bitmap keep working through
+// buffers of their own.
+func (b *Bitmap) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf != nil {
+		b.buf.Release()
+		b.buf, b.screen = nil, nil
+	}
+	b.released = true
+}
+
+// upload uploads the part of the image starting at sp into dr of the texture t of the screen s through the
+// cached buffer. It returns false if the bitmap is released or the buffer cannot be allocated.
+func (b *Bitmap) upload(t screen.Texture, s screen.Screen, dr image.Rectangle, sp image.Point) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.released {
+		return false
+	}
+	if b.buf == nil || b.screen != s {
+		if b.buf != nil {
+			b.buf.Release()
+			b.buf, b.screen = nil, nil
+		}
+		buf, err := s.NewBuffer(b.Size())
+		if err != nil {
+			log.Printf("Failed to allocate a bitmap buffer: %s", err)
+			return false
+		}
+		draw.Draw(buf.RGBA(), buf.Bounds(), b.img, image.Point{}, draw.Src)
+		b.buf, b.screen = buf, s
+	}
+	t.Upload(dr.Min, b.buf, image.Rectangle{Min: sp, Max: sp.Add(dr.Size())})
+	return true
+}
+
+// Blit is a TextureOperation that draws a bitmap into a rectangle of the texture, scaling it if their sizes
+// differ. Translucent pixels are blended over the texture.
+type Blit struct {
+	Bitmap *Bitmap
+	Rect   image.Rectangle
+}
+
+// Apply draws the bitmap with one Fill call per run of equal pixels, which works with any texture but is slow
+// for large images.
+func (bl *Blit) Apply(t screen.Texture) bool {
+	dr := bl.Rect.Intersect(t.Bounds())
+	if dr.Empty() {
+		return false
+	}
+	img := image.NewRGBA(image.Rectangle{Max: dr.Size()})
+	bl.draw(img, dr.Min, draw.Src)
+
+	size := dr.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; {
+			c := img.RGBAAt(x, y)
+			end := x + 1
+			for end < size.X && img.RGBAAt(end, y) == c {
+				end++
+			}
+			if c.A > 0 {
+				t.Fill(image.Rect(x, y, end, y+1).Add(dr.Min), c, draw.Over)
+			}
+			x = end
+		}
+	}
+	return false
+}
+
+// ApplyScreen uploads the bitmap through buffers of s. An opaque bitmap drawn at its own size is uploaded
+// from its cached buffer; otherwise it is drawn into a new buffer, over the texture pixels if they can be read
+// back. Translucent bitmaps on textures that cannot be read back are drawn like Apply does.
+func (bl *Blit) ApplyScreen(t screen.Texture, s screen.Screen) bool {
+	dr := bl.Rect.Intersect(t.Bounds())
+	if dr.Empty() {
+		return false
+	}
+	if bl.Rect.Size() == bl.Bitmap.Size() && bl.Bitmap.opaque && bl.Bitmap.upload(t, s, dr, dr.Min.Sub(bl.Rect.Min)) {
+		return false
+	}
+
+	rt, readBack := readable(t)
+	if !readBack && !bl.Bitmap.opaque {
+		return bl.Apply(t)
+	}
+	buf, err := s.NewBuffer(dr.Size())
+	if err != nil {
+		log.Printf("Failed to allocate a buffer: %s", err)
+		return bl.Apply(t)
+	}
+	defer buf.Release()
+
+	img := buf.RGBA()
+	op := draw.Src
+	if readBack {
+		draw.Draw(img, img.Rect, rt.RGBA(), dr.Min, draw.Src)
+		op = draw.Over
+	}
+	bl.draw(img, dr.Min, op)
+	t.Upload(dr.Min, buf, img.Rect)
+	return false
+}
+
+// draw draws the bitmap into dst, whose top left pixel is at origin in the texture.
+func (bl *Blit) draw(dst *image.RGBA, origin image.Point, op draw.Op) {
+	r := bl.Rect.Sub(origin)
+	src := bl.Bitmap.img
+	if r.Size() == src.Rect.Size() {
+		draw.Draw(dst, r, src, image.Point{}, op)
+		return
+	}
+	xdraw.BiLinear.Scale(dst, r, src, src.Rect, op, nil)
+}
@@ -0,0 +1,68 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestBlit(t *testing.T) {
+	// A 10x10 image: red on the left half, half-transparent green on the right half.
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img, image.Rect(0, 0, 5, 10), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(5, 0, 10, 10), image.NewUniform(color.NRGBA{G: 255, A: 128}), image.Point{}, draw.Src)
+	translucent := NewBitmap(img)
+
+	opaqueImg := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(opaqueImg, opaqueImg.Rect, image.NewUniform(color.RGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	opaque := NewBitmap(opaqueImg)
+	defer opaque.Release()
+
+	tests := []struct {
+		name string
+		op   *Blit
+		at   map[image.Point]color.RGBA
+	}{
+		{
+			name: "Opaque",
+			op:   &Blit{Bitmap: opaque, Rect: image.Rect(-5, 20, 5, 30)},
+			at:   map[image.Point]color.RGBA{{0, 20}: {B: 255, A: 255}, {4, 29}: {B: 255, A: 255}, {5, 25}: {255, 255, 255, 255}},
+		},
+		{
+			name: "Translucent",
+			op:   &Blit{Bitmap: translucent, Rect: image.Rect(10, 10, 20, 20)},
+			at:   map[image.Point]color.RGBA{{12, 12}: {R: 255, A: 255}, {17, 17}: {R: 127, G: 255, B: 127, A: 255}},
+		},
+		{
+			name: "Scaled",
+			op:   &Blit{Bitmap: translucent, Rect: image.Rect(0, 0, 40, 20)},
+			at:   map[image.Point]color.RGBA{{5, 10}: {R: 255, A: 255}, {35, 10}: {R: 127, G: 255, B: 127, A: 255}, {40, 10}: {255, 255, 255, 255}},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, screen := range []bool{false, true} {
+			tx, _ := OffscreenScreen{}.NewTexture(image.Pt(50, 50))
+			FillTexture(color.White).Apply(tx)
+			if screen {
+				applyOn(tt.op, tx, OffscreenScreen{})
+			} else {
+				tt.op.Apply(tx)
+			}
+			for p, want := range tt.at {
+				got := tx.(*ImageTexture).RGBA().RGBAAt(p.X, p.Y)
+				if diff(got.R, want.R) > 1 || diff(got.G, want.G) > 1 || diff(got.B, want.B) > 1 || got.A != want.A {
+					t.Errorf("%s (screen %t): %v is %v, want %v", tt.name, screen, p, got, want)
+				}
+			}
+		}
+	}
+}
+
+func diff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,146 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// Clip is the region of a texture that drawing is limited to: a rectangle, narrowed by a coverage mask if there
+// is one. Clips are aliased: pixels covered by less than half of the mask are outside.
+type Clip struct {
+	Rect image.Rectangle
+	Mask *image.Alpha // Coverage in texture pixels; the whole Rect if nil
+}
+
+// ClipRect creates a clip that keeps drawing inside the rectangle.
+func ClipRect(r image.Rectangle) *Clip {
+	return &Clip{Rect: r.Canon()}
+}
+
+// ClipPath creates a clip that keeps drawing inside the path, filled with the fill rule, and inside bounds. Only
+// the part of the path inside bounds is rasterized, so they should be those of the texture.
+func ClipPath(p *Path, rule FillRule, bounds image.Rectangle) *Clip {
+	r := FillPath(p, rule, Paint{})
+	mask, origin, _ := r.mask(bounds)
+	if mask == nil {
+		return &Clip{}
+	}
+	mask.Rect = mask.Rect.Add(origin)
+	return &Clip{Rect: mask.Rect, Mask: mask}
+}
+
+// Intersect returns the clip that keeps drawing inside both clips.
+func (c *Clip) Intersect(other *Clip) *Clip {
+	r := c.Rect.Intersect(other.Rect)
+	if c.Mask == nil && other.Mask == nil || r.Empty() {
+		return &Clip{Rect: r}
+	}
+	mask := image.NewAlpha(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if c.inside(x, y) && other.inside(x, y) {
+				mask.Pix[mask.PixOffset(x, y)] = 0xff
+			}
+		}
+	}
+	return &Clip{Rect: r, Mask: mask}
+}
+
+// Contains reports whether the pixel is inside the clip.
+func (c *Clip) Contains(p image.Point) bool {
+	return c.inside(p.X, p.Y)
+}
+
+func (c *Clip) inside(x, y int) bool {
+	if !image.Pt(x, y).In(c.Rect) {
+		return false
+	}
+	return c.Mask == nil || c.Mask.AlphaAt(x, y).A >= 0x80
+}
+
+// spans calls fn with the runs of pixels of r inside the clip, row by row.
+func (c *Clip) spans(r image.Rectangle, fn func(image.Rectangle)) {
+	r = r.Intersect(c.Rect)
+	if r.Empty() {
+		return
+	}
+	if c.Mask == nil {
+		fn(r)
+		return
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; {
+			if !c.inside(x, y) {
+				x++
+				continue
+			}
+			end := x + 1
+			for end < r.Max.X && c.inside(end, y) {
+				end++
+			}
+			fn(image.Rect(x, y, end, y+1))
+			x = end
+		}
+	}
+}
+
+// Clipped creates an operation that applies op with everything it draws limited to the clip.
+func Clipped(op TextureOperation, clip *Clip) TextureOperation {
+	return &clippedOperation{op: op, clip: clip}
+}
+
+type clippedOperation struct {
+	op   TextureOperation
+	clip *Clip
+}
+
+func (co *clippedOperation) Apply(t screen.Texture) bool {
+	return co.op.Apply(co.clip.wrap(t))
+}
+
+func (co *clippedOperation) ApplyScreen(t screen.Texture, s screen.Screen) bool {
+	return applyOn(co.op, co.clip.wrap(t), s)
+}
+
+// wrap returns a texture whose drawing calls only reach the pixels of t inside the clip. The bounds of the
+// texture shrink to the clip rectangle, so operations skip the pixels outside it. Textures that can be read
+// back stay readable.
+func (c *Clip) wrap(t screen.Texture) screen.Texture {
+	ct := &clipTexture{Texture: t, clip: c}
+	if rt, ok := readable(t); ok {
+		return &readableClipTexture{clipTexture: ct, rgba: rt.RGBA}
+	}
+	return ct
+}
+
+type clipTexture struct {
+	screen.Texture
+	clip *Clip
+}
+
+func (t *clipTexture) Bounds() image.Rectangle {
+	return t.Texture.Bounds().Intersect(t.clip.Rect)
+}
+
+func (t *clipTexture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
+	t.clip.spans(dr, func(r image.Rectangle) {
+		t.Texture.Fill(r, src, op)
+	})
+}
+
+func (t *clipTexture) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {
+	offset := sr.Min.Sub(dp)
+	t.clip.spans(sr.Sub(offset), func(r image.Rectangle) {
+		t.Texture.Upload(r.Min, src, r.Add(offset))
+	})
+}
+
+type readableClipTexture struct {
+	*clipTexture
+	rgba func() *image.RGBA
+}
+
+func (t *readableClipTexture) RGBA() *image.RGBA { return t.rgba() }
@@ -0,0 +1,91 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestClipped(t *testing.T) {
+	red, white := color.RGBA{R: 255, A: 255}, color.RGBA{255, 255, 255, 255}
+
+	// A triangle with its right angle at the top left corner of a 100x100 square.
+	var triangle Path
+	triangle.MoveTo(Point{50, 50})
+	triangle.LineTo(Point{150, 50})
+	triangle.LineTo(Point{50, 150})
+	triangle.Close()
+
+	square := []Point{{0, 0}, {200, 0}, {200, 200}, {0, 200}}
+	tests := []struct {
+		name string
+		clip *Clip
+		at   map[image.Point]color.RGBA
+	}{
+		{
+			name: "Rect",
+			clip: ClipRect(image.Rect(150, 150, 50, 50)),
+			at:   map[image.Point]color.RGBA{{50, 50}: red, {149, 149}: red, {49, 100}: white, {100, 150}: white},
+		},
+		{
+			name: "Path",
+			clip: ClipPath(&triangle, NonZero, image.Rect(0, 0, 200, 200)),
+			at:   map[image.Point]color.RGBA{{55, 55}: red, {55, 140}: red, {140, 55}: red, {120, 120}: white, {45, 55}: white},
+		},
+		{
+			name: "Intersect",
+			clip: ClipPath(&triangle, NonZero, image.Rect(0, 0, 200, 200)).Intersect(ClipRect(image.Rect(0, 0, 100, 200))),
+			at:   map[image.Point]color.RGBA{{55, 55}: red, {55, 140}: red, {140, 55}: white, {105, 60}: white},
+		},
+	}
+
+	for _, tt := range tests {
+		ops := map[string]TextureOperation{
+			"Fill":   Clipped(FillTexture(red), tt.clip),
+			"Raster": Clipped(DrawPolygon(square, Paint{Color: red}), tt.clip),
+		}
+		for kind, op := range ops {
+			for _, screen := range []bool{false, true} {
+				tx, _ := OffscreenScreen{}.NewTexture(image.Pt(200, 200))
+				FillTexture(white).Apply(tx)
+				if screen {
+					applyOn(op, tx, OffscreenScreen{})
+				} else {
+					op.Apply(tx)
+				}
+				img := tx.(*ImageTexture).RGBA()
+				for p, want := range tt.at {
+					if got := img.RGBAAt(p.X, p.Y); got != want {
+						t.Errorf("%s %s, screen %t: %v is %v, want %v", tt.name, kind, screen, p, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestClipped_Fill(t *testing.T) {
+	// Textures that cannot be read back only receive the Fill calls inside the clip.
+	tx := new(mockTexture)
+	Clipped(FillTexture(color.White), ClipRect(image.Rect(10, 10, 20, 20))).Apply(tx)
+	Clipped(FillTexture(color.White), ClipRect(image.Rect(-20, -20, -10, -10))).Apply(tx)
+	if tx.FillCnt != 1 {
+		t.Errorf("Fill called %d times, want 1", tx.FillCnt)
+	}
+}
+
+func TestClipPath_Bounds(t *testing.T) {
+	// Only the part of a huge path inside the bounds is rasterized.
+	var huge Path
+	huge.MoveTo(Point{-1e5, -1e5})
+	huge.LineTo(Point{3e5, -1e5})
+	huge.LineTo(Point{-1e5, 3e5})
+	huge.Close()
+	clip := ClipPath(&huge, NonZero, image.Rect(0, 0, 200, 100))
+	if clip.Rect != image.Rect(0, 0, 200, 100) || clip.Mask.Rect != clip.Rect {
+		t.Errorf("clip covers %v with a mask of %v", clip.Rect, clip.Mask.Rect)
+	}
+	if !clip.Contains(image.Pt(10, 10)) || clip.Contains(image.Pt(-1, 10)) {
+		t.Error("clip does not cover the inside of the path within the bounds")
+	}
+}
@@ -0,0 +1,184 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// Stop is a color at an offset along a gradient, from 0 at its start to 1 at its end.
+type Stop struct {
+	Offset float64
+	Color  color.Color
+}
+
+// Gradient is a color that varies over the box it fills, such as the bounds of a primitive.
+type Gradient interface {
+	// Image returns the gradient laid over the box, with the box as its bounds, in texture pixels.
+	Image(box image.Rectangle) image.Image
+}
+
+// LinearGradient changes color along a line through the center of the box, like the CSS linear-gradient.
+// The line is just long enough for the corners of the box to get the colors of its ends.
+type LinearGradient struct {
+	Angle float64 // Direction in degrees, clockwise from the top: 0 goes up, 90 goes right
+	Stops []Stop
+}
+
+// Image implements Gradient.
+func (g *LinearGradient) Image(box image.Rectangle) image.Image {
+	a := g.Angle * math.Pi / 180
+	dx, dy := math.Sin(a), -math.Cos(a)
+	w, h := float64(box.Dx()), float64(box.Dy())
+	length := math.Abs(w*dx) + math.Abs(h*dy)
+	cx, cy := float64(box.Min.X)+w/2, float64(box.Min.Y)+h/2
+
+	return &gradientImage{box: box, stops: g.Stops, offset: func(x, y float64) float64 {
+		if length == 0 {
+			return 0
+		}
+		return ((x-cx)*dx+(y-cy)*dy)/length + 0.5
+	}}
+}
+
+// RadialGradient changes color from its center outwards. Its center and radius are relative to the box, so it
+// is elliptical in boxes that are not square.
+type RadialGradient struct {
+	Center Point   // Center as a fraction of the box size, {0.5, 0.5} being the middle
+	Radius float64 // Radius as a fraction of the box size along each axis
+	Stops  []Stop
+}
+
+// Image implements Gradient.
+func (g *RadialGradient) Image(box image.Rectangle) image.Image {
+	w, h := float64(box.Dx()), float64(box.Dy())
+	cx, cy := float64(box.Min.X)+g.Center.X*w, float64(box.Min.Y)+g.Center.Y*h
+	rx, ry := g.Radius*w, g.Radius*h
+
+	return &gradientImage{box: box, stops: g.Stops, offset: func(x, y float64) float64 {
+		if rx <= 0 || ry <= 0 {
+			return 1
+		}
+		return math.Hypot((x-cx)/rx, (y-cy)/ry)
+	}}
+}
+
+// gradientImage evaluates a gradient at the centers of pixels, interpolating premultiplied colors between
+// the stops around the offset of every pixel.
+type gradientImage struct {
+	box    image.Rectangle
+	stops  []Stop
+	offset func(x, y float64) float64
+}
+
+func (gi *gradientImage) ColorModel() color.Model { return color.RGBA64Model }
+
+func (gi *gradientImage) Bounds() image.Rectangle { return gi.box }
+
+func (gi *gradientImage) At(x, y int) color.Color {
+	return gradientColor(gi.stops, gi.offset(float64(x)+0.5, float64(y)+0.5))
+}
+
+// gradientColor returns the color at the offset. Stops are expected in order; the colors of the first and the
+// last one extend beyond them.
+func gradientColor(stops []Stop, t float64) color.RGBA64 {
+	if len(stops) == 0 {
+		return color.RGBA64{}
+	}
+	rgba := func(c color.Color) [4]float64 {
+		r, g, b, a := c.RGBA()
+		return [4]float64{float64(r), float64(g), float64(b), float64(a)}
+	}
+
+	i := 0
+	for i < len(stops) && stops[i].Offset <= t {
+		i++
+	}
+	var c [4]float64
+	switch {
+	case i == 0:
+		c = rgba(stops[0].Color)
+	case i == len(stops):
+		c = rgba(stops[i-1].Color)
+	default:
+		from, to := stops[i-1], stops[i]
+		f := (t - from.Offset) / (to.Offset - from.Offset)
+		a, b := rgba(from.Color), rgba(to.Color)
+		for k := range c {
+			c[k] = a[k] + (b[k]-a[k])*f
+		}
+	}
+	return color.RGBA64{R: uint16(c[0] + 0.5), G: uint16(c[1] + 0.5), B: uint16(c[2] + 0.5), A: uint16(c[3] + 0.5)}
+}
+
+// GradientFill is a TextureOperation that fills a rectangle with a gradient.
+type GradientFill struct {
+	Rect     image.Rectangle
+	Gradient Gradient
+	Op       draw.Op
+
+	// Box is the rectangle the gradient is laid over, Rect if empty. Parts of a shape share the box of the shape.
+	Box image.Rectangle
+}
+
+// FillGradient creates an operation that fills the rectangle with the gradient using the composite operator op.
+func FillGradient(r image.Rectangle, g Gradient, op draw.Op) *GradientFill {
+	return &GradientFill{Rect: r.Canon(), Gradient: g, Op: op}
+}
+
+// Apply fills the rectangle with one Fill call per run of equal pixels, which works with any texture but is slow.
+func (gf *GradientFill) Apply(t screen.Texture) bool {
+	if mask, origin := gf.mask(t.Bounds()); mask != nil {
+		fillMask(t, mask, origin, gf.image(), gf.Op)
+	}
+	return false
+}
+
+// ApplyScreen renders the gradient into a buffer of s and uploads it into the texture. Translucent colors are
+// blended over textures whose pixels can be read back; other textures get the gradient as it is with draw.Src
+// and like Apply does with draw.Over.
+func (gf *GradientFill) ApplyScreen(t screen.Texture, s screen.Screen) bool {
+	dr := gf.Rect.Intersect(t.Bounds())
+	if dr.Empty() {
+		return false
+	}
+	if _, ok := readable(t); ok || gf.Op != draw.Src {
+		mask, origin := gf.mask(t.Bounds())
+		compositeMask(t, s, mask, origin, gf.image(), gf.Op)
+		return false
+	}
+
+	buf, err := s.NewBuffer(dr.Size())
+	if err != nil {
+		log.Printf("Failed to allocate a buffer: %s", err)
+		return gf.Apply(t)
+	}
+	defer buf.Release()
+	draw.Draw(buf.RGBA(), buf.Bounds(), gf.image(), dr.Min, draw.Src)
+	t.Upload(dr.Min, buf, buf.Bounds())
+	return false
+}
+
+func (gf *GradientFill) image() image.Image {
+	if gf.Box.Empty() {
+		return gf.Gradient.Image(gf.Rect)
+	}
+	return gf.Gradient.Image(gf.Box)
+}
+
+// mask returns a fully covered mask of the part of the rectangle inside bounds.
+func (gf *GradientFill) mask(bounds image.Rectangle) (*image.Alpha, image.Point) {
+	dr := gf.Rect.Intersect(bounds)
+	if dr.Empty() {
+		return nil, image.Point{}
+	}
+	mask := image.NewAlpha(image.Rectangle{Max: dr.Size()})
+	for i := range mask.Pix {
+		mask.Pix[i] = 0xff
+	}
+	return mask, dr.Min
+}
@@ -0,0 +1,99 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestGradient_Image(t *testing.T) {
+	black, white := color.RGBA{A: 255}, color.RGBA{255, 255, 255, 255}
+	stops := []Stop{{Offset: 0, Color: black}, {Offset: 1, Color: white}}
+	box := image.Rect(100, 100, 200, 200)
+
+	tests := []struct {
+		name string
+		g    Gradient
+		at   map[image.Point]uint8 // Expected gray level
+	}{
+		{
+			name: "Right",
+			g:    &LinearGradient{Angle: 90, Stops: stops},
+			at:   map[image.Point]uint8{{100, 150}: 1, {149, 100}: 126, {199, 199}: 254},
+		},
+		{
+			name: "Up",
+			g:    &LinearGradient{Angle: 0, Stops: stops},
+			at:   map[image.Point]uint8{{150, 199}: 1, {150, 100}: 254},
+		},
+		{
+			name: "Radial",
+			g:    &RadialGradient{Center: Point{X: 0.5, Y: 0.5}, Radius: 0.5, Stops: stops},
+			at:   map[image.Point]uint8{{150, 150}: 4, {199, 150}: 253, {100, 100}: 255},
+		},
+		{
+			name: "Stops",
+			g:    &LinearGradient{Angle: 90, Stops: []Stop{{Offset: 0.25, Color: black}, {Offset: 0.5, Color: white}, {Offset: 1, Color: black}}},
+			at:   map[image.Point]uint8{{110, 150}: 0, {149, 150}: 250, {174, 150}: 130},
+		},
+	}
+
+	for _, tt := range tests {
+		img := tt.g.Image(box)
+		if img.Bounds() != box {
+			t.Errorf("%s: bounds are %v, want %v", tt.name, img.Bounds(), box)
+		}
+		for p, want := range tt.at {
+			got := color.RGBAModel.Convert(img.At(p.X, p.Y)).(color.RGBA)
+			if diff(got.R, want) > 1 || got.R != got.G || got.R != got.B || got.A != 255 {
+				t.Errorf("%s: %v is %v, want gray %d", tt.name, p, got, want)
+			}
+		}
+	}
+}
+
+func TestFillGradient(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	g := &LinearGradient{Angle: 90, Stops: []Stop{{Offset: 0, Color: red}, {Offset: 1, Color: color.RGBA{}}}}
+
+	tests := []struct {
+		name string
+		op   TextureOperation
+		at   map[image.Point]color.RGBA
+	}{
+		{
+			name: "Src",
+			op:   FillGradient(image.Rect(-10, 0, 10, 10), g, draw.Src),
+			at:   map[image.Point]color.RGBA{{0, 5}: {R: 121, A: 121}, {10, 5}: {255, 255, 255, 255}},
+		},
+		{
+			name: "Over",
+			op:   FillGradient(image.Rect(-10, 0, 10, 10), g, draw.Over),
+			at:   map[image.Point]color.RGBA{{0, 5}: {R: 255, G: 134, B: 134, A: 255}, {10, 5}: {255, 255, 255, 255}},
+		},
+		{
+			name: "Shape",
+			op:   (&BasicShape{CenterX: 100, CenterY: 100, Gradient: g, Op: draw.Src}).Draw(),
+			at:   map[image.Point]color.RGBA{{0, 100}: {R: 254, A: 254}, {100, 100}: {R: 127, A: 127}, {100, 0}: {R: 127, A: 127}},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, screen := range []bool{false, true} {
+			tx, _ := OffscreenScreen{}.NewTexture(image.Pt(200, 200))
+			FillTexture(color.White).Apply(tx)
+			if screen {
+				applyOn(tt.op, tx, OffscreenScreen{})
+			} else {
+				tt.op.Apply(tx)
+			}
+			for p, want := range tt.at {
+				got := tx.(*ImageTexture).RGBA().RGBAAt(p.X, p.Y)
+				if diff(got.R, want.R) > 1 || diff(got.G, want.G) > 1 || diff(got.B, want.B) > 1 || diff(got.A, want.A) > 1 {
+					t.Errorf("%s (screen %t): %v is %v, want %v", tt.name, screen, p, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// Limits of the images accepted by an AssetStore that sets none.
+const (
+	DefaultMaxAssetBytes  = 8 << 20
+	DefaultMaxAssetPixels = 4096 * 4096
+	DefaultMaxAssets      = 64
+	DefaultMaxAssetMemory = 256 << 20
+)
+
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrAssetTooLarge = errors.New("asset is too large")
+	ErrAssetFormat   = errors.New("asset must be a PNG, JPEG or GIF image")
+	ErrAssetsFull    = errors.New("asset store is full")
+
+	assetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,127}$`)
+)
+
+// AssetStore holds the images drawn by the blit command of a canvas. Images are uploaded under a name or loaded
+// on first use from the file of that name in Dir. Every image is decoded once. The images loaded together stay
+// within a count and a memory budget; deleting images makes room for others.
+type AssetStore struct {
+	Dir       string // Directory images are loaded from, none if empty
+	MaxBytes  int64  // Maximum size of an encoded image, DefaultMaxAssetBytes if zero
+	MaxPixels int    // Maximum number of pixels of an image, DefaultMaxAssetPixels if zero
+	MaxAssets int    // Maximum number of images loaded at once, DefaultMaxAssets if zero
+	MaxMemory int64  // Maximum size of the decoded pixels of all images, DefaultMaxAssetMemory if zero
+
+	mu     sync.Mutex
+	assets map[string]*painter.Bitmap
+	memory int64 // Size of the decoded pixels of the images in assets
+}
+
+// Get returns the image with the given name, loading it from Dir if it has not been uploaded. A nil store has
+// no images.
+func (st *AssetStore) Get(name string) (*painter.Bitmap, error) {
+	if !assetNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid asset name %q", name)
+	}
+	if st == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, name)
+	}
+
+	st.mu.Lock()
+	b, ok := st.assets[name]
+	st.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+	if st.Dir == "" {
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, name)
+	}
+
+	// The file is decoded without holding the lock; if another caller loads it meanwhile, its image is kept.
+	f, err := os.Open(filepath.Join(st.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, name)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err = st.decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("asset %s: %w", name, err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if loaded, ok := st.assets[name]; ok {
+		b.Release()
+		return loaded, nil
+	}
+	if err := st.store(name, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Put decodes the image and stores it under the name, replacing the image that has it.
+func (st *AssetStore) Put(name string, r io.Reader) (*painter.Bitmap, error) {
+	if !assetNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid asset name %q", name)
+	}
+	b, err := st.decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := st.store(name, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Delete removes the image with the given name. Blits of it are no longer drawn until it is put again.
+func (st *AssetStore) Delete(name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	b, ok := st.assets[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAssetNotFound, name)
+	}
+	delete(st.assets, name)
+	st.memory -= bitmapMemory(b)
+	b.Release()
+	return nil
+}
+
+// Names returns the sorted names of the images that are loaded.
+func (st *AssetStore) Names() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var names []string
+	for name := range st.assets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// store adds the image under the name if the images then stay within the budget of the store.
+func (st *AssetStore) store(name string, b *painter.Bitmap) error {
+	maxAssets, maxMemory := st.MaxAssets, st.MaxMemory
+	if maxAssets <= 0 {
+		maxAssets = DefaultMaxAssets
+	}
+	if maxMemory <= 0 {
+		maxMemory = DefaultMaxAssetMemory
+	}
+
+	old, replaced := st.assets[name]
+	count, memory := len(st.assets)+1, st.memory+bitmapMemory(b)
+	if replaced {
+		count, memory = count-1, memory-bitmapMemory(old)
+	}
+	if count > maxAssets || memory > maxMemory {
+		b.Release()
+		return fmt.Errorf("%w: at most %d images of %d bytes in total", ErrAssetsFull, maxAssets, maxMemory)
+	}
+
+	if st.assets == nil {
+		st.assets = make(map[string]*painter.Bitmap)
+	}
+	if replaced {
+		old.Release()
+	}
+	st.assets[name] = b
+	st.memory = memory
+	return nil
+}
+
+// bitmapMemory returns the size of the decoded pixels of the image.
+func bitmapMemory(b *painter.Bitmap) int64 {
+	size := b.Size()
+	return 4 * int64(size.X) * int64(size.Y)
+}
+
+// decode reads an image within the size limits of the store. Its dimensions are checked before the pixels
+// are decoded.
+func (st *AssetStore) decode(r io.Reader) (*painter.Bitmap, error) {
+	maxBytes, maxPixels := st.MaxBytes, st.MaxPixels
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxAssetBytes
+	}
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxAssetPixels
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrAssetTooLarge, maxBytes)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !slices.Contains([]string{"png", "jpeg", "gif"}, format) {
+		return nil, ErrAssetFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxPixels/max(cfg.Height, 1) {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrAssetTooLarge, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAssetFormat, err)
+	}
+	return painter.NewBitmap(img), nil
+}
+
+// AssetHttpHandler lists the images of the store at GET /assets, uploads them with POST /assets/{name} and
+// deletes them with DELETE /assets/{name}.
+func AssetHttpHandler(st *AssetStore) http.Handler {
+	type assetJSON struct {
+		Name   string `json:"name"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /assets", func(rw http.ResponseWriter, r *http.Request) {
+		list := []assetJSON{}
+		for _, name := range st.Names() {
+			if b, err := st.Get(name); err == nil {
+				list = append(list, assetJSON{Name: name, Width: b.Size().X, Height: b.Size().Y})
+			}
+		}
+		writeJSON(rw, http.StatusOK, list)
+	})
+	mux.HandleFunc("POST /assets/{name}", func(rw http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		b, err := st.Put(name, r.Body)
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, ErrAssetTooLarge), errors.As(err, &maxBytesErr):
+			writeError(rw, http.StatusRequestEntityTooLarge, err.Error())
+		case errors.Is(err, ErrAssetFormat):
+			writeError(rw, http.StatusUnsupportedMediaType, err.Error())
+		case errors.Is(err, ErrAssetsFull):
+			writeError(rw, http.StatusInsufficientStorage, err.Error())
+		case err != nil:
+			writeError(rw, http.StatusBadRequest, err.Error())
+		default:
+			writeJSON(rw, http.StatusCreated, assetJSON{Name: name, Width: b.Size().X, Height: b.Size().Y})
+		}
+	})
+	mux.HandleFunc("DELETE /assets/{name}", func(rw http.ResponseWriter, r *http.Request) {
+		if err := st.Delete(r.PathValue("name")); err != nil {
+			writeError(rw, http.StatusNotFound, err.Error())
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// parseBlit parses the arguments of the blit command: the asset name, the normalized position of the top left
+// corner of the image and optionally its normalized width and height.
+func parseBlit(args []string, assets *AssetStore, size image.Point) (*Primitive, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return nil, errors.New("blit command expects an asset name, a position and an optional size")
+	}
+	if _, err := assets.Get(args[0]); err != nil {
+		return nil, err
+	}
+	coords, err := convertToCoordinates(args[1:], size)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Primitive{Kind: "blit", Asset: args[0], Points: []image.Point{{coords[0], coords[1]}}}
+	if len(coords) == 4 {
+		p.Points = append(p.Points, p.Points[0].Add(image.Pt(coords[2], coords[3])))
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// blitOperation returns the operation that draws the image of a blit primitive, or nil if it is not in the store.
+func (p *Primitive) blitOperation(assets *AssetStore) painter.TextureOperation {
+	b, err := assets.Get(p.Asset)
+	if err != nil {
+		return nil
+	}
+	r := image.Rectangle{Min: p.Points[0], Max: p.Points[0].Add(b.Size())}
+	if len(p.Points) == 2 {
+		r.Max = p.Points[1]
+	}
+	return &painter.Blit{Bitmap: b, Rect: r}
+}
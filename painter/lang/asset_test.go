@@ -0,0 +1,209 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encodePNG(t *testing.T, size image.Point, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	for y := range size.Y {
+		for x := range size.X {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAssetStore(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "logo.png"), encodePNG(t, image.Pt(4, 2), color.White), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	st := &AssetStore{Dir: dir, MaxBytes: 1 << 10, MaxPixels: 100}
+
+	if b, err := st.Get("logo.png"); err != nil || b.Size() != image.Pt(4, 2) {
+		t.Errorf("Get(logo.png) = %v, %v", b, err)
+	}
+	if _, err := st.Get("missing.png"); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Get(missing.png) error = %v", err)
+	}
+	if _, err := st.Get("../logo.png"); err == nil {
+		t.Error("Get accepted a name outside the directory")
+	}
+
+	if _, err := st.Put("big", bytes.NewReader(encodePNG(t, image.Pt(20, 20), color.White))); !errors.Is(err, ErrAssetTooLarge) {
+		t.Errorf("Put of too many pixels: error = %v", err)
+	}
+	if _, err := st.Put("long", bytes.NewReader(make([]byte, 2<<10))); !errors.Is(err, ErrAssetTooLarge) {
+		t.Errorf("Put of too many bytes: error = %v", err)
+	}
+	if _, err := st.Put("text", bytes.NewBufferString("not an image")); !errors.Is(err, ErrAssetFormat) {
+		t.Errorf("Put of text: error = %v", err)
+	}
+	if _, err := st.Put("small", bytes.NewReader(encodePNG(t, image.Pt(5, 5), color.White))); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.Names(); len(got) != 2 || got[0] != "logo.png" || got[1] != "small" {
+		t.Errorf("Names() = %v", got)
+	}
+
+	if err := st.Delete("small"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Delete("small"); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Delete of a deleted asset: error = %v", err)
+	}
+	if _, err := st.Get("small"); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Get of a deleted asset: error = %v", err)
+	}
+}
+
+func TestAssetStore_Budget(t *testing.T) {
+	st := &AssetStore{MaxAssets: 2, MaxMemory: 4 * 150}
+	put := func(name string, size image.Point) error {
+		_, err := st.Put(name, bytes.NewReader(encodePNG(t, size, color.White)))
+		return err
+	}
+
+	if err := put("a", image.Pt(10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("b", image.Pt(10, 6)); !errors.Is(err, ErrAssetsFull) {
+		t.Errorf("Put beyond the memory budget: error = %v", err)
+	}
+	if err := put("b", image.Pt(10, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("c", image.Pt(1, 1)); !errors.Is(err, ErrAssetsFull) {
+		t.Errorf("Put beyond the count budget: error = %v", err)
+	}
+	// Replacing an image only counts the difference, and deleting one makes room.
+	if err := put("a", image.Pt(10, 5)); err != nil {
+		t.Errorf("Put of a smaller replacement: error = %v", err)
+	}
+	if err := st.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("c", image.Pt(10, 10)); err != nil {
+		t.Errorf("Put after a delete: error = %v", err)
+	}
+}
+
+func TestAssetHttpHandler(t *testing.T) {
+	st := &AssetStore{}
+	handler := AssetHttpHandler(st)
+
+	do := func(method, name string, body []byte) int {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(method, "/assets/"+name, bytes.NewReader(body)))
+		return rw.Code
+	}
+	post := func(name string, body []byte) int {
+		return do(http.MethodPost, name, body)
+	}
+	if code := post("logo", encodePNG(t, image.Pt(3, 3), color.Black)); code != http.StatusCreated {
+		t.Errorf("upload status = %d", code)
+	}
+	if code := post("logo", []byte("GIF89a")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("invalid image status = %d", code)
+	}
+	if code := post(".hidden", encodePNG(t, image.Pt(3, 3), color.Black)); code != http.StatusBadRequest {
+		t.Errorf("invalid name status = %d", code)
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/assets", nil))
+	var list []struct {
+		Name          string
+		Width, Height int
+	}
+	if err := json.NewDecoder(rw.Body).Decode(&list); err != nil || len(list) != 1 || list[0].Width != 3 {
+		t.Errorf("GET /assets = %+v, %v", list, err)
+	}
+
+	if code := do(http.MethodDelete, "logo", nil); code != http.StatusNoContent {
+		t.Errorf("delete status = %d", code)
+	}
+	if code := do(http.MethodDelete, "logo", nil); code != http.StatusNotFound {
+		t.Errorf("repeated delete status = %d", code)
+	}
+	st.MaxAssets = 1
+	post("first", encodePNG(t, image.Pt(3, 3), color.Black))
+	if code := post("second", encodePNG(t, image.Pt(3, 3), color.Black)); code != http.StatusInsufficientStorage {
+		t.Errorf("upload to a full store status = %d", code)
+	}
+}
+
+func TestBlit_Command(t *testing.T) {
+	assets := &AssetStore{}
+	if _, err := assets.Put("test-blit", bytes.NewReader(encodePNG(t, image.Pt(80, 40), color.RGBA{R: 255, A: 255}))); err != nil {
+		t.Fatal(err)
+	}
+	newArtboard := func() *ArtboardState {
+		as := NewArtboardState()
+		as.Assets = assets
+		return as
+	}
+
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "blit test-blit 0.1 0.1"},
+		{input: "blit test-blit 0.1 0.1 0.5 0.25"},
+		{input: "blit missing 0.1 0.1", wantErr: true},
+		{input: "blit test-blit 0.1", wantErr: true},
+		{input: "blit test-blit 0.1 0.1 0.5", wantErr: true},
+		{input: "blit test-blit 0.1 0.1 0 0.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := NewCommandProcessor(newArtboard()).ProcessCommands(bytes.NewBufferString(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+
+	script := "white\nblit test-blit 0.1 0.1\nblit test-blit 0.5 0.5 0.25 0.125\n"
+	as := newArtboard()
+	if _, err := NewCommandProcessor(as).ProcessCommands(bytes.NewBufferString(script)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := as.MarshalScript(); string(got) != script {
+		t.Errorf("MarshalScript() = %q, want %q", got, script)
+	}
+
+	red, white := color.RGBA{R: 255, A: 255}, color.RGBA{255, 255, 255, 255}
+	checkPixels(t, (&Canvas{Artboard: as}).Snapshot(), map[image.Point]color.RGBA{{100, 100}: red, {159, 119}: red, {160, 100}: white, {590, 490}: red, {610, 500}: white})
+
+	data, err := json.Marshal(as)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := newArtboard()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := decoded.MarshalScript(); string(got) != script {
+		t.Errorf("script after the JSON round trip = %q", got)
+	}
+
+	// Other artboards draw from stores of their own.
+	if _, err := NewCommandProcessor(NewArtboardState()).ProcessCommands(bytes.NewBufferString("blit test-blit 0.1 0.1")); err == nil {
+		t.Error("blit of an asset of another store succeeded")
+	}
+}
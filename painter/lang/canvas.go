@@ -0,0 +1,339 @@
+package lang
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/shiny/screen"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+var (
+	ErrCanvasExists   = errors.New("canvas already exists")
+	ErrCanvasNotFound = errors.New("canvas not found")
+	ErrCanvasInUse    = errors.New("canvas is bound to the window")
+
+	canvasNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// Canvas is an independent drawing with its own event loop, artboard state and command processor.
+type Canvas struct {
+	Name      string
+	Loop      *painter.EventLoop
+	Artboard  *ArtboardState
+	Processor *CommandProcessor
+	Stream    *Broadcaster
+	Assets    *AssetStore // Images drawn by the blit commands of the canvas
+
+	manager *CanvasManager
+	handler http.Handler
+	started bool
+	window  bool
+}
+
+// Start runs the canvas event loop on textures created by s.
+func (c *Canvas) Start(s screen.Screen) {
+	c.manager.mu.Lock()
+	c.started = true
+	c.manager.mu.Unlock()
+
+	c.Loop.Initiate(s)
+}
+
+// Refresh enqueues the operations needed to redraw the canvas from its artboard state.
+func (c *Canvas) Refresh() {
+	_, _ = c.Artboard.Update(c.Loop, func(tx *ArtboardState) ([]painter.TextureOperation, error) {
+		return tx.RefreshArtboard(), nil
+	})
+}
+
+// Snapshot renders the artboard of the canvas into a new image, independently of the event loop.
+func (c *Canvas) Snapshot() *image.RGBA {
+	var (
+		size image.Point
+		ops  []painter.TextureOperation
+	)
+	c.Artboard.View(func(as *ArtboardState) {
+		size = as.canvasSize()
+		ops = as.RefreshArtboard()
+	})
+
+	t, _ := painter.OffscreenScreen{}.NewTexture(size)
+	painter.CompositeOperation(ops).ApplyScreen(t, painter.OffscreenScreen{})
+	return t.(*painter.ImageTexture).RGBA()
+}
+
+// Handler serves the command, state and resource endpoints of the canvas relative to its root.
+func (c *Canvas) Handler() http.Handler {
+	return c.handler
+}
+
+// UpdateTexture publishes the frame to stream subscribers and passes the texture of the displayed canvas,
+// together with its ownership, to the manager's display.
+func (c *Canvas) UpdateTexture(t screen.Texture, release func()) {
+	var pixels *image.RGBA
+	if img, ok := t.(interface{ RGBA() *image.RGBA }); ok {
+		pixels = img.RGBA()
+	}
+	if mt, ok := t.(*painter.MirroredTexture); ok && !mt.Mirrored() {
+		// The copy misses frames while nobody watches the stream.
+		pixels = nil
+	}
+	// The pixels are copied before the texture can be reused.
+	c.Stream.PresentFrame(c.Loop.Frame(), pixels)
+
+	if display := c.manager.displayFor(c); display != nil {
+		display.UpdateTexture(t, release)
+	} else {
+		release()
+	}
+}
+
+// CanvasManager keeps the named canvases served by one painter process and chooses the one shown in the window.
+type CanvasManager struct {
+	// Size is the initial size of new canvases, painter.DefaultCanvasSize if empty.
+	Size image.Point
+	// AssetsDir is the directory the asset stores of new canvases load images from, none if empty.
+	AssetsDir string
+
+	display painter.TextureReceiver
+
+	mu        sync.Mutex
+	canvases  map[string]*Canvas
+	displayed *Canvas
+}
+
+// NewCanvasManager creates a manager that presents frames of the displayed canvas to display.
+func NewCanvasManager(display painter.TextureReceiver) *CanvasManager {
+	return &CanvasManager{display: display, canvases: make(map[string]*Canvas)}
+}
+
+// AddWindowCanvas registers the canvas that is started on the window screen. It becomes the displayed canvas
+// and cannot be deleted. The caller is responsible for calling Start.
+func (cm *CanvasManager) AddWindowCanvas(name string) (*Canvas, error) {
+	c, err := cm.add(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	c.window = true
+	cm.displayed = c
+	return c, nil
+}
+
+// Create registers a new canvas and starts its loop on an off-screen texture.
+func (cm *CanvasManager) Create(name string) (*Canvas, error) {
+	c, err := cm.add(name)
+	if err != nil {
+		return nil, err
+	}
+	c.Start(painter.OffscreenScreen{})
+	return c, nil
+}
+
+func (cm *CanvasManager) add(name string) (*Canvas, error) {
+	if !canvasNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid canvas name %q", name)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if _, ok := cm.canvases[name]; ok {
+		return nil, ErrCanvasExists
+	}
+
+	loop := &painter.EventLoop{Size: cm.Size}
+	artboard := NewArtboardState()
+	artboard.Size = loop.CanvasSize()
+	artboard.Assets = &AssetStore{Dir: cm.AssetsDir}
+	c := &Canvas{
+		Name:      name,
+		Loop:      loop,
+		Artboard:  artboard,
+		Processor: NewCommandProcessor(artboard),
+		Stream:    NewBroadcaster(),
+		Assets:    artboard.Assets,
+		manager:   cm,
+	}
+	c.Loop.Receiver = c
+	// Textures of a MirrorScreen resume mirroring cleared at the next frame, which the refresh redraws in full.
+	c.Stream.OnWatch = c.Refresh
+	artboard.OnUpdate = func(snapshot *ArtboardState) {
+		state, err := json.Marshal(snapshot)
+		if err == nil {
+			c.Stream.Publish(Event{Type: "state", State: state})
+		}
+	}
+	c.Processor.History = NewHistory()
+	c.Processor.OnApply = func(script string) {
+		c.Stream.Publish(Event{Type: "command", Message: script})
+	}
+	c.Processor.OnError = func(err error) {
+		c.Stream.Publish(Event{Type: "error", Message: err.Error()})
+	}
+	c.handler = canvasRoutes(c)
+
+	cm.canvases[name] = c
+	return c, nil
+}
+
+// Get returns the canvas with the given name.
+func (cm *CanvasManager) Get(name string) (*Canvas, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	c, ok := cm.canvases[name]
+	if !ok {
+		return nil, ErrCanvasNotFound
+	}
+	return c, nil
+}
+
+// Names returns the sorted names of all canvases.
+func (cm *CanvasManager) Names() []string {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	names := make([]string, 0, len(cm.canvases))
+	for name := range cm.canvases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Displayed returns the name of the canvas shown in the window.
+func (cm *CanvasManager) Displayed() string {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.displayed == nil {
+		return ""
+	}
+	return cm.displayed.Name
+}
+
+// Display switches the window to the named canvas and redraws it.
+func (cm *CanvasManager) Display(name string) error {
+	cm.mu.Lock()
+	c, ok := cm.canvases[name]
+	if ok {
+		cm.displayed = c
+	}
+	cm.mu.Unlock()
+
+	if !ok {
+		return ErrCanvasNotFound
+	}
+	c.Refresh()
+	return nil
+}
+
+// Delete stops the canvas loop and removes the canvas. If it was displayed, the window canvas is shown instead.
+func (cm *CanvasManager) Delete(name string) error {
+	cm.mu.Lock()
+	c, ok := cm.canvases[name]
+	switch {
+	case !ok:
+		cm.mu.Unlock()
+		return ErrCanvasNotFound
+	case c.window:
+		cm.mu.Unlock()
+		return ErrCanvasInUse
+	}
+
+	delete(cm.canvases, name)
+	var fallback *Canvas
+	if cm.displayed == c {
+		cm.displayed = nil
+		for _, other := range cm.canvases {
+			if other.window {
+				fallback = other
+				cm.displayed = other
+			}
+		}
+	}
+	started := c.started
+	cm.mu.Unlock()
+
+	if started {
+		c.Loop.Terminate()
+	}
+	c.Stream.Close()
+	if fallback != nil {
+		fallback.Refresh()
+	}
+	return nil
+}
+
+// Terminate stops the loops of all started canvases and ends their streams.
+func (cm *CanvasManager) Terminate() {
+	cm.mu.Lock()
+	var all, started []*Canvas
+	for _, c := range cm.canvases {
+		all = append(all, c)
+		if c.started {
+			started = append(started, c)
+		}
+	}
+	cm.mu.Unlock()
+
+	for _, c := range started {
+		c.Loop.Terminate()
+	}
+	for _, c := range all {
+		c.Stream.Close()
+	}
+}
+
+// CloseStreams ends the MJPEG and event streams of all canvases, e.g. before shutting down the HTTP server.
+func (cm *CanvasManager) CloseStreams() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for _, c := range cm.canvases {
+		c.Stream.Close()
+	}
+}
+
+func (cm *CanvasManager) displayFor(c *Canvas) painter.TextureReceiver {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.displayed != c {
+		return nil
+	}
+	return cm.display
+}
+
+// canvasRoutes builds the endpoints that every canvas serves under its root.
+func canvasRoutes(c *Canvas) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", CommandHttpHandler(c.Loop, c.Processor))
+	mux.Handle("/state", StateHandler(c.Loop, c.Artboard))
+	mux.Handle("/state.txt", StateScriptHandler(c.Artboard))
+	mux.Handle("/stream.mjpeg", MJPEGHandler(c.Stream))
+	mux.Handle("/events", EventsHandler(c.Stream))
+	mux.Handle("/ws", WebSocketHandler(c.Loop, c.Processor))
+
+	assets := AssetHttpHandler(c.Assets)
+	mux.Handle("/assets", assets)
+	mux.Handle("/assets/", assets)
+
+	resources := ResourceHandler(c.Loop, c.Artboard)
+	mux.Handle("/shapes", resources)
+	mux.Handle("/shapes/", resources)
+	mux.Handle("/background", resources)
+	mux.Handle("/rectangle", resources)
+	return mux
+}
@@ -0,0 +1,168 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/shiny/screen"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestCanvasHttpHandler(t *testing.T) {
+	display := make(displayReceiver, 1)
+	cm := NewCanvasManager(display)
+	defer cm.Terminate()
+
+	window, err := cm.AddWindowCanvas("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	window.Start(testScreen{})
+
+	handler := CanvasHttpHandler(cm)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/canvas", `{"name":"demo"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/canvas", `{"name":"demo"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate create status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/canvas", `{"name":"../etc"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid name status = %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/canvas", ""); rec.Body.String() != `[{"name":"default","displayed":true},{"name":"demo","displayed":false}]`+"\n" {
+		t.Errorf("list body = %s", rec.Body)
+	}
+
+	if rec := do(http.MethodGet, "/canvas/demo/?cmd=white,update", ""); rec.Code != http.StatusOK {
+		t.Fatalf("command status = %d", rec.Code)
+	}
+	demo, _ := cm.Get("demo")
+	if !sameColor(demo.Artboard.Background, color.White) || window.Artboard.Background != nil {
+		t.Error("command was not applied to the addressed canvas only")
+	}
+
+	if rec := do(http.MethodPost, "/canvas/demo/display", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("display status = %d", rec.Code)
+	}
+	select {
+	case f := <-display:
+		defer f.release()
+		img, ok := f.t.(*painter.ImageTexture)
+		if !ok {
+			t.Fatalf("displayed canvas presented %T, want an off-screen texture", f.t)
+		}
+		if got := img.RGBA().At(10, 10); !sameColor(got, color.White) {
+			t.Errorf("off-screen pixel = %v, want white", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("displayed canvas did not present a frame")
+	}
+
+	if rec := do(http.MethodDelete, "/canvas/default", ""); rec.Code != http.StatusConflict {
+		t.Errorf("deleting the window canvas status = %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/canvas/demo", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", rec.Code)
+	}
+	if cm.Displayed() != "default" {
+		t.Errorf("displayed canvas after delete = %q", cm.Displayed())
+	}
+	if rec := do(http.MethodGet, "/canvas/demo/state", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted canvas status = %d", rec.Code)
+	}
+}
+
+// displayReceiver passes presented textures to the test without blocking the loop. The test releases the textures
+// it receives; the others are released right away.
+type displayReceiver chan displayedFrame
+
+type displayedFrame struct {
+	t       screen.Texture
+	release func()
+}
+
+func (dr displayReceiver) UpdateTexture(t screen.Texture, release func()) {
+	select {
+	case dr <- displayedFrame{t, release}:
+	default:
+		release()
+	}
+}
+
+// processScript processes the script against a fresh artboard.
+func processScript(t *testing.T, script string) *ArtboardState {
+	t.Helper()
+	as := NewArtboardState()
+	if _, err := NewCommandProcessor(as).ProcessCommands(bytes.NewBufferString(script)); err != nil {
+		t.Fatalf("%q: %v", script, err)
+	}
+	return as
+}
+
+// checkRoundTrip processes the script against a fresh artboard and checks that MarshalScript writes it back
+// unchanged, before and after the artboard goes through JSON. It returns the artboard.
+func checkRoundTrip(t *testing.T, script string) *ArtboardState {
+	t.Helper()
+	as := processScript(t, script)
+	if got, err := as.MarshalScript(); err != nil || string(got) != script {
+		t.Errorf("MarshalScript() = %q, %v, want %q", got, err, script)
+	}
+
+	data, err := json.Marshal(as)
+	if err != nil {
+		t.Fatalf("%q: %v", script, err)
+	}
+	decoded := NewArtboardState()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("%q: %v", script, err)
+	}
+	if got, _ := decoded.MarshalScript(); string(got) != script {
+		t.Errorf("script after the JSON round trip = %q, want %q", got, script)
+	}
+	return as
+}
+
+// snapshotScript renders what the script draws on a fresh artboard.
+func snapshotScript(t *testing.T, script string) *image.RGBA {
+	t.Helper()
+	return (&Canvas{Artboard: processScript(t, script)}).Snapshot()
+}
+
+// checkPixels reports the pixels of img that do not have the wanted colors.
+func checkPixels(t *testing.T, img *image.RGBA, want map[image.Point]color.RGBA) {
+	t.Helper()
+	for p, c := range want {
+		if got := img.RGBAAt(p.X, p.Y); got != c {
+			t.Errorf("pixel %v is %v, want %v", p, got, c)
+		}
+	}
+}
+
+func TestSnapshot_LargeInput(t *testing.T) {
+	// Commands at the limits of their arguments render without allocating beyond the canvas.
+	for _, script := range []string{
+		"arc 0.5 0.5 0.25 0.25 0 1e13",
+		"circle 0.5 0.5 4",
+		`text 0 0.5 "WWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWWW" size=1024`,
+		`clip "M 0 0 L 100 0 L 100 100 Z", figure 0.5 0.5 size=8192`,
+		"figure 0.5 0.5 size=8192, scale @1 64 64",
+	} {
+		if img := snapshotScript(t, script); img.Bounds() != (image.Rectangle{Max: painter.DefaultCanvasSize}) {
+			t.Errorf("%q: snapshot is %v", script, img.Bounds())
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// maxClipDepth limits how many clips can be active at once.
+const maxClipDepth = 64
+
+// Clip is a region the clip command limits drawing to: a rectangle in artboard pixels or, if Path is set, the
+// inside of the path by its fill rule.
+type Clip struct {
+	Rect image.Rectangle
+	Path *Path
+}
+
+// applyClip executes the clip command. It takes the corners of a rectangle, path data with an optional
+// rule=nonzero|evenodd, or nothing to clip to the background rectangle. Clips are not affected by the canvas
+// transform.
+func applyClip(artboard *ArtboardState, args []string) error {
+	var c Clip
+	switch {
+	case len(args) == 0:
+		r := artboard.Rectangle
+		if r == nil || r.Bounds.Empty() {
+			return errors.New("clip command without arguments needs a background rectangle")
+		}
+		c.Rect = r.Bounds
+	case len(args) == 4:
+		coords, err := convertToCoordinates(args, artboard.canvasSize())
+		if err != nil {
+			return err
+		}
+		c.Rect = image.Rect(coords[0], coords[1], coords[2], coords[3])
+	case len(args) <= 2:
+		p, err := NewPath(args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) == 2 {
+			value, ok := strings.CutPrefix(args[1], "rule=")
+			if !ok {
+				return fmt.Errorf("unexpected argument %q", args[1])
+			}
+			if p.Rule, err = parseFillRule(value); err != nil {
+				return err
+			}
+		}
+		c.Path = p
+	default:
+		return errors.New("clip command expects four coordinates or path data")
+	}
+	return artboard.PushClip(c)
+}
+
+// ClipStack is a clip on top of the clips it was pushed onto. Objects are drawn where all the clips of their stack
+// overlap; a nil stack does not clip. Stacks are never modified, so the objects placed under the same clips share
+// one, along with the region it caches.
+type ClipStack struct {
+	Clip
+	Parent *ClipStack
+
+	mu     sync.Mutex
+	size   image.Point // Canvas size the region was computed for
+	region *painter.Clip
+}
+
+// push returns the stack with the clip on top.
+func (cs *ClipStack) push(c Clip) *ClipStack {
+	if c.Path == nil {
+		c.Rect = c.Rect.Canon()
+	}
+	return &ClipStack{Clip: c, Parent: cs}
+}
+
+// Len returns the number of clips in the stack.
+func (cs *ClipStack) Len() int {
+	n := 0
+	for ; cs != nil; cs = cs.Parent {
+		n++
+	}
+	return n
+}
+
+// List returns the clips of the stack, the one pushed first at the start.
+func (cs *ClipStack) List() []Clip {
+	clips := make([]Clip, cs.Len())
+	for i := len(clips) - 1; cs != nil; cs, i = cs.Parent, i-1 {
+		clips[i] = cs.Clip
+	}
+	return clips
+}
+
+// Region returns the region of a canvas of the given size where all the clips overlap, nil for a nil stack. It
+// is computed once per size and shared, so it must not be modified.
+func (cs *ClipStack) Region(size image.Point) *painter.Clip {
+	if cs == nil {
+		return nil
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.region != nil && cs.size == size {
+		return cs.region
+	}
+
+	canvas := image.Rectangle{Max: size}
+	region := painter.ClipRect(cs.Rect.Intersect(canvas))
+	if cs.Path != nil {
+		region = painter.ClipPath(cs.Path.scaled(size), cs.Path.Rule, canvas)
+	}
+	if parent := cs.Parent.Region(size); parent != nil {
+		region = parent.Intersect(region)
+	}
+	cs.size, cs.region = size, region
+	return region
+}
+
+// PushClip limits what later commands draw to the region, inside the clips that are already active.
+func (as *ArtboardState) PushClip(c Clip) error {
+	if as.clips.Len() >= maxClipDepth {
+		return fmt.Errorf("more than %d clips active", maxClipDepth)
+	}
+	as.clips = as.clips.push(c)
+	return nil
+}
+
+// PopClip removes the clip pushed last.
+func (as *ArtboardState) PopClip() error {
+	if as.clips == nil {
+		return errors.New("unclip without a matching clip")
+	}
+	as.clips = as.clips.Parent
+	return nil
+}
+
+// clipOperation limits the operation to the region of the clips.
+func clipOperation(op painter.TextureOperation, clips *ClipStack, size image.Point) painter.TextureOperation {
+	if clips == nil || op == nil {
+		return op
+	}
+	return painter.Clipped(op, clips.Region(size))
+}
+
+// clipsContain reports whether the pixel is inside all the clips.
+func clipsContain(clips *ClipStack, p image.Point, size image.Point) bool {
+	return clips == nil || clips.Region(size).Contains(p)
+}
+
+// rescaleClips converts clips from a canvas of one size to another one. Paths are normalized, so only rectangles
+// change. Stacks converted before are looked up in converted, so that objects keep sharing them.
+func rescaleClips(clips *ClipStack, from, to image.Point, converted map[*ClipStack]*ClipStack) *ClipStack {
+	if clips == nil {
+		return nil
+	}
+	if c, ok := converted[clips]; ok {
+		return c
+	}
+	scale := func(v, from, to int) int {
+		return int(math.Round(float64(v) * float64(to) / float64(from)))
+	}
+	c := clips.Clip
+	if c.Path == nil {
+		c.Rect = image.Rect(scale(c.Rect.Min.X, from.X, to.X), scale(c.Rect.Min.Y, from.Y, to.Y),
+			scale(c.Rect.Max.X, from.X, to.X), scale(c.Rect.Max.Y, from.Y, to.Y))
+	}
+	scaled := rescaleClips(clips.Parent, from, to, converted).push(c)
+	converted[clips] = scaled
+	return scaled
+}
+
+// writeClips writes the unclip and clip commands that turn the active clips into the wanted ones and returns
+// the wanted clips, which are active afterwards. Clips both have in common are kept.
+func writeClips(buf *bytes.Buffer, active, wanted *ClipStack, size image.Point) *ClipStack {
+	if active == wanted {
+		return wanted
+	}
+	from, to := active.List(), wanted.List()
+	common := 0
+	for common < len(from) && common < len(to) && sameClip(from[common], to[common]) {
+		common++
+	}
+	for range from[common:] {
+		buf.WriteString("unclip\n")
+	}
+	for _, c := range to[common:] {
+		writeClip(buf, c, size)
+	}
+	return wanted
+}
+
+// writeClip writes the clip command that pushes the clip.
+func writeClip(buf *bytes.Buffer, c Clip, size image.Point) {
+	if c.Path != nil {
+		// NewPath rejects quotes and line breaks in path data, so it needs no escaping.
+		fmt.Fprintf(buf, "clip \"%s\"", c.Path.Data)
+		if c.Path.Rule == painter.EvenOdd {
+			buf.WriteString(" rule=evenodd")
+		}
+		buf.WriteByte('\n')
+		return
+	}
+	fmt.Fprintf(buf, "clip %s %s %s %s\n",
+		formatCoordinate(c.Rect.Min.X, size.X), formatCoordinate(c.Rect.Min.Y, size.Y),
+		formatCoordinate(c.Rect.Max.X, size.X), formatCoordinate(c.Rect.Max.Y, size.Y))
+}
+
+func sameClip(a, b Clip) bool {
+	if a.Path == nil || b.Path == nil {
+		return a.Path == nil && b.Path == nil && a.Rect == b.Rect
+	}
+	return a.Path.Data == b.Path.Data && a.Path.Rule == b.Path.Rule
+}
+
+// clipJSON is the wire format of a Clip: the normalized corners of a rectangle, or path data and its fill rule.
+type clipJSON struct {
+	Rect *[4]float64 `json:"rect,omitempty"`
+	Path string      `json:"path,omitempty"`
+	Rule string      `json:"rule,omitempty"`
+}
+
+func clipResources(clips *ClipStack, size image.Point) []clipJSON {
+	var cj []clipJSON
+	for _, c := range clips.List() {
+		if c.Path != nil {
+			cj = append(cj, clipJSON{Path: c.Path.Data, Rule: formatFillRule(c.Path.Rule)})
+			continue
+		}
+		cj = append(cj, clipJSON{Rect: &[4]float64{
+			normalize(c.Rect.Min.X, size.X), normalize(c.Rect.Min.Y, size.Y),
+			normalize(c.Rect.Max.X, size.X), normalize(c.Rect.Max.Y, size.Y),
+		}})
+	}
+	return cj
+}
+
+func parseClipsJSON(cj []clipJSON, size image.Point) (*ClipStack, error) {
+	if len(cj) > maxClipDepth {
+		return nil, fmt.Errorf("more than %d clips", maxClipDepth)
+	}
+	var clips *ClipStack
+	for _, c := range cj {
+		switch {
+		case c.Rect != nil && c.Path == "":
+			if err := checkCoordinates(c.Rect[:]...); err != nil {
+				return nil, err
+			}
+			r := image.Rect(denormalize(c.Rect[0], size.X), denormalize(c.Rect[1], size.Y), denormalize(c.Rect[2], size.X), denormalize(c.Rect[3], size.Y))
+			clips = clips.push(Clip{Rect: r})
+		case c.Rect == nil && c.Path != "":
+			p, err := NewPath(c.Path)
+			if err != nil {
+				return nil, err
+			}
+			if p.Rule, err = parseFillRule(c.Rule); err != nil {
+				return nil, err
+			}
+			clips = clips.push(Clip{Path: p})
+		default:
+			return nil, errors.New("clip must have either a rectangle or a path")
+		}
+	}
+	return clips, nil
+}
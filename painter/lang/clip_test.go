@@ -0,0 +1,107 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestClip_Commands(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "clip 0.1 0.1 0.9 0.9, figure 0.5 0.5, unclip"},
+		{input: "clip \"M 0 0 L 1 0 L 0 1 Z\" rule=evenodd, line 0 0 1 1, unclip"},
+		{input: "bgrect 0.1 0.1 0.9 0.9, clip, clip 0 0 0.5 0.5, figure 0.5 0.5"},
+		{input: "reset, clip", wantErr: true},
+		{input: "clip 0.1 0.1 0.9", wantErr: true},
+		{input: "clip \"M 0 0 X\"", wantErr: true},
+		{input: "clip \"M 0 0 L 1 1\" fill=#fff", wantErr: true},
+		{input: "unclip", wantErr: true},
+		{input: "clip 0 0 1 1, unclip, unclip", wantErr: true},
+		{input: "clip 0 0 1 1, unclip 1", wantErr: true},
+		{input: "clip NaN 0 1 1", wantErr: true},
+		{input: "clip 0 0 1e300 1", wantErr: true},
+		{input: "clip -4 -4 4 4"},
+		{input: "clip 0 0 4.5 1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewCommandProcessor(NewArtboardState()).ProcessCommands(bytes.NewBufferString(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"shapes":[{"x":0.5,"y":0.5,"clip":[{"rect":[0,0,1e300,1]}]}]}`), NewArtboardState()); err == nil {
+		t.Error("clip rectangle far beyond the canvas was accepted")
+	}
+}
+
+func TestClip_RoundTrip(t *testing.T) {
+	script := "clip 0.1 0.1 0.9 0.9\n" +
+		"bgrect 0.1 0.1 0.9 0.9\n" +
+		"clip \"M 0 0 L 1 0 L 0 1 Z\" rule=evenodd\n" +
+		"line 0 0 1 1\n" +
+		"unclip\n" +
+		"unclip\n" +
+		"line 0 1 1 0\n" +
+		"clip 0.1 0.1 0.9 0.9\n" +
+		"figure 0.9 0.5\n" +
+		"unclip\n"
+
+	as := checkRoundTrip(t, script)
+	for _, script := range []string{
+		"clip -4 -4 4 4\nfigure 0.5 0.5\nunclip\n",
+	} {
+		checkRoundTrip(t, script)
+	}
+
+	// Resizing scales clip rectangles without touching the clips of the original state.
+	snapshot := as.clone()
+	as.ResizeArtboard(image.Pt(400, 400))
+	if got, want := as.Shapes[0].Clips.Rect, image.Rect(40, 40, 360, 360); got != want {
+		t.Errorf("clip after the resize is %v, want %v", got, want)
+	}
+	if got, want := snapshot.Shapes[0].Clips.Rect, image.Rect(80, 80, 720, 720); got != want {
+		t.Errorf("clip of the snapshot is %v, want %v", got, want)
+	}
+}
+
+func TestClipStack_Region(t *testing.T) {
+	as := NewArtboardState()
+	script := "clip \"M 0 0 L 100 0 L 100 100 Z\"\nclip 0 0 0.5 0.5\nbgrect 0 0 1 1\nfigure 0.25 0.25\n"
+	if _, err := NewCommandProcessor(as).ProcessCommands(bytes.NewBufferString(script)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The region of the huge path is limited to the canvas and computed once for the objects sharing it.
+	clips := as.Shapes[0].Clips
+	region := clips.Region(as.canvasSize())
+	if region.Rect != image.Rect(0, 0, 400, 400) || region != as.Rectangle.Clips.Region(as.canvasSize()) {
+		t.Errorf("region covers %v and is not shared", region.Rect)
+	}
+	if !region.Contains(image.Pt(300, 100)) || region.Contains(image.Pt(100, 300)) {
+		t.Error("region is not the inside of both clips")
+	}
+
+	// Resizing keeps the stack shared and computes the region for the new size.
+	as.ResizeArtboard(image.Pt(400, 400))
+	if as.Shapes[0].Clips != as.Rectangle.Clips || as.Shapes[0].Clips.Parent != as.clips.Parent {
+		t.Error("resize does not keep the clips shared")
+	}
+	if got := as.Shapes[0].Clips.Region(as.canvasSize()).Rect; got != image.Rect(0, 0, 200, 200) {
+		t.Errorf("region after the resize covers %v", got)
+	}
+}
+
+func TestClip_Draw(t *testing.T) {
+	img := snapshotScript(t, "white\nbgrect 0.25 0.25 0.75 0.75 #fff\nclip\nfigure 0.75 0.5 #000\nunclip\nfigure 0.25 0.5 #000\n")
+
+	// The figure on the right edge of the frame is cut by it, the one on the left is not.
+	black, white := color.RGBA{A: 255}, color.RGBA{255, 255, 255, 255}
+	checkPixels(t, img, map[image.Point]color.RGBA{{590, 400}: black, {610, 400}: white, {210, 400}: black, {190, 400}: black})
+}
@@ -0,0 +1,66 @@
+package lang
+
+import (
+	"fmt"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// parseColor parses a hex color in one of the #rgb, #rgba, #rrggbb or #rrggbbaa forms.
+func parseColor(s string) (color.NRGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok {
+		return color.NRGBA{}, fmt.Errorf("color %q must start with #", s)
+	}
+
+	switch len(hex) {
+	case 3, 4:
+		var expanded strings.Builder
+		for _, r := range hex {
+			expanded.WriteRune(r)
+			expanded.WriteRune(r)
+		}
+		hex = expanded.String()
+	case 6, 8:
+	default:
+		return color.NRGBA{}, fmt.Errorf("color %q has invalid length", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("color %q is not a hex value", s)
+	}
+	return color.NRGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
+
+// parseCompositeMode parses the composite operator of a drawing: "over", which blends translucent colors over
+// the pixels below and is the default, or "src", which replaces them.
+func parseCompositeMode(s string) (draw.Op, error) {
+	switch s {
+	case "", "over":
+		return draw.Over, nil
+	case "src":
+		return draw.Src, nil
+	default:
+		return 0, fmt.Errorf("composite mode %q must be over or src", s)
+	}
+}
+
+// formatCompositeMode is the inverse of parseCompositeMode; it returns an empty string for the default.
+func formatCompositeMode(op draw.Op) string {
+	if op == draw.Src {
+		return "src"
+	}
+	return ""
+}
+
+// formatColor encodes a color in the #rrggbbaa form understood by parseColor.
+func formatColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
@@ -0,0 +1,239 @@
+package lang
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mobile/event/mouse"
+)
+
+// Actions performed by Editor.Perform, usually bound to keys in the window.
+const (
+	ActionNudgeLeft  = "nudge-left"  // Move the selected figure left by a few pixels
+	ActionNudgeRight = "nudge-right" // Move the selected figure right
+	ActionNudgeUp    = "nudge-up"    // Move the selected figure up
+	ActionNudgeDown  = "nudge-down"  // Move the selected figure down
+	ActionDelete     = "delete"      // Remove the selected figure
+	ActionUndo       = "undo"        // Undo the last script
+	ActionRedo       = "redo"        // Redo the last undone script
+	ActionReset      = "reset"       // Reset the artboard
+	ActionSnapshot   = "snapshot"    // Save the canvas as a PNG file
+	ActionPause      = "pause"       // Pause or resume the event loop
+)
+
+// EditorActions lists the actions known to Editor.Perform.
+var EditorActions = []string{
+	ActionNudgeLeft, ActionNudgeRight, ActionNudgeUp, ActionNudgeDown,
+	ActionDelete, ActionUndo, ActionRedo, ActionReset, ActionSnapshot, ActionPause,
+}
+
+// nudgeStep is the distance in pixels a figure is moved by the nudge actions.
+const nudgeStep = 10
+
+// Editor turns mouse and keyboard input on the displayed canvas into commands, so that edits made in the window
+// go through the command processor like any script: they are journaled, can be undone and reach the stream
+// subscribers. Dragging with the left button moves the figure under the pointer and selects it, a right click
+// places a new figure and selects it.
+type Editor struct {
+	Canvases *CanvasManager
+
+	// SnapshotDir is the directory snapshots are saved to, the working directory if empty.
+	SnapshotDir string
+
+	drag     *figureDrag
+	gestures int
+
+	selected   int // Identifier of the selected figure, 0 if there is none
+	selectedOn *Canvas
+}
+
+// figureDrag is a figure being moved with the mouse.
+type figureDrag struct {
+	canvas  *Canvas
+	id      int
+	grab    image.Point // Offset from the figure center to the pointer in pixels
+	gesture string
+}
+
+func NewEditor(cm *CanvasManager) *Editor {
+	return &Editor{Canvases: cm}
+}
+
+// HandleMouse handles a mouse event at the normalized canvas coordinates x and y. It must be called from a single
+// goroutine, such as the window event loop.
+func (e *Editor) HandleMouse(x, y float64, button mouse.Button, dir mouse.Direction) {
+	switch {
+	case dir == mouse.DirNone:
+		if e.drag != nil {
+			e.dragTo(x, y)
+		}
+	case button == mouse.ButtonLeft && dir == mouse.DirPress:
+		e.drag = e.grab(x, y)
+		if e.drag != nil {
+			e.selected, e.selectedOn = e.drag.id, e.drag.canvas
+		} else {
+			e.selected, e.selectedOn = 0, nil
+		}
+	case button == mouse.ButtonLeft && dir == mouse.DirRelease:
+		if e.drag != nil {
+			e.dragTo(x, y)
+			e.drag = nil
+		}
+	case button == mouse.ButtonRight && dir == mouse.DirPress:
+		c, err := e.Canvases.Get(e.Canvases.Displayed())
+		if err != nil {
+			return
+		}
+		var size image.Point
+		c.Artboard.View(func(as *ArtboardState) { size = as.canvasSize() })
+		p := pixelPoint(x, y, size)
+		if e.run(c, fmt.Sprintf("figure %s %s", formatCoordinate(p.X, size.X), formatCoordinate(p.Y, size.Y)), "") == nil {
+			c.Artboard.View(func(as *ArtboardState) { e.selected, e.selectedOn = as.lastID, c })
+		}
+	}
+}
+
+// Perform runs one of the editor actions on the displayed canvas.
+func (e *Editor) Perform(action string) error {
+	c, err := e.Canvases.Get(e.Canvases.Displayed())
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ActionNudgeLeft:
+		return e.nudge(c, -nudgeStep, 0)
+	case ActionNudgeRight:
+		return e.nudge(c, nudgeStep, 0)
+	case ActionNudgeUp:
+		return e.nudge(c, 0, -nudgeStep)
+	case ActionNudgeDown:
+		return e.nudge(c, 0, nudgeStep)
+	case ActionDelete:
+		if e.selectedOn != c || e.selected == 0 {
+			return nil
+		}
+		err := e.run(c, fmt.Sprintf("remove @%d", e.selected), "")
+		e.selected, e.selectedOn = 0, nil
+		return err
+	case ActionUndo:
+		return c.Processor.Undo(c.Loop)
+	case ActionRedo:
+		return c.Processor.Redo(c.Loop)
+	case ActionReset:
+		return e.run(c, "reset,update", "")
+	case ActionSnapshot:
+		return e.saveSnapshot(c)
+	case ActionPause:
+		if c.Loop.Paused() {
+			c.Loop.Resume()
+		} else {
+			c.Loop.Pause()
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown editor action %q", action)
+	}
+}
+
+// nudge moves the selected figure by the given number of pixels.
+func (e *Editor) nudge(c *Canvas, dx, dy int) error {
+	if e.selectedOn != c || e.selected == 0 {
+		return nil
+	}
+
+	var size image.Point
+	c.Artboard.View(func(as *ArtboardState) { size = as.canvasSize() })
+	return e.run(c, fmt.Sprintf("move @%d %s %s", e.selected, formatCoordinate(dx, size.X), formatCoordinate(dy, size.Y)), "")
+}
+
+// saveSnapshot writes the canvas into a new PNG file in SnapshotDir.
+func (e *Editor) saveSnapshot(c *Canvas) error {
+	name := fmt.Sprintf("%s-%s.png", c.Name, time.Now().Format("20060102-150405.000"))
+	path := filepath.Join(e.SnapshotDir, name)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, c.Snapshot()); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("Saved snapshot %s", path)
+	return nil
+}
+
+// grab starts dragging the topmost figure under the pointer, if any.
+func (e *Editor) grab(x, y float64) *figureDrag {
+	c, err := e.Canvases.Get(e.Canvases.Displayed())
+	if err != nil {
+		return nil
+	}
+
+	var drag *figureDrag
+	c.Artboard.View(func(as *ArtboardState) {
+		p := pixelPoint(x, y, as.canvasSize())
+		for i := len(as.Shapes) - 1; i >= 0; i-- {
+			// Clipped away parts of a figure cannot be grabbed.
+			if fig := as.Shapes[i]; fig.HitTest(p) && clipsContain(fig.Clips, p, as.canvasSize()) {
+				drag = &figureDrag{canvas: c, id: fig.ID, grab: p.Sub(image.Pt(fig.CenterX, fig.CenterY))}
+				return
+			}
+		}
+	})
+	if drag != nil {
+		e.gestures++
+		drag.gesture = fmt.Sprintf("drag-%d", e.gestures)
+	}
+	return drag
+}
+
+// dragTo moves the dragged figure under the pointer.
+func (e *Editor) dragTo(x, y float64) {
+	d := e.drag
+
+	var (
+		delta image.Point
+		size  image.Point
+		found bool
+	)
+	d.canvas.Artboard.View(func(as *ArtboardState) {
+		fig := as.FindShape(d.id)
+		if found = fig != nil; found {
+			size = as.canvasSize()
+			delta = pixelPoint(x, y, size).Sub(d.grab).Sub(image.Pt(fig.CenterX, fig.CenterY))
+		}
+	})
+	if !found {
+		// The figure was removed meanwhile.
+		e.drag = nil
+		return
+	}
+	if delta == (image.Point{}) {
+		return
+	}
+
+	_ = e.run(d.canvas, fmt.Sprintf("move @%d %s %s", d.id, formatCoordinate(delta.X, size.X), formatCoordinate(delta.Y, size.Y)), d.gesture)
+}
+
+// run executes the script on the canvas. Failures are also reported through the processor's OnError.
+func (e *Editor) run(c *Canvas, script, gesture string) error {
+	_, err := c.Processor.ExecuteGesture(strings.NewReader(script), c.Loop, gesture)
+	return err
+}
+
+// pixelPoint converts normalized coordinates into pixels of a canvas of the given size.
+func pixelPoint(x, y float64, size image.Point) image.Point {
+	return image.Pt(denormalize(x, size.X), denormalize(y, size.Y))
+}
@@ -0,0 +1,160 @@
+package lang
+
+import (
+	"image"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/mobile/event/mouse"
+)
+
+// expectFrame runs the edit and waits until the canvas presents a frame to the display after it.
+func expectFrame(t *testing.T, c *Canvas, display displayReceiver, edit func()) {
+	t.Helper()
+	for len(display) > 0 {
+		(<-display).release()
+	}
+	frame := c.Loop.Frame()
+	edit()
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case f := <-display:
+			f.release()
+			if c.Loop.Frame() > frame {
+				return
+			}
+		case <-deadline:
+			t.Fatal("the edit was not presented")
+		}
+	}
+}
+
+func TestEditor_HandleMouse(t *testing.T) {
+	display := make(displayReceiver, 1)
+	cm := NewCanvasManager(display)
+	defer cm.Terminate()
+	c, err := cm.AddWindowCanvas("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start(testScreen{})
+
+	editor := NewEditor(cm)
+	center := func() image.Point {
+		var p image.Point
+		c.Artboard.View(func(as *ArtboardState) {
+			if len(as.Shapes) == 1 {
+				p = image.Pt(as.Shapes[0].CenterX, as.Shapes[0].CenterY)
+			}
+		})
+		return p
+	}
+
+	expectFrame(t, c, display, func() { editor.HandleMouse(0.5, 0.25, mouse.ButtonRight, mouse.DirPress) })
+	if got := center(); got != image.Pt(400, 200) {
+		t.Fatalf("right click placed a figure at %v", got)
+	}
+
+	// Clicking outside of the figure does not start a drag.
+	editor.HandleMouse(0.9, 0.9, mouse.ButtonLeft, mouse.DirPress)
+	editor.HandleMouse(0.1, 0.1, mouse.ButtonNone, mouse.DirNone)
+	editor.HandleMouse(0.1, 0.1, mouse.ButtonLeft, mouse.DirRelease)
+	if got := center(); got != image.Pt(400, 200) {
+		t.Fatalf("figure moved to %v without being grabbed", got)
+	}
+
+	editor.HandleMouse(0.5, 0.3, mouse.ButtonLeft, mouse.DirPress)
+	expectFrame(t, c, display, func() { editor.HandleMouse(0.6, 0.3, mouse.ButtonNone, mouse.DirNone) })
+	editor.HandleMouse(0.625, 0.5, mouse.ButtonLeft, mouse.DirRelease)
+	if got := center(); got != image.Pt(500, 360) {
+		t.Fatalf("dragged figure is at %v, want it to follow the pointer", got)
+	}
+
+	journal := c.Processor.History.Journal()
+	want := []string{"figure 0.5 0.25", "move @1 0.1 0", "move @1 0.025 0.2"}
+	if strings.Join(journal, "|") != strings.Join(want, "|") {
+		t.Errorf("journal = %q, want %q", journal, want)
+	}
+
+	// The whole drag is undone at once.
+	if err := c.Processor.Undo(c.Loop); err != nil {
+		t.Fatal(err)
+	}
+	if got := center(); got != image.Pt(400, 200) {
+		t.Errorf("figure is at %v after undoing the drag", got)
+	}
+}
+
+func TestEditor_Perform(t *testing.T) {
+	display := make(displayReceiver, 1)
+	cm := NewCanvasManager(display)
+	defer cm.Terminate()
+	c, err := cm.AddWindowCanvas("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start(testScreen{})
+
+	editor := NewEditor(cm)
+	editor.SnapshotDir = t.TempDir()
+	perform := func(action string) {
+		t.Helper()
+		if err := editor.Perform(action); err != nil {
+			t.Fatalf("%s: %s", action, err)
+		}
+	}
+	shapes := func() []image.Point {
+		var points []image.Point
+		c.Artboard.View(func(as *ArtboardState) {
+			for _, fig := range as.Shapes {
+				points = append(points, image.Pt(fig.CenterX, fig.CenterY))
+			}
+		})
+		return points
+	}
+
+	// Nothing is selected yet.
+	perform(ActionNudgeLeft)
+	perform(ActionDelete)
+
+	editor.HandleMouse(0.5, 0.5, mouse.ButtonRight, mouse.DirPress)
+	perform(ActionNudgeLeft)
+	expectFrame(t, c, display, func() { perform(ActionNudgeDown) })
+	if got := shapes(); len(got) != 1 || got[0] != image.Pt(390, 410) {
+		t.Fatalf("nudged figures are at %v", got)
+	}
+
+	perform(ActionUndo)
+	if got := shapes(); got[0] != image.Pt(390, 400) {
+		t.Errorf("figure is at %v after undo", got[0])
+	}
+	perform(ActionRedo)
+
+	expectFrame(t, c, display, func() { perform(ActionDelete) })
+	if got := shapes(); len(got) != 0 {
+		t.Errorf("figures after delete: %v", got)
+	}
+
+	perform(ActionSnapshot)
+	files, _ := filepath.Glob(filepath.Join(editor.SnapshotDir, "default-*.png"))
+	if len(files) != 1 {
+		t.Errorf("snapshot files: %v", files)
+	}
+
+	perform(ActionPause)
+	if !c.Loop.Paused() {
+		t.Error("pause did not pause the loop")
+	}
+	perform(ActionPause)
+	if c.Loop.Paused() {
+		t.Error("second pause did not resume the loop")
+	}
+
+	if err := editor.Perform("fly"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
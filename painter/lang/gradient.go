@@ -0,0 +1,166 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// isGradient reports whether the argument is a gradient rather than a color.
+func isGradient(s string) bool {
+	return strings.HasPrefix(s, "linear(") || strings.HasPrefix(s, "radial(")
+}
+
+// parseGradient parses a gradient laid over the bounds of what it fills:
+//
+//	linear(ANGLE, STOP, STOP...)
+//	radial(X Y, RADIUS, STOP, STOP...)
+//
+// The angle is in degrees, clockwise from the top, with an optional deg suffix. The center and the radius of
+// a radial gradient are fractions of the size of the bounds. Every stop is a color followed by its offset from
+// 0 to 1; stops without an offset are spread evenly between their neighbours.
+func parseGradient(s string) (painter.Gradient, error) {
+	kind, rest, _ := strings.Cut(s, "(")
+	body, ok := strings.CutSuffix(rest, ")")
+	if !ok {
+		return nil, fmt.Errorf("gradient %q must end with )", s)
+	}
+	args := strings.Split(body, ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+
+	switch kind {
+	case "linear":
+		angle, err := parseFinite(strings.TrimSuffix(args[0], "deg"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gradient angle %q", args[0])
+		}
+		stops, err := parseStops(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &painter.LinearGradient{Angle: angle, Stops: stops}, nil
+	case "radial":
+		if len(args) < 2 {
+			return nil, errors.New("radial gradient expects a center and a radius")
+		}
+		geometry := append(strings.Fields(args[0]), args[1])
+		if len(geometry) != 3 {
+			return nil, fmt.Errorf("invalid radial gradient geometry %q", args[0]+", "+args[1])
+		}
+		values := make([]float64, 3)
+		for i, arg := range geometry {
+			v, err := parseFinite(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid radial gradient geometry %q", args[0]+", "+args[1])
+			}
+			values[i] = v
+		}
+		if values[2] <= 0 {
+			return nil, errors.New("gradient radius must be positive")
+		}
+		stops, err := parseStops(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		return &painter.RadialGradient{Center: painter.Point{X: values[0], Y: values[1]}, Radius: values[2], Stops: stops}, nil
+	default:
+		return nil, fmt.Errorf("unknown gradient %q", kind)
+	}
+}
+
+func parseStops(args []string) ([]painter.Stop, error) {
+	if len(args) < 2 {
+		return nil, errors.New("gradient expects at least two stops")
+	}
+
+	stops := make([]painter.Stop, len(args))
+	given := make([]bool, len(args))
+	for i, arg := range args {
+		fields := strings.Fields(arg)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid gradient stop %q", arg)
+		}
+		c, err := parseColor(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		stops[i].Color = c
+		if len(fields) == 2 {
+			offset, err := parseFinite(fields[1])
+			if err != nil || !(offset >= 0 && offset <= 1) {
+				return nil, fmt.Errorf("gradient stop offset %q must be from 0 to 1", fields[1])
+			}
+			stops[i].Offset, given[i] = offset, true
+		}
+	}
+
+	// The ends default to 0 and 1, the stops in between are spread evenly.
+	if !given[0] {
+		stops[0].Offset, given[0] = 0, true
+	}
+	if last := len(stops) - 1; !given[last] {
+		stops[last].Offset, given[last] = 1, true
+	}
+	for i := 1; i < len(stops); i++ {
+		if given[i] {
+			continue
+		}
+		next := i + 1
+		for !given[next] {
+			next++
+		}
+		from, to := stops[i-1].Offset, stops[next].Offset
+		stops[i].Offset = from + (to-from)/float64(next-i+1)
+	}
+	for i := 1; i < len(stops); i++ {
+		if stops[i].Offset < stops[i-1].Offset {
+			return nil, errors.New("gradient stops must be in order")
+		}
+	}
+	return stops, nil
+}
+
+// formatGradient is the inverse of parseGradient; it writes the offsets of all stops.
+func formatGradient(g painter.Gradient) string {
+	var b strings.Builder
+	var stops []painter.Stop
+	switch g := g.(type) {
+	case *painter.LinearGradient:
+		fmt.Fprintf(&b, "linear(%sdeg", formatFloat(g.Angle))
+		stops = g.Stops
+	case *painter.RadialGradient:
+		fmt.Fprintf(&b, "radial(%s %s, %s", formatFloat(g.Center.X), formatFloat(g.Center.Y), formatFloat(g.Radius))
+		stops = g.Stops
+	}
+	for _, s := range stops {
+		fmt.Fprintf(&b, ", %s %s", formatColor(s.Color), formatFloat(s.Offset))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// parseFill parses the fill of a JSON representation, which is either a color or a gradient.
+func parseFill(s string) (color.Color, painter.Gradient, error) {
+	if isGradient(s) {
+		g, err := parseGradient(s)
+		return nil, g, err
+	}
+	c, err := parseColor(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, nil, nil
+}
+
+// formatFill is the inverse of parseFill; the gradient wins if both are set.
+func formatFill(c color.Color, g painter.Gradient) string {
+	if g != nil {
+		return formatGradient(g)
+	}
+	return formatColor(c)
+}
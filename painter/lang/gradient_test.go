@@ -0,0 +1,118 @@
+package lang
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestParseGradient(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "linear(90deg, #000 0, #0a0 1)", want: "linear(90deg, #000000ff 0, #00aa00ff 1)"},
+		{input: "linear(45, #f00, #0f0, #00f)", want: "linear(45deg, #ff0000ff 0, #00ff00ff 0.5, #0000ffff 1)"},
+		{input: "linear(0, #f00, #0f0 0.2, #00f, #fff, #000)", want: "linear(0deg, #ff0000ff 0, #00ff00ff 0.2, #0000ffff 0.4666666666666667, #ffffffff 0.7333333333333334, #000000ff 1)"},
+		{input: "radial(0.5 0.25, 0.75, #fff, #0008)", want: "radial(0.5 0.25, 0.75, #ffffffff 0, #00000088 1)"},
+		{input: "linear(90deg, #000)", wantErr: true},
+		{input: "linear(up, #000, #fff)", wantErr: true},
+		{input: "linear(90, #000 0.5, #fff 0.2)", wantErr: true},
+		{input: "linear(90, #000 2, #fff)", wantErr: true},
+		{input: "linear(90, #000, #fff", wantErr: true},
+		{input: "radial(0.5, 0.5, #000, #fff)", wantErr: true},
+		{input: "radial(0.5 0.5, 0, #000, #fff)", wantErr: true},
+		{input: "conic(0, #000, #fff)", wantErr: true},
+		{input: "linear(NaNdeg, #000, #fff)", wantErr: true},
+		{input: "linear(Inf, #000, #fff)", wantErr: true},
+		{input: "linear(90, #000 NaN, #fff)", wantErr: true},
+		{input: "radial(NaN 0.5, 0.5, #000, #fff)", wantErr: true},
+		{input: "radial(0.5 0.5, Inf, #000, #fff)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		g, err := parseGradient(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseGradient(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err == nil && formatGradient(g) != tt.want {
+			t.Errorf("parseGradient(%q) = %s, want %s", tt.input, formatGradient(g), tt.want)
+		}
+	}
+}
+
+func TestGradient_Commands(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "bg linear(90deg, #000 0, #0a0 1)"},
+		{input: "bg #123456"},
+		{input: "bg linear(90deg, #000 0, #0a0 1), figure 0.5 0.5 radial(0.5 0.5, 0.5, #fff, #000)"},
+		{input: `text 0.1 0.1 "gradient" color=linear(90, #f00, #00f)`},
+		{input: "bg", wantErr: true},
+		{input: "bg linear(90deg, #000 0", wantErr: true},
+		{input: "bg linear(90deg, #000)", wantErr: true},
+		{input: "bg #000 #fff", wantErr: true},
+		{input: "bgrect 0 0 1 1 linear(90, #000, bad)", wantErr: true},
+		{input: "bg linear(NaNdeg, #000000ff, #ffffffff)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewCommandProcessor(NewArtboardState()).ProcessCommands(bytes.NewBufferString(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGradient_RoundTrip(t *testing.T) {
+	script := "bg linear(90deg, #000000ff 0, #00aa00ff 1)\n" +
+		"bgrect 0.25 0.25 0.75 0.75 radial(0.5 0.5, 0.5, #ffffffff 0, #ff000080 1) src\n" +
+		"circle 0.1 0.1 0.05 linear(180deg, #ffffffff 0, #0000ffff 1)\n" +
+		"figure 0.5 0.5 linear(0deg, #ff0000ff 0, #0000ffff 1)\n" +
+		"text @1 \"cross\" color=linear(90deg, #ff0000ff 0, #0000ffff 1)\n"
+
+	as := checkRoundTrip(t, script)
+	for _, script := range []string{
+		"bg linear(-1000000deg, #00000000 0, #ffffffff 0, #ffffffff 1)\n",
+		"bg radial(-4 4, 0.000001, #ff0000ff 0, #0000ffff 0.25, #00ff00ff 1)\n",
+	} {
+		checkRoundTrip(t, script)
+	}
+
+	img := (&Canvas{Artboard: as}).Snapshot()
+	size := painter.DefaultCanvasSize
+	if got := img.RGBAAt(0, 0); got != (color.RGBA{A: 255}) {
+		t.Errorf("top left pixel is %v, want black", got)
+	}
+	if got := img.RGBAAt(size.X-1, 0); got.G < 0xa8 || got.R != 0 || got.B != 0 {
+		t.Errorf("top right pixel is %v, want green", got)
+	}
+	if got := img.RGBAAt(size.X/2, size.Y/2); got.R < 127 || got.R > 129 || got.B < 126 || got.B > 128 || got.G != 0 {
+		t.Errorf("pixel at the center of the figure is %v, want purple", got)
+	}
+
+}
+
+func TestArtboardState_BackgroundFill(t *testing.T) {
+	as := NewArtboardState()
+	if _, err := NewCommandProcessor(as).ProcessCommands(bytes.NewBufferString("bg #102030")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := as.MarshalScript(); string(got) != "bg #102030ff\n" {
+		t.Errorf("MarshalScript() = %q", got)
+	}
+	as.ConfigureBackground(color.Black)
+	if as.BackgroundGradient != nil {
+		t.Error("ConfigureBackground kept the gradient")
+	}
+	as.ConfigureBackgroundGradient(&painter.LinearGradient{})
+	if as.Background != nil {
+		t.Error("ConfigureBackgroundGradient kept the color")
+	}
+}
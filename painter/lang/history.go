@@ -0,0 +1,141 @@
+package lang
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+const (
+	defaultHistoryLimit = 100
+	journalLimit        = 1000
+)
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// History journals the scripts applied by a CommandProcessor and keeps the artboard states before them,
+// so that the scripts can be undone and redone. Undo restores a whole state, so it also reverts changes made
+// to the artboard without the processor since the script was applied.
+type History struct {
+	// Limit is the number of scripts that can be undone, 100 if zero.
+	Limit int
+
+	mu      sync.Mutex
+	undo    []*ArtboardState
+	redo    []*ArtboardState
+	gesture string
+	journal []string
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+// Journal returns the most recently applied scripts, oldest first.
+func (h *History) Journal() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string(nil), h.journal...)
+}
+
+// Last returns the most recently applied script, or an empty string if there is none.
+func (h *History) Last() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.journal) == 0 {
+		return ""
+	}
+	return h.journal[len(h.journal)-1]
+}
+
+// record adds a script applied to the before state. Scripts of the same non-empty gesture that follow each other
+// are undone together.
+func (h *History) record(script string, before *ArtboardState, gesture string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.journal = append(h.journal, script)
+	if len(h.journal) > journalLimit {
+		h.journal = h.journal[len(h.journal)-journalLimit:]
+	}
+
+	h.redo = nil
+	if gesture != "" && gesture == h.gesture && len(h.undo) > 0 {
+		return
+	}
+	h.gesture = gesture
+
+	limit := h.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	h.undo = append(h.undo, before)
+	if len(h.undo) > limit {
+		h.undo = h.undo[len(h.undo)-limit:]
+	}
+}
+
+// step replaces current with the last state of the from stack and saves current on the to stack.
+func (h *History) step(current *ArtboardState, redo bool) (*ArtboardState, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from, to, err := &h.undo, &h.redo, ErrNothingToUndo
+	if redo {
+		from, to, err = &h.redo, &h.undo, ErrNothingToRedo
+	}
+	if len(*from) == 0 {
+		return nil, err
+	}
+
+	target := (*from)[len(*from)-1]
+	*from = (*from)[:len(*from)-1]
+	*to = append(*to, current)
+	h.gesture = ""
+	return target, nil
+}
+
+// Undo reverts the artboard to the state before the last script recorded in the history and enqueues the operations
+// that redraw it.
+func (cp *CommandProcessor) Undo(loop *painter.EventLoop) error {
+	return cp.travel(loop, false)
+}
+
+// Redo applies the last undone script again.
+func (cp *CommandProcessor) Redo(loop *painter.EventLoop) error {
+	return cp.travel(loop, true)
+}
+
+func (cp *CommandProcessor) travel(loop *painter.EventLoop, redo bool) error {
+	if cp.History == nil {
+		if redo {
+			return ErrNothingToRedo
+		}
+		return ErrNothingToUndo
+	}
+
+	_, err := cp.Artboard.Update(loop, func(tx *ArtboardState) ([]painter.TextureOperation, error) {
+		target, err := cp.History.step(tx.clone(), redo)
+		if err != nil {
+			return nil, err
+		}
+		return tx.restore(target), nil
+	})
+	return err
+}
+
+// restore makes the artboard a copy of the snapshot and returns the operations that redraw it.
+func (as *ArtboardState) restore(snapshot *ArtboardState) []painter.TextureOperation {
+	var ops []painter.TextureOperation
+	if size := snapshot.canvasSize(); size != as.canvasSize() {
+		ops = append(ops, painter.Resize{Size: size})
+	}
+	as.replace(snapshot)
+	return append(ops, as.RefreshArtboard()...)
+}
@@ -0,0 +1,75 @@
+package lang
+
+import (
+	"errors"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestCommandProcessor_Undo(t *testing.T) {
+	processor := NewCommandProcessor(NewArtboardState())
+	processor.History = NewHistory()
+	run := func(script string) {
+		t.Helper()
+		if _, err := processor.ProcessCommands(strings.NewReader(script)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("white,figure 0.5 0.5")
+	run("resize 400 400")
+	if _, err := processor.ProcessCommands(strings.NewReader("move @7 0 0")); err == nil {
+		t.Fatal("expected an error for an unknown figure")
+	}
+
+	if err := processor.Undo(nil); err != nil {
+		t.Fatal(err)
+	}
+	as := processor.Artboard
+	if as.Size != (image.Point{}) || as.Shapes[0].CenterX != 400 {
+		t.Errorf("undo did not restore the size: %v, figure at %d", as.Size, as.Shapes[0].CenterX)
+	}
+
+	if err := processor.Undo(nil); err != nil {
+		t.Fatal(err)
+	}
+	if as.Background != nil || len(as.Shapes) != 0 {
+		t.Error("undo did not restore the initial state")
+	}
+	if err := processor.Undo(nil); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() = %v, want ErrNothingToUndo", err)
+	}
+
+	if err := processor.Redo(nil); err != nil || len(as.Shapes) != 1 {
+		t.Fatalf("redo failed: %v", err)
+	}
+	run("green")
+	if err := processor.Redo(nil); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo() after a new script = %v, want ErrNothingToRedo", err)
+	}
+
+	want := []string{"white,figure 0.5 0.5", "resize 400 400", "green"}
+	if got := processor.History.Journal(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("journal = %q, want %q", got, want)
+	}
+	if got := processor.History.Last(); got != "green" {
+		t.Errorf("Last() = %q", got)
+	}
+}
+
+func TestArtboardState_restore(t *testing.T) {
+	as := NewArtboardState()
+	snapshot := NewArtboardState()
+	snapshot.ResizeArtboard(image.Pt(100, 100))
+
+	ops := as.restore(snapshot)
+	if len(ops) == 0 || ops[0] != (painter.Resize{Size: image.Pt(100, 100)}) {
+		t.Errorf("restoring a state of another size does not resize the canvas: %v", ops)
+	}
+	if ops[len(ops)-1] != painter.MarkUpdated {
+		t.Error("restore does not redraw the artboard")
+	}
+}
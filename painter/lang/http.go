@@ -1,9 +1,10 @@
 package lang
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -19,20 +20,150 @@ func CommandHttpHandler(loop *painter.EventLoop, cp *CommandProcessor) http.Hand
 			input = strings.NewReader(r.URL.Query().Get("cmd"))
 		}
 
-		fmt.Println("http request:", r)
+		slog.Debug("http request", "method", r.Method, "url", r.URL)
 
-		fmt.Println("r.Body:", r.Body)
+		// The whole request is applied and enqueued as one unit.
+		if _, err := cp.ExecuteCommands(input, loop); err != nil {
+			slog.Warn("Error processing script", "err", err)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+	})
+}
+
+// StateScriptHandler serves the current artboard state as a script in the command language.
+func StateScriptHandler(as *ArtboardState) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
 
-		operations, err := cp.ProcessCommands(input)
+		script, err := as.MarshalScript()
 		if err != nil {
-			log.Printf("Error processing script: %s", err)
-			rw.WriteHeader(http.StatusBadRequest)
+			slog.Error("Error marshaling state", "err", err)
+			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		for _, op := range operations {
-			loop.Enqueue(op) // Enqueue each operation individually
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = rw.Write(script)
+	})
+}
+
+// StateHandler exposes the artboard as a JSON resource. GET returns the state, PUT replaces it and PATCH applies
+// a JSON Merge Patch. Every successful write enqueues a refresh of the artboard into the loop.
+func StateHandler(loop *painter.EventLoop, as *ArtboardState) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var state []byte
+
+		switch r.Method {
+		case http.MethodGet:
+			var err error
+			if state, err = json.Marshal(as); err != nil {
+				slog.Error("Error marshaling state", "err", err)
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		case http.MethodPut, http.MethodPatch:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			_, err = as.Update(loop, func(tx *ArtboardState) ([]painter.TextureOperation, error) {
+				if r.Method == http.MethodPut {
+					err = tx.UnmarshalJSON(body)
+				} else {
+					err = tx.MergePatch(body)
+				}
+				if err != nil {
+					return nil, err
+				}
+				state, err = json.Marshal(tx)
+				return tx.RefreshArtboard(), err
+			})
+			if err != nil {
+				slog.Warn("Error updating state", "err", err)
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		default:
+			rw.Header().Set("Allow", "GET, PUT, PATCH")
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
 		}
-		rw.WriteHeader(http.StatusOK)
+
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write(state)
+	})
+}
+
+// CanvasHttpHandler serves the canvas management endpoints and routes /canvas/{name}/... to the endpoints of
+// the named canvas.
+func CanvasHttpHandler(cm *CanvasManager) http.Handler {
+	type canvasJSON struct {
+		Name      string `json:"name"`
+		Displayed bool   `json:"displayed"`
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /canvas", func(rw http.ResponseWriter, r *http.Request) {
+		displayed := cm.Displayed()
+		list := []canvasJSON{}
+		for _, name := range cm.Names() {
+			list = append(list, canvasJSON{Name: name, Displayed: name == displayed})
+		}
+		writeJSON(rw, http.StatusOK, list)
+	})
+	mux.HandleFunc("POST /canvas", func(rw http.ResponseWriter, r *http.Request) {
+		var body canvasJSON
+		if !decodeBody(rw, r, &body) {
+			return
+		}
+		c, err := cm.Create(body.Name)
+		if err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		rw.Header().Set("Location", "/canvas/"+c.Name+"/")
+		writeJSON(rw, http.StatusCreated, canvasJSON{Name: c.Name})
+	})
+	mux.HandleFunc("DELETE /canvas/{name}", func(rw http.ResponseWriter, r *http.Request) {
+		if err := cm.Delete(r.PathValue("name")); err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /canvas/{name}/display", func(rw http.ResponseWriter, r *http.Request) {
+		if err := cm.Display(r.PathValue("name")); err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
 	})
+	mux.HandleFunc("/canvas/{name}/", func(rw http.ResponseWriter, r *http.Request) {
+		c, err := cm.Get(r.PathValue("name"))
+		if err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		http.StripPrefix("/canvas/"+c.Name, c.Handler()).ServeHTTP(rw, r)
+	})
+	return mux
+}
+
+func writeCanvasError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrCanvasNotFound):
+		writeError(rw, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrCanvasExists), errors.Is(err, ErrCanvasInUse):
+		writeError(rw, http.StatusConflict, err.Error())
+	default:
+		writeError(rw, http.StatusBadRequest, err.Error())
+	}
 }
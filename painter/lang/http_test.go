@@ -0,0 +1,161 @@
+package lang
+
+import (
+	"fmt"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/exp/shiny/screen"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// These tests are meant to be run with the race detector: go test -race ./painter/lang
+
+func TestCommandHttpHandler_Concurrent(t *testing.T) {
+	const clients, requests = 8, 25
+
+	var receiver frameReceiver
+	loop := &painter.EventLoop{Receiver: &receiver}
+	loop.Initiate(testScreen{})
+
+	as := NewArtboardState()
+	handler := CommandHttpHandler(loop, NewCommandProcessor(as))
+
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				script := "move 0.01 0.01,update"
+				if i == 0 {
+					script = fmt.Sprintf("figure 0.%d 0.%d,update", c+1, c+1)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?cmd="+url.QueryEscape(script), nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("unexpected status %d", rec.Code)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	loop.Terminate()
+
+	if len(as.Shapes) != clients {
+		t.Fatalf("got %d shapes, want %d", len(as.Shapes), clients)
+	}
+	if frames := receiver.count(); frames != clients*requests {
+		t.Errorf("got %d frames, want %d", frames, clients*requests)
+	}
+	// Refresh operations are enqueued in the order the updates were applied, so the last frame
+	// must show the final state.
+	if got, want := receiver.last(), render(as); !reflect.DeepEqual(got, want) {
+		t.Errorf("last frame does not match the final state:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestResourceHandler_Concurrent(t *testing.T) {
+	const clients = 8
+
+	var receiver frameReceiver
+	loop := &painter.EventLoop{Receiver: &receiver}
+	loop.Initiate(testScreen{})
+
+	as := NewArtboardState()
+	commands := CommandHttpHandler(loop, NewCommandProcessor(as))
+	resources := ResourceHandler(loop, as)
+	state := StateHandler(loop, as)
+
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				resources.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/shapes", strings.NewReader(`{"x":0.5,"y":0.5}`)))
+				resources.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/shapes/1", strings.NewReader(`{"x":0.25}`)))
+				commands.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?cmd=move+0.01+0,update", nil))
+				state.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/state", nil))
+				resources.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/shapes", nil))
+			}
+		}()
+	}
+	wg.Wait()
+	loop.Terminate()
+
+	if len(as.Shapes) != clients*10 {
+		t.Errorf("got %d shapes, want %d", len(as.Shapes), clients*10)
+	}
+	if got, want := receiver.last(), render(as); !reflect.DeepEqual(got, want) {
+		t.Errorf("last frame does not match the final state")
+	}
+}
+
+func TestCommandHttpHandler_Transactional(t *testing.T) {
+	var loop painter.EventLoop
+	as := NewArtboardState()
+	handler := CommandHttpHandler(&loop, NewCommandProcessor(as))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("figure 0.5 0.5\nupdate\nmove 0.1")))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status %d", rec.Code)
+	}
+	if len(as.Shapes) != 0 {
+		t.Error("a failed script modified the artboard")
+	}
+}
+
+// frameReceiver records the fills of every presented frame.
+type frameReceiver struct {
+	mu     sync.Mutex
+	frames [][]fillCall
+}
+
+func (fr *frameReceiver) UpdateTexture(t screen.Texture, release func()) {
+	tx := t.(*recordingTexture)
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.frames = append(fr.frames, tx.fills)
+	tx.fills = nil
+	release()
+}
+
+func (fr *frameReceiver) count() int {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return len(fr.frames)
+}
+
+func (fr *frameReceiver) last() []fillCall {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if len(fr.frames) == 0 {
+		return nil
+	}
+	return fr.frames[len(fr.frames)-1]
+}
+
+type testScreen struct{}
+
+func (testScreen) NewBuffer(image.Point) (screen.Buffer, error) {
+	panic("implement me")
+}
+
+func (testScreen) NewTexture(image.Point) (screen.Texture, error) {
+	return new(recordingTexture), nil
+}
+
+func (testScreen) NewWindow(*screen.NewWindowOptions) (screen.Window, error) {
+	panic("implement me")
+}
@@ -0,0 +1,525 @@
+package lang
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// stateJSON is the wire format of ArtboardState. Coordinates use the same normalized scale as the command language.
+type stateJSON struct {
+	Background *string         `json:"background"`
+	Rectangle  *rectangleJSON  `json:"rectangle"`
+	Shapes     []shapeJSON     `json:"shapes"`
+	Primitives []primitiveJSON `json:"primitives,omitempty"`
+}
+
+type rectangleJSON struct {
+	X1    float64 `json:"x1"`
+	Y1    float64 `json:"y1"`
+	X2    float64 `json:"x2"`
+	Y2    float64 `json:"y2"`
+	Color string  `json:"color"`
+
+	// Composite is the composite mode, "over" if empty.
+	Composite string `json:"composite,omitempty"`
+
+	Clip []clipJSON `json:"clip,omitempty"`
+}
+
+// shapeJSON is the wire format of a figure. Its size and stroke width are in pixels, like in the figure command.
+type shapeJSON struct {
+	ID        int     `json:"id"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Kind      string  `json:"kind,omitempty"`
+	Size      int     `json:"size,omitempty"`
+	Rotation  float64 `json:"rotation,omitempty"`
+	Color     string  `json:"color,omitempty"`
+	Stroke    string  `json:"stroke,omitempty"`
+	Width     float64 `json:"width,omitempty"`
+	Composite string  `json:"composite,omitempty"`
+
+	// Transform is the affine transform a, b, c, d, e, f around the center, with a normalized translation.
+	Transform *[6]float64 `json:"transform,omitempty"`
+
+	Label *labelJSON `json:"label,omitempty"`
+	// Clip lists the regions the figure is drawn in; it is drawn where they overlap.
+	Clip []clipJSON `json:"clip,omitempty"`
+}
+
+// labelJSON is the wire format of the Label of a figure; text primitives carry the same fields themselves.
+type labelJSON struct {
+	Text      string  `json:"text"`
+	Size      float64 `json:"size,omitempty"`
+	Align     string  `json:"align,omitempty"`
+	Font      string  `json:"font,omitempty"`
+	Color     string  `json:"color,omitempty"`
+	Composite string  `json:"composite,omitempty"`
+}
+
+// primitiveJSON is the wire format of a Primitive. Radii are normalized like coordinates; angles are in degrees.
+// Paths have data, fill, stroke and rule instead of points and color; texts add the fields of their label and
+// images the name of their asset.
+type primitiveJSON struct {
+	Kind      string       `json:"kind"`
+	Points    [][2]float64 `json:"points,omitempty"`
+	Radii     *[2]float64  `json:"radii,omitempty"`
+	Angles    *[2]float64  `json:"angles,omitempty"`
+	Width     float64      `json:"width,omitempty"`
+	Color     string       `json:"color,omitempty"`
+	Composite string       `json:"composite,omitempty"`
+	Data      string       `json:"data,omitempty"`
+	Fill      string       `json:"fill,omitempty"`
+	Stroke    string       `json:"stroke,omitempty"`
+	Rule      string       `json:"rule,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Size      float64      `json:"size,omitempty"`
+	Align     string       `json:"align,omitempty"`
+	Font      string       `json:"font,omitempty"`
+	Asset     string       `json:"asset,omitempty"`
+
+	// Transform is the affine transform a, b, c, d, e, f of the primitive, with a normalized translation.
+	Transform *[6]float64 `json:"transform,omitempty"`
+
+	Clip []clipJSON `json:"clip,omitempty"`
+}
+
+func (as *ArtboardState) MarshalJSON() ([]byte, error) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	state := stateJSON{Shapes: []shapeJSON{}}
+	size := as.canvasSize()
+
+	if as.Background != nil || as.BackgroundGradient != nil {
+		bg := formatFill(as.Background, as.BackgroundGradient)
+		state.Background = &bg
+	}
+
+	if r := as.Rectangle; r != nil {
+		state.Rectangle = &rectangleJSON{
+			X1:        normalize(r.Bounds.Min.X, size.X),
+			Y1:        normalize(r.Bounds.Min.Y, size.Y),
+			X2:        normalize(r.Bounds.Max.X, size.X),
+			Y2:        normalize(r.Bounds.Max.Y, size.Y),
+			Color:     formatFill(r.Color, r.Gradient),
+			Composite: formatCompositeMode(r.Op),
+			Clip:      clipResources(r.Clips, size),
+		}
+	}
+
+	for _, fig := range as.Shapes {
+		state.Shapes = append(state.Shapes, shapeResource(fig, size))
+	}
+
+	for _, p := range as.Primitives {
+		state.Primitives = append(state.Primitives, primitiveResource(p, size))
+	}
+
+	return json.Marshal(state)
+}
+
+// UnmarshalJSON replaces the whole artboard with the decoded state. The artboard is left untouched on error.
+func (as *ArtboardState) UnmarshalJSON(data []byte) error {
+	var state stateJSON
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	as.mu.RLock()
+	next := &ArtboardState{Size: as.Size}
+	as.mu.RUnlock()
+	size := next.canvasSize()
+
+	if state.Background != nil {
+		c, g, err := parseFill(*state.Background)
+		if err != nil {
+			return err
+		}
+		next.configureBackgroundFill(c, g)
+	}
+
+	if r := state.Rectangle; r != nil {
+		c, g, err := parseFill(r.Color)
+		if err != nil {
+			return err
+		}
+		op, err := parseCompositeMode(r.Composite)
+		if err != nil {
+			return err
+		}
+		if err := checkCoordinates(r.X1, r.Y1, r.X2, r.Y2); err != nil {
+			return err
+		}
+		next.DefineRectangle(image.Rect(denormalize(r.X1, size.X), denormalize(r.Y1, size.Y), denormalize(r.X2, size.X), denormalize(r.Y2, size.Y)), c)
+		next.Rectangle.Op = op
+		next.Rectangle.Gradient = g
+		if next.Rectangle.Clips, err = parseClipsJSON(r.Clip, size); err != nil {
+			return err
+		}
+	}
+
+	ids := make(map[int]bool)
+	for _, s := range state.Shapes {
+		if s.ID < 0 || ids[s.ID] {
+			return fmt.Errorf("invalid shape id %d", s.ID)
+		}
+		if s.ID != 0 {
+			ids[s.ID] = true
+			next.lastID = max(next.lastID, s.ID)
+		}
+	}
+	for _, s := range state.Shapes {
+		if err := checkCoordinates(s.X, s.Y); err != nil {
+			return err
+		}
+		shape := &painter.BasicShape{CenterX: denormalize(s.X, size.X), CenterY: denormalize(s.Y, size.Y)}
+		patch := shapePatchJSON{Kind: &s.Kind, Size: &s.Size, Rotation: &s.Rotation, Color: &s.Color, Stroke: &s.Stroke, Width: &s.Width, Composite: &s.Composite, Transform: s.Transform}
+		if err := styleShape(shape, patch, size); err != nil {
+			return err
+		}
+		var label *Label
+		if s.Label != nil {
+			var err error
+			if label, err = parseLabelJSON(*s.Label, painter.AlignCenter); err != nil {
+				return err
+			}
+		}
+		clips, err := parseClipsJSON(s.Clip, size)
+		if err != nil {
+			return err
+		}
+		if s.ID == 0 {
+			fig := next.FindShape(next.PlaceShape(shape))
+			fig.Label, fig.Clips = label, clips
+		} else {
+			next.Shapes = append(next.Shapes, &Figure{ID: s.ID, BasicShape: shape, Label: label, Clips: clips})
+		}
+	}
+
+	for _, pj := range state.Primitives {
+		p, err := parsePrimitiveJSON(pj, size)
+		if err != nil {
+			return err
+		}
+		next.DrawPrimitive(p)
+	}
+
+	as.Replace(next)
+	return nil
+}
+
+func primitiveResource(p *Primitive, size image.Point) primitiveJSON {
+	pj := primitiveFields(p, size)
+	pj.Clip = clipResources(p.Clips, size)
+	if !p.Transform.IsIdentity() {
+		m := affineValues(p.Transform, size)
+		pj.Transform = &m
+	}
+	return pj
+}
+
+func primitiveFields(p *Primitive, size image.Point) primitiveJSON {
+	if path := p.Path; p.Kind == "path" {
+		pj := primitiveJSON{Kind: p.Kind, Data: path.Data, Width: path.Width, Rule: formatFillRule(path.Rule), Composite: formatCompositeMode(path.Op)}
+		if path.Fill != nil {
+			pj.Fill = formatColor(path.Fill)
+		}
+		if path.Stroke != nil {
+			pj.Stroke = formatColor(path.Stroke)
+		}
+		return pj
+	}
+
+	pj := primitiveJSON{Kind: p.Kind, Width: p.Paint.Width, Composite: formatCompositeMode(p.Paint.Op)}
+	for _, pt := range p.Points {
+		pj.Points = append(pj.Points, [2]float64{normalize(pt.X, size.X), normalize(pt.Y, size.Y)})
+	}
+	if p.Kind == "text" {
+		lj := labelResource(p.Label)
+		pj.Text, pj.Size, pj.Align, pj.Font, pj.Color, pj.Composite = lj.Text, lj.Size, lj.Align, lj.Font, lj.Color, lj.Composite
+		return pj
+	}
+	if p.Kind == "blit" {
+		pj.Asset = p.Asset
+		return pj
+	}
+	if p.Kind != "line" && p.Kind != "poly" {
+		pj.Radii = &[2]float64{normalize(p.Radii.X, size.X), normalize(p.Radii.Y, size.Y)}
+	}
+	if p.Kind == "arc" {
+		angles := p.Angles
+		pj.Angles = &angles
+	}
+	if p.Paint.Color != nil || p.Paint.Gradient != nil {
+		pj.Color = formatFill(p.Paint.Color, p.Paint.Gradient)
+	}
+	return pj
+}
+
+func parsePrimitiveJSON(pj primitiveJSON, size image.Point) (*Primitive, error) {
+	p, err := parsePrimitiveFields(pj, size)
+	if err != nil {
+		return nil, err
+	}
+	if p.Clips, err = parseClipsJSON(pj.Clip, size); err != nil {
+		return nil, err
+	}
+	if pj.Transform == nil {
+		return p, nil
+	}
+	if p.Transform, err = newAffine(*pj.Transform, size); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parsePrimitiveFields(pj primitiveJSON, size image.Point) (*Primitive, error) {
+	if pj.Kind == "path" {
+		return parsePathJSON(pj)
+	}
+
+	p := &Primitive{Kind: pj.Kind, Paint: painter.Paint{Width: pj.Width}}
+	for _, pt := range pj.Points {
+		if err := checkCoordinates(pt[0], pt[1]); err != nil {
+			return nil, err
+		}
+		p.Points = append(p.Points, image.Pt(denormalize(pt[0], size.X), denormalize(pt[1], size.Y)))
+	}
+	if pj.Kind == "blit" {
+		p.Asset = pj.Asset
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if pj.Kind == "text" {
+		label, err := parseLabelJSON(labelJSON{Text: pj.Text, Size: pj.Size, Align: pj.Align, Font: pj.Font, Color: pj.Color, Composite: pj.Composite}, painter.AlignLeft)
+		if err != nil {
+			return nil, err
+		}
+		p.Label = label
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if pj.Radii != nil {
+		if err := checkCoordinates(pj.Radii[0], pj.Radii[1]); err != nil {
+			return nil, err
+		}
+		p.Radii = image.Pt(denormalize(pj.Radii[0], size.X), denormalize(pj.Radii[1], size.Y))
+	}
+	if pj.Angles != nil {
+		p.Angles = *pj.Angles
+	}
+	if pj.Color != "" {
+		c, g, err := parseFill(pj.Color)
+		if err != nil {
+			return nil, err
+		}
+		p.Paint.Color, p.Paint.Gradient = c, g
+	}
+	op, err := parseCompositeMode(pj.Composite)
+	if err != nil {
+		return nil, err
+	}
+	p.Paint.Op = op
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) document to the artboard. The artboard is left untouched on error.
+// The read and the write are not atomic; run it inside Update when the state is shared.
+func (as *ArtboardState) MergePatch(patch []byte) error {
+	current, err := json.Marshal(as)
+	if err != nil {
+		return err
+	}
+
+	var target, p any
+	if err := json.Unmarshal(current, &target); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return err
+	}
+	if _, ok := p.(map[string]any); !ok {
+		return errors.New("state patch must be a JSON object")
+	}
+
+	merged, err := json.Marshal(mergePatch(target, p))
+	if err != nil {
+		return err
+	}
+	return as.UnmarshalJSON(merged)
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7386 section 2.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+		} else {
+			t[name] = mergePatch(t[name], value)
+		}
+	}
+	return t
+}
+
+func parsePathJSON(pj primitiveJSON) (*Primitive, error) {
+	path, err := NewPath(pj.Data)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range []struct {
+		value string
+		dst   *color.Color
+	}{{pj.Fill, &path.Fill}, {pj.Stroke, &path.Stroke}} {
+		if c.value == "" {
+			continue
+		}
+		if *c.dst, err = parseColor(c.value); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkWidth(pj.Width); err != nil {
+		return nil, err
+	}
+	path.Width = pj.Width
+	if path.Rule, err = parseFillRule(pj.Rule); err != nil {
+		return nil, err
+	}
+	if path.Op, err = parseCompositeMode(pj.Composite); err != nil {
+		return nil, err
+	}
+	return &Primitive{Kind: "path", Path: path}, nil
+}
+
+func labelResource(l *Label) labelJSON {
+	lj := labelJSON{Text: l.Text, Size: l.Size, Align: formatAlign(l.Align), Font: l.Font, Composite: formatCompositeMode(l.Op)}
+	if l.Color != nil || l.Gradient != nil {
+		lj.Color = formatFill(l.Color, l.Gradient)
+	}
+	return lj
+}
+
+// parseLabelJSON decodes a label; align is the alignment of labels that have none.
+func parseLabelJSON(lj labelJSON, align painter.Align) (*Label, error) {
+	l := &Label{Text: lj.Text, Align: align, Font: lj.Font}
+	if lj.Size < 0 || lj.Size > maxTextSize {
+		return nil, fmt.Errorf("size %v must be a number from 0 to %d", lj.Size, maxTextSize)
+	}
+	l.Size = lj.Size
+	var err error
+	if lj.Align != "" {
+		if l.Align, err = parseAlign(lj.Align); err != nil {
+			return nil, err
+		}
+	}
+	if lj.Font != "" && lookupFont(lj.Font) == nil {
+		return nil, fmt.Errorf("font %q is not registered", lj.Font)
+	}
+	if lj.Color != "" {
+		if l.Color, l.Gradient, err = parseFill(lj.Color); err != nil {
+			return nil, err
+		}
+	}
+	if l.Op, err = parseCompositeMode(lj.Composite); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// styleShape sets the kind, the size, the rotation, the fill, the stroke, the composite mode and the transform of
+// the shape from their JSON representations. Nil fields leave the shape unchanged; empty ones reset it to the
+// default.
+func styleShape(shape *painter.BasicShape, patch shapePatchJSON, size image.Point) error {
+	var err error
+	if patch.Kind != nil {
+		shape.Kind = painter.Cross
+		if *patch.Kind != "" {
+			if shape.Kind, err = parseShapeKind(*patch.Kind); err != nil {
+				return err
+			}
+		}
+	}
+	if patch.Size != nil {
+		if *patch.Size < 0 || *patch.Size > MaxCanvasDimension {
+			return fmt.Errorf("invalid size %d", *patch.Size)
+		}
+		shape.Size = *patch.Size
+	}
+	if patch.Rotation != nil {
+		if math.IsNaN(*patch.Rotation) || math.IsInf(*patch.Rotation, 0) {
+			return fmt.Errorf("invalid rotation %v", *patch.Rotation)
+		}
+		shape.Rotation = *patch.Rotation
+	}
+	if patch.Color != nil {
+		shape.Color, shape.Gradient = nil, nil
+		if *patch.Color != "" {
+			if shape.Color, shape.Gradient, err = parseFill(*patch.Color); err != nil {
+				return err
+			}
+		}
+	}
+	if patch.Stroke != nil {
+		shape.Stroke = nil
+		if *patch.Stroke != "" {
+			if shape.Stroke, err = parseColor(*patch.Stroke); err != nil {
+				return err
+			}
+		}
+	}
+	if patch.Width != nil {
+		if err := checkWidth(*patch.Width); err != nil {
+			return err
+		}
+		shape.StrokeWidth = *patch.Width
+	}
+	if patch.Composite != nil {
+		if shape.Op, err = parseCompositeMode(*patch.Composite); err != nil {
+			return err
+		}
+	}
+	if patch.Transform != nil {
+		if shape.Transform, err = newAffine(*patch.Transform, size); err != nil {
+			return err
+		}
+		if err := checkBounds(shape.Bounds(), size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize converts a pixel coordinate along a canvas axis of the given extent into the normalized scale.
+func normalize(px, extent int) float64 {
+	return float64(px) / float64(extent)
+}
+
+// denormalize converts a normalized coordinate along a canvas axis of the given extent into pixels.
+func denormalize(v float64, extent int) int {
+	return int(math.Round(v * float64(extent)))
+}
@@ -0,0 +1,93 @@
+package lang
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestArtboardState_JSON(t *testing.T) {
+	as := NewArtboardState()
+	as.ConfigureBackground(greenColor)
+	as.DefineRectangle(image.Rect(40, 40, 760, 760), rectangleColor)
+	as.PlaceShape(&painter.BasicShape{CenterX: 400, CenterY: 80})
+
+	data, err := json.Marshal(as)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"background":"#008000ff","rectangle":{"x1":0.05,"y1":0.05,"x2":0.95,"y2":0.95,"color":"#ff0000ff"},"shapes":[{"id":1,"x":0.5,"y":0.1}]}`
+	if string(data) != want {
+		t.Errorf("MarshalJSON() got = %s, want %s", data, want)
+	}
+
+	decoded := NewArtboardState()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if id := decoded.PlaceShape(&painter.BasicShape{}); id != 2 {
+		t.Errorf("PlaceShape() after decoding assigned id %d, want 2", id)
+	}
+
+	styled := `{"background":null,"rectangle":{"x1":0,"y1":0,"x2":0.5,"y2":0.5,"color":"#ffff0040","composite":"src"},"shapes":[{"id":1,"x":0.5,"y":0.1,"color":"#00ff0080"}]}`
+	if err := json.Unmarshal([]byte(styled), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(decoded); string(data) != styled {
+		t.Errorf("styled state round trip got = %s, want %s", data, styled)
+	}
+}
+
+func TestArtboardState_UnmarshalJSON_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Malformed JSON", input: `{"background":`},
+		{name: "Invalid color", input: `{"background":"green"}`},
+		{name: "Duplicate ids", input: `{"shapes":[{"id":1},{"id":1}]}`},
+		{name: "Invalid composite mode", input: `{"shapes":[{"composite":"xor"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := NewArtboardState()
+			as.ConfigureBackground(greenColor)
+
+			if err := json.Unmarshal([]byte(tt.input), as); err == nil {
+				t.Error("UnmarshalJSON() expected an error")
+			}
+			if !sameColor(as.Background, greenColor) {
+				t.Error("UnmarshalJSON() modified the state on error")
+			}
+		})
+	}
+}
+
+func TestArtboardState_MergePatch(t *testing.T) {
+	as := NewArtboardState()
+	as.ConfigureBackground(greenColor)
+	as.DefineRectangle(image.Rect(40, 40, 760, 760), rectangleColor)
+	as.PlaceShape(&painter.BasicShape{CenterX: 400, CenterY: 80})
+
+	if err := as.MergePatch([]byte(`{"background":null,"rectangle":{"x2":0.5}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if as.Background != nil {
+		t.Error("background was not removed by null")
+	}
+	if want := image.Rect(40, 40, 400, 760); as.Rectangle.Bounds != want {
+		t.Errorf("rectangle bounds got = %v, want %v", as.Rectangle.Bounds, want)
+	}
+	if len(as.Shapes) != 1 || as.Shapes[0].ID != 1 {
+		t.Error("shapes were modified by a patch that does not mention them")
+	}
+
+	if err := as.MergePatch([]byte(`[]`)); err == nil {
+		t.Error("MergePatch() expected an error for a non-object patch")
+	}
+}
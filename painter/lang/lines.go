@@ -0,0 +1,198 @@
+package lang
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+const (
+	defaultLineIdleTimeout  = 5 * time.Minute
+	defaultLineWriteTimeout = 10 * time.Second
+	defaultMaxLineLength    = 4096
+	lineFrameTimeout        = 5 * time.Second
+)
+
+// LineServer serves the command language over stream connections such as TCP or Unix sockets, so painter can be
+// driven with tools like nc. Every line is a script applied and enqueued as one unit, like a CommandHttpHandler
+// request. The server answers each line with "OK <frame>", where frame is the number of the frame at which the line
+// became visible (or the last presented frame if the line did not produce one), or with "ERR <line>:<col> <msg>".
+type LineServer struct {
+	Loop      *painter.EventLoop
+	Processor *CommandProcessor
+
+	IdleTimeout   time.Duration // Connections without input for this long are closed; defaults to 5 minutes
+	WriteTimeout  time.Duration // Connections that do not take a reply for this long are closed; defaults to 10 seconds
+	MaxLineLength int           // Longer lines are rejected; defaults to 4096 bytes
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// ErrLineServerClosed is returned by Serve after Close.
+var ErrLineServerClosed = errors.New("line server closed")
+
+// Serve accepts connections on l and handles each of them on its own goroutine until Close is called.
+func (s *LineServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrLineServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrLineServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrLineServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops the listeners, closes active connections and waits for their handlers to return.
+func (s *LineServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *LineServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	idle := s.IdleTimeout
+	if idle <= 0 {
+		idle = defaultLineIdleTimeout
+	}
+	maxLength := s.MaxLineLength
+	if maxLength <= 0 {
+		maxLength = defaultMaxLineLength
+	}
+	writeTimeout := s.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = defaultLineWriteTimeout
+	}
+
+	// The buffer holds a full line together with its line ending.
+	r := bufio.NewReaderSize(conn, maxLength+2)
+	w := bufio.NewWriter(conn)
+	// A client that stops reading must not block the handler, and with it Close, forever.
+	flush := func() error {
+		_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return w.Flush()
+	}
+
+	for lineNumber := 1; ; lineNumber++ {
+		_ = conn.SetReadDeadline(time.Now().Add(idle))
+
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) || len(bytes.TrimRight(line, "\r\n")) > maxLength {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				err = discardLine(r)
+			}
+			fmt.Fprintf(w, "ERR %d:%d line is longer than %d bytes\n", lineNumber, maxLength+1, maxLength)
+			if err != nil || flush() != nil {
+				return
+			}
+			continue
+		}
+		if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				fmt.Fprintln(w, "ERR idle timeout")
+				_ = flush()
+			}
+			return
+		}
+
+		s.reply(w, lineNumber, bytes.TrimRight(line, "\r\n"))
+		if flush() != nil || err != nil {
+			return
+		}
+	}
+}
+
+func (s *LineServer) reply(w io.Writer, lineNumber int, line []byte) {
+	_, visible, err := s.Processor.SubmitCommands(bytes.NewReader(line), s.Loop)
+	if err != nil {
+		var se *ScriptError
+		if errors.As(err, &se) {
+			fmt.Fprintf(w, "ERR %d:%d %s\n", lineNumber, se.Column, se.Err)
+		} else {
+			fmt.Fprintf(w, "ERR %d:1 %s\n", lineNumber, err)
+		}
+		return
+	}
+
+	frame := s.Loop.Frame()
+	if visible != nil {
+		select {
+		case f, ok := <-visible:
+			if ok {
+				frame = f
+			} else {
+				frame = s.Loop.Frame()
+			}
+		case <-time.After(lineFrameTimeout):
+		}
+	}
+	fmt.Fprintf(w, "OK %d\n", frame)
+}
+
+// discardLine skips the rest of an overlong line.
+func discardLine(r *bufio.Reader) error {
+	for {
+		_, err := r.ReadSlice('\n')
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return err
+		}
+	}
+}
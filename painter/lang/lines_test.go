@@ -0,0 +1,94 @@
+package lang
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestLineServer(t *testing.T) {
+	var receiver frameReceiver
+	loop := &painter.EventLoop{Receiver: &receiver}
+	loop.Initiate(testScreen{})
+	defer loop.Terminate()
+
+	as := NewArtboardState()
+	server := &LineServer{Loop: loop, Processor: NewCommandProcessor(as), MaxLineLength: 32, IdleTimeout: 200 * time.Millisecond}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- server.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, _ = fmt.Fprint(conn, "white,figure 0.5 0.5,update\n"+
+		"green, move 0.1\n"+
+		"figure 0.1 0.1\r\n"+
+		strings.Repeat("x", 40)+"\n"+
+		"update\n")
+
+	r := bufio.NewReader(conn)
+	want := []string{"OK 1", "ERR 2:8 move command expects two arguments", "OK 1", "ERR 4:33 line is longer than 32 bytes", "OK 2"}
+	for _, w := range want {
+		got, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = strings.TrimSpace(got); got != w {
+			t.Errorf("got reply %q, want %q", got, w)
+		}
+	}
+
+	if len(as.Shapes) != 2 || as.Background == nil || sameColor(as.Background, greenColor) {
+		t.Error("failed line modified the artboard")
+	}
+
+	if got, _ := r.ReadString('\n'); strings.TrimSpace(got) != "ERR idle timeout" {
+		t.Errorf("got %q, want idle timeout", got)
+	}
+
+	_ = server.Close()
+	if err := <-done; err != ErrLineServerClosed {
+		t.Errorf("Serve() returned %v", err)
+	}
+}
+
+func TestLineServer_WriteTimeout(t *testing.T) {
+	var receiver frameReceiver
+	loop := &painter.EventLoop{Receiver: &receiver}
+	loop.Initiate(testScreen{})
+	defer loop.Terminate()
+
+	server := &LineServer{Loop: loop, Processor: NewCommandProcessor(NewArtboardState()), WriteTimeout: 50 * time.Millisecond}
+
+	// A pipe has no buffer, so the reply blocks until the client reads it.
+	client, conn := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		server.handle(conn)
+		close(done)
+	}()
+
+	_, _ = fmt.Fprint(client, "white\n")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler is blocked on a client that does not read")
+	}
+	if _, err := client.Read(make([]byte, 16)); err == nil {
+		t.Error("connection is still open after the write timeout")
+	}
+}
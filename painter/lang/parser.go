@@ -2,88 +2,165 @@ package lang
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"image"
 	"image/color"
+	"image/draw"
 	"io"
+	"log/slog"
+	"math"
 	"strconv"
 	"strings"
 
+	"golang.org/x/exp/shiny/screen"
+
 	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
+// MaxCanvasDimension limits the canvas size in pixels along each axis, as accepted by the resize command.
+const MaxCanvasDimension = 8192
+
 type CommandProcessor struct {
 	Artboard *ArtboardState
+
+	// History, if set, journals the applied scripts and allows to undo them.
+	History *History
+
+	// OnApply, if set, is called with every script that was applied successfully.
+	OnApply func(script string)
+
+	// OnError, if set, is called for every script that fails to parse or apply.
+	OnError func(err error)
 }
 
 func NewCommandProcessor(artboard *ArtboardState) *CommandProcessor {
 	return &CommandProcessor{Artboard: artboard}
 }
 
+// ProcessCommands parses the script and applies it to the artboard as a single transaction: if any command fails,
+// none of them take effect. It returns the operations produced by the update commands.
 func (cp *CommandProcessor) ProcessCommands(input io.Reader) ([]painter.TextureOperation, error) {
+	return cp.ExecuteCommands(input, nil)
+}
+
+// ExecuteCommands works like ProcessCommands and also enqueues the resulting operations into loop as one unit.
+func (cp *CommandProcessor) ExecuteCommands(input io.Reader, loop *painter.EventLoop) ([]painter.TextureOperation, error) {
+	ops, _, err := cp.execute(input, loop, false, false, "")
+	return ops, err
+}
+
+// ExecuteGesture works like ExecuteCommands for scripts generated by an interactive gesture such as a mouse drag.
+// The artboard is redrawn even if the script has no update command, so the edit shows right away. Consecutive
+// scripts of the same gesture are undone as one.
+func (cp *CommandProcessor) ExecuteGesture(input io.Reader, loop *painter.EventLoop, gesture string) ([]painter.TextureOperation, error) {
+	ops, _, err := cp.execute(input, loop, false, true, gesture)
+	return ops, err
+}
+
+// SubmitCommands works like ExecuteCommands and also reports the number of the frame at which the script became
+// visible. The returned channel receives the frame number once the last frame produced by the script is presented,
+// or is closed without a value if the script produces no frame.
+func (cp *CommandProcessor) SubmitCommands(input io.Reader, loop *painter.EventLoop) ([]painter.TextureOperation, <-chan uint64, error) {
+	return cp.execute(input, loop, true, false, "")
+}
+
+func (cp *CommandProcessor) execute(input io.Reader, loop *painter.EventLoop, track, redraw bool, gesture string) ([]painter.TextureOperation, <-chan uint64, error) {
+	script, err := io.ReadAll(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		ops     []painter.TextureOperation
+		visible chan uint64
+	)
+	_, err = cp.Artboard.Update(loop, func(tx *ArtboardState) ([]painter.TextureOperation, error) {
+		var before *ArtboardState
+		if cp.History != nil {
+			before = tx.clone()
+		}
+
+		var err error
+		if ops, err = applyCommands(tx, bytes.NewReader(script)); err != nil {
+			return nil, err
+		}
+		if redraw && ops == nil {
+			ops = tx.RefreshArtboard()
+		}
+		if cp.History != nil {
+			cp.History.record(string(script), before, gesture)
+		}
+		if !track || loop == nil {
+			return ops, nil
+		}
+
+		// Probes around the script ops compare frame counters to tell whether the script presented a frame.
+		visible = make(chan uint64, 1)
+		var start uint64
+		startProbe := painter.TextureFunc(func(screen.Texture) { start = loop.Frame() })
+		endProbe := painter.TextureFunc(func(screen.Texture) {
+			if frame := loop.Frame(); frame != start {
+				visible <- frame
+			}
+			close(visible)
+		})
+		return append(append([]painter.TextureOperation{startProbe}, ops...), endProbe), nil
+	})
+	if err != nil {
+		if cp.OnError != nil {
+			cp.OnError(err)
+		}
+		return nil, nil, err
+	}
+	if cp.OnApply != nil {
+		cp.OnApply(string(script))
+	}
+	return ops, visible, nil
+}
+
+// ScriptError reports the position of the command that made a script fail.
+type ScriptError struct {
+	Line   int // 1-based line number in the script
+	Column int // 1-based byte offset of the command in the line
+	Err    error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error { return e.Err }
+
+func applyCommands(artboard *ArtboardState, input io.Reader) ([]painter.TextureOperation, error) {
 	var textureOps []painter.TextureOperation
 
 	commandReader := bufio.NewScanner(input)
 
+	line := 0
 	for commandReader.Scan() {
-		commands := strings.Split(commandReader.Text(), ",")
-		if len(commands) == 0 {
-			continue
-		}
+		line++
+
+		offset := 0
+		for _, cmd := range splitCommands(commandReader.Text()) {
+			column := offset + len(cmd) - len(strings.TrimLeft(cmd, " \t")) + 1
+			offset += len(cmd) + 1
+
+			cmdParts, err := commandFields(cmd)
+			slog.Debug("command", "cmd", cmd)
+			if err != nil {
+				return nil, &ScriptError{Line: line, Column: column, Err: err}
+			}
+			if len(cmdParts) == 0 {
+				continue
+			}
 
-		for _, cmd := range commands {
-			cmdParts := strings.Fields(cmd)
-			fmt.Println("cmd", cmd)
-
-
-			switch cmdParts[0] {
-			case "white":
-				cp.Artboard.ConfigureBackground(painter.FillTexture(color.White))
-			case "green":
-				cp.Artboard.ConfigureBackground(painter.FillTexture(color.RGBA{R: 0, G: 128, B: 0, A: 255}))
-			case "bgrect":
-				if len(cmdParts) != 5 {
-					return nil, errors.New("bgrect command expects four arguments")
-				}
-
-				coords, err := convertToCoordinates(cmdParts[1:])
-				if err != nil {
-					return nil, err
-				}
-
-				cp.Artboard.DefineRectangle(painter.DrawRectangle(coords[0], coords[1], coords[2], coords[3], color.RGBA{255, 0, 0, 255}))
-			case "figure":
-				if len(cmdParts) != 3 {
-					return nil, errors.New("figure command expects two arguments")
-				}
-
-				center, err := convertToCoordinates(cmdParts[1:])
-				if err != nil {
-					return nil, err
-				}
-
-				cp.Artboard.PlaceShape(&painter.Shape{
-					CenterX: center[0],
-					CenterY: center[1],
-				})
-			case "move":
-				if len(cmdParts) != 3 {
-					return nil, errors.New("move command expects two arguments")
-				}
-
-				delta, err := convertToCoordinates(cmdParts[1:])
-				if err != nil {
-					return nil, err
-				}
-
-				cp.Artboard.RepositionShapes(delta[0], delta[1])
-			case "update":
-				textureOps = append(textureOps, cp.Artboard.RefreshArtboard()...)
-			case "reset":
-				cp.Artboard.ClearArtboard()
-			default:
-				return nil, errors.New("unrecognized command")
+			ops, err := applyCommand(artboard, cmdParts)
+			if err != nil {
+				return nil, &ScriptError{Line: line, Column: column, Err: err}
 			}
+			textureOps = append(textureOps, ops...)
 		}
 	}
 
@@ -91,18 +168,413 @@ func (cp *CommandProcessor) ProcessCommands(input io.Reader) ([]painter.TextureO
 		return nil, err
 	}
 
-
 	return textureOps, nil
 }
 
-func convertToCoordinates(args []string) ([]int, error) {
+// splitCommands splits a script line into commands at the commas outside double quotes and parentheses.
+func splitCommands(line string) []string {
+	var (
+		commands []string
+		quoted   bool
+		depth    int // Nesting of parentheses
+		start    int
+	)
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '(' && !quoted:
+			depth++
+		case r == ')' && !quoted && depth > 0:
+			depth--
+		case r == ',' && !quoted && depth == 0:
+			commands = append(commands, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(commands, line[start:])
+}
+
+// commandFields splits a command into its name and arguments at the spaces outside double quotes and
+// parentheses. Quoted arguments lose their quotes and may be empty.
+func commandFields(cmd string) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		quoted bool
+		depth  int  // Nesting of parentheses
+		inside bool // Whether a field has started
+	)
+	for _, r := range cmd {
+		switch {
+		case r == '"':
+			quoted, inside = !quoted, true
+		case (r == ' ' || r == '\t') && !quoted && depth == 0:
+			if inside {
+				fields = append(fields, field.String())
+				field.Reset()
+				inside = false
+			}
+		default:
+			if !quoted && r == '(' {
+				depth++
+			} else if !quoted && r == ')' && depth > 0 {
+				depth--
+			}
+			field.WriteRune(r)
+			inside = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if depth > 0 {
+		return nil, errors.New("unterminated parenthesis")
+	}
+	if inside {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// applyCommand executes a single command split into its name and arguments.
+func applyCommand(artboard *ArtboardState, cmdParts []string) ([]painter.TextureOperation, error) {
+	switch cmdParts[0] {
+	case "bg":
+		if len(cmdParts) != 2 {
+			return nil, errors.New("bg command expects a color or a gradient")
+		}
+
+		if isGradient(cmdParts[1]) {
+			g, err := parseGradient(cmdParts[1])
+			if err != nil {
+				return nil, err
+			}
+			artboard.ConfigureBackgroundGradient(g)
+			break
+		}
+		c, err := parseColor(cmdParts[1])
+		if err != nil {
+			return nil, err
+		}
+		artboard.ConfigureBackground(c)
+	case "white":
+		artboard.ConfigureBackground(color.White)
+	case "green":
+		artboard.ConfigureBackground(greenColor)
+	case "bgrect":
+		if len(cmdParts) < 5 {
+			return nil, errors.New("bgrect command expects four arguments")
+		}
+
+		coords, err := convertToCoordinates(cmdParts[1:5], artboard.canvasSize())
+		if err != nil {
+			return nil, err
+		}
+		style, err := parseStyle(cmdParts[5:], false)
+		if err != nil {
+			return nil, err
+		}
+		if style.color == nil {
+			style.color = rectangleColor
+		}
+
+		artboard.DefineRectangle(image.Rect(coords[0], coords[1], coords[2], coords[3]), style.color)
+		artboard.Rectangle.Op = style.op
+		artboard.Rectangle.Gradient = style.gradient
+		artboard.Rectangle.Clips = artboard.clips
+	case "figure":
+		shape, err := parseFigure(cmdParts[1:], artboard.canvasSize())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := artboard.placeShape(shape); err != nil {
+			return nil, err
+		}
+		artboard.FindShape(artboard.PlaceShape(shape)).Clips = artboard.clips
+	case "line", "circle", "ellipse", "arc", "poly":
+		p, err := parsePrimitive(cmdParts, artboard.canvasSize())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := artboard.placePrimitive(p); err != nil {
+			return nil, err
+		}
+		artboard.DrawPrimitive(p)
+	case "path":
+		p, err := parsePath(cmdParts[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		prim := &Primitive{Kind: "path", Path: p}
+		if err := artboard.placePrimitive(prim); err != nil {
+			return nil, err
+		}
+		artboard.DrawPrimitive(prim)
+	case "text":
+		// "text @id label" labels a figure, "text x y label" draws the label on the artboard.
+		if len(cmdParts) > 1 && strings.HasPrefix(cmdParts[1], "@") {
+			fig, err := lookupFigure(artboard, cmdParts[1])
+			if err != nil {
+				return nil, err
+			}
+			label, err := parseLabel(cmdParts[2:], painter.AlignCenter)
+			if err != nil {
+				return nil, err
+			}
+
+			// An empty label removes the one the figure has.
+			fig.Label = label
+			if label.Text == "" {
+				fig.Label = nil
+			}
+			break
+		}
+		if len(cmdParts) < 3 {
+			return nil, errors.New("text command expects two coordinates and a label")
+		}
+
+		pos, err := convertToCoordinates(cmdParts[1:3], artboard.canvasSize())
+		if err != nil {
+			return nil, err
+		}
+		label, err := parseLabel(cmdParts[3:], painter.AlignLeft)
+		if err != nil {
+			return nil, err
+		}
+		p := &Primitive{Kind: "text", Points: []image.Point{{pos[0], pos[1]}}, Label: label}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+
+		if err := artboard.placePrimitive(p); err != nil {
+			return nil, err
+		}
+		artboard.DrawPrimitive(p)
+	case "blit":
+		p, err := parseBlit(cmdParts[1:], artboard.Assets, artboard.canvasSize())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := artboard.placePrimitive(p); err != nil {
+			return nil, err
+		}
+		artboard.DrawPrimitive(p)
+	case "rotate", "scale", "transform":
+		if err := applyTransform(artboard, cmdParts); err != nil {
+			return nil, err
+		}
+	case "push":
+		if err := artboard.PushTransform(); err != nil {
+			return nil, err
+		}
+	case "pop":
+		if err := artboard.PopTransform(); err != nil {
+			return nil, err
+		}
+	case "clip":
+		if err := applyClip(artboard, cmdParts[1:]); err != nil {
+			return nil, err
+		}
+	case "unclip":
+		if len(cmdParts) != 1 {
+			return nil, errors.New("unclip command expects no arguments")
+		}
+		if err := artboard.PopClip(); err != nil {
+			return nil, err
+		}
+	case "move":
+		// "move @id x y" moves a single figure, "move x y" moves all of them.
+		args := cmdParts[1:]
+		var target *Figure
+		if len(args) > 0 && strings.HasPrefix(args[0], "@") {
+			fig, err := lookupFigure(artboard, args[0])
+			if err != nil {
+				return nil, err
+			}
+			target, args = fig, args[1:]
+		}
+		if len(args) != 2 {
+			return nil, errors.New("move command expects two arguments")
+		}
+
+		delta, err := convertToCoordinates(args, artboard.canvasSize())
+		if err != nil {
+			return nil, err
+		}
+
+		moved := artboard.Shapes
+		if target != nil {
+			moved = []*Figure{target}
+		}
+		for _, fig := range moved {
+			fig.Move(delta[0], delta[1])
+			if err := checkCenter(fig, artboard.canvasSize()); err != nil {
+				return nil, err
+			}
+		}
+	case "remove":
+		if len(cmdParts) != 2 {
+			return nil, errors.New("remove command expects a figure reference")
+		}
+
+		fig, err := lookupFigure(artboard, cmdParts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		artboard.RemoveShape(fig.ID)
+	case "resize":
+		if len(cmdParts) != 3 {
+			return nil, errors.New("resize command expects two arguments")
+		}
+
+		size, err := convertToSize(cmdParts[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		artboard.ResizeArtboard(size)
+		return append([]painter.TextureOperation{painter.Resize{Size: size}}, artboard.RefreshArtboard()...), nil
+	case "update":
+		return artboard.RefreshArtboard(), nil
+	case "reset":
+		artboard.ClearArtboard()
+	default:
+		return nil, errors.New("unrecognized command")
+	}
+	return nil, nil
+}
+
+// maxCoordinate bounds normalized coordinates, so that objects stay within a few canvases of the visible one and
+// their pixels round-trip through scripts.
+const maxCoordinate = 4
+
+// checkCoordinates reports an error unless the normalized coordinates are finite and at most maxCoordinate away
+// from the origin.
+func checkCoordinates(values ...float64) error {
+	for _, v := range values {
+		if !finite(v) || math.Abs(v) > maxCoordinate {
+			return fmt.Errorf("coordinate %v must be a number from -%d to %d", v, maxCoordinate, maxCoordinate)
+		}
+	}
+	return nil
+}
+
+// checkCenter reports an error if the figure is farther from the canvas than coordinates may place it.
+func checkCenter(fig *Figure, size image.Point) error {
+	if checkCoordinates(normalize(fig.CenterX, size.X), normalize(fig.CenterY, size.Y)) != nil {
+		return fmt.Errorf("figure %d would be more than %d canvases away", fig.ID, maxCoordinate)
+	}
+	return nil
+}
+
+// convertToCoordinates converts normalized x and y coordinates, alternating in args, into pixels of a canvas
+// of the given size. Coordinates are rounded to the nearest pixel rather than truncated, so that the normalized
+// values written by MarshalScript parse back to the same pixels; scripts relying on truncation may move by a pixel.
+func convertToCoordinates(args []string, size image.Point) ([]int, error) {
 	coordinates := make([]int, len(args))
 	for i, arg := range args {
 		value, err := strconv.ParseFloat(arg, 64)
 		if err != nil {
 			return nil, errors.New("error parsing coordinate")
 		}
-		coordinates[i] = int(value * 800) // Assuming 800 is the scale factor for the artboard dimensions
+		if err := checkCoordinates(value); err != nil {
+			return nil, err
+		}
+		extent := size.X
+		if i%2 == 1 {
+			extent = size.Y
+		}
+		coordinates[i] = denormalize(value, extent)
 	}
 	return coordinates, nil
 }
+
+// drawStyle holds the optional arguments of the drawing commands.
+type drawStyle struct {
+	color    color.Color // nil unless given
+	gradient painter.Gradient
+	op       draw.Op
+	width    float64 // Stroke width in pixels, 0 unless given
+}
+
+// maxStrokeWidth limits stroke widths in pixels, so that outlines stay within the range the rasterizer handles.
+const maxStrokeWidth = MaxCanvasDimension
+
+// checkWidth returns an error unless the stroke width is a number from 0 to maxStrokeWidth.
+func checkWidth(width float64) error {
+	if !(width >= 0 && width <= maxStrokeWidth) {
+		return fmt.Errorf("width %v must be a number from 0 to %d", width, maxStrokeWidth)
+	}
+	return nil
+}
+
+// parseStyle parses the optional arguments that follow the coordinates of a drawing command: a color in one of
+// the forms accepted by parseColor, whose alpha makes it translucent, or a gradient accepted by parseGradient,
+// the composite mode "over" or "src" and, if withWidth is set, a stroke width in pixels as width=N.
+func parseStyle(args []string, withWidth bool) (drawStyle, error) {
+	var style drawStyle
+	for _, arg := range args {
+		if w, ok := strings.CutPrefix(arg, "width="); ok && withWidth {
+			width, err := parseFinite(w)
+			if err != nil || width <= 0 || checkWidth(width) != nil {
+				return drawStyle{}, fmt.Errorf("invalid width %q: must be a number from 0 to %d", w, maxStrokeWidth)
+			}
+			style.width = width
+			continue
+		}
+		if isGradient(arg) {
+			g, err := parseGradient(arg)
+			if err != nil {
+				return drawStyle{}, err
+			}
+			style.gradient = g
+			continue
+		}
+		if strings.HasPrefix(arg, "#") {
+			c, err := parseColor(arg)
+			if err != nil {
+				return drawStyle{}, err
+			}
+			style.color = c
+			continue
+		}
+		op, err := parseCompositeMode(arg)
+		if err != nil {
+			return drawStyle{}, fmt.Errorf("unexpected argument %q", arg)
+		}
+		style.op = op
+	}
+	return style, nil
+}
+
+// lookupFigure returns the figure referenced as @id.
+func lookupFigure(artboard *ArtboardState, ref string) (*Figure, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(ref, "@"))
+	if err != nil || !strings.HasPrefix(ref, "@") {
+		return nil, fmt.Errorf("invalid figure reference %q", ref)
+	}
+	fig := artboard.FindShape(id)
+	if fig == nil {
+		return nil, fmt.Errorf("figure %d not found", id)
+	}
+	return fig, nil
+}
+
+// convertToSize parses the width and height in pixels given to the resize command.
+func convertToSize(args []string) (image.Point, error) {
+	var dims [2]int
+	for i, arg := range args {
+		value, err := strconv.Atoi(arg)
+		if err != nil || value < 1 || value > MaxCanvasDimension {
+			return image.Point{}, fmt.Errorf("canvas dimensions must be integers from 1 to %d", MaxCanvasDimension)
+		}
+		dims[i] = value
+	}
+	return image.Pt(dims[0], dims[1]), nil
+}
@@ -2,7 +2,11 @@ package lang
 
 import (
 	"bytes"
+	"errors"
+	"image"
 	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
 func TestCommandProcessor_ProcessCommands(t *testing.T) {
@@ -54,6 +58,26 @@ func TestCommandProcessor_ProcessCommands(t *testing.T) {
 			input:   "figure 0.3",
 			wantErr: true,
 		},
+		{
+			name:    "Translucent bgrect command",
+			input:   "bgrect 0.1 0.1 0.5 0.5 #ff000080",
+			wantErr: false,
+		},
+		{
+			name:    "Figure command with color and composite mode",
+			input:   "figure 0.3 0.3 #0f08 src",
+			wantErr: false,
+		},
+		{
+			name:    "Invalid figure color",
+			input:   "figure 0.3 0.3 blue",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid bgrect color",
+			input:   "bgrect 0.1 0.1 0.5 0.5 #zzz",
+			wantErr: true,
+		},
 		{
 			name:    "Valid move command",
 			input:   "move 0.2 0.2",
@@ -64,6 +88,16 @@ func TestCommandProcessor_ProcessCommands(t *testing.T) {
 			input:   "move 0.2",
 			wantErr: true,
 		},
+		{
+			name:    "Move beyond the coordinate bounds",
+			input:   "figure 3 3, move 0.5 0, move 0.6 0",
+			wantErr: true,
+		},
+		{
+			name:    "Non-finite coordinates",
+			input:   "figure NaN 0.5",
+			wantErr: true,
+		},
 		{
 			name:    "Valid update command",
 			input:   "update",
@@ -99,6 +133,30 @@ func TestConvertToCoordinates(t *testing.T) {
 			want:    []int{80, 160, 240, 320},
 			wantErr: false,
 		},
+		{
+			name:    "Rounded coordinates",
+			args:    []string{"0.4999", "0.00124", "-0.001", "-0.0006"},
+			want:    []int{400, 1, -1, 0},
+			wantErr: false,
+		},
+		{
+			name:    "Coordinates beyond the canvas",
+			args:    []string{"1.5", "-2", "4", "-4"},
+			want:    []int{1200, -1600, 3200, -3200},
+			wantErr: false,
+		},
+		{
+			name:    "Coordinates too far from the canvas",
+			args:    []string{"0", "4.001"},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "Coordinates that are not finite",
+			args:    []string{"NaN", "Inf", "-Inf", "1e300"},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name:    "Invalid coordinates",
 			args:    []string{"invalid", "0.2", "0.3", "0.4"},
@@ -109,7 +167,7 @@ func TestConvertToCoordinates(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := convertToCoordinates(tt.args)
+			got, err := convertToCoordinates(tt.args, painter.DefaultCanvasSize)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ConvertToCoordinates() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -133,3 +191,58 @@ func compareSlices(a, b []int) bool {
 	}
 	return true
 }
+
+func TestCommandProcessor_ProcessCommands_ErrorPosition(t *testing.T) {
+	processor := NewCommandProcessor(NewArtboardState())
+
+	_, err := processor.ProcessCommands(bytes.NewBufferString("white\nfigure 0.1 0.1,  bgrect 0.1"))
+
+	var se *ScriptError
+	if !errors.As(err, &se) {
+		t.Fatalf("ProcessCommands() error = %v, want a ScriptError", err)
+	}
+	if se.Line != 2 || se.Column != 18 {
+		t.Errorf("ScriptError position = %d:%d, want 2:18", se.Line, se.Column)
+	}
+}
+
+func TestCommandProcessor_ProcessCommands_Resize(t *testing.T) {
+	artboard := NewArtboardState()
+	processor := NewCommandProcessor(artboard)
+
+	ops, err := processor.ProcessCommands(bytes.NewBufferString("figure 0.5 0.5,bgrect 0.25 0.25 0.5 0.5,resize 400 200,figure 0.25 0.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) == 0 || ops[0] != (painter.Resize{Size: image.Pt(400, 200)}) {
+		t.Fatalf("resize did not start with a Resize operation: %v", ops)
+	}
+	if ops[len(ops)-1] != painter.MarkUpdated {
+		t.Error("resize did not redraw the artboard")
+	}
+
+	if artboard.Size != image.Pt(400, 200) {
+		t.Errorf("artboard size is %v", artboard.Size)
+	}
+	if got := artboard.Rectangle.Bounds; got != image.Rect(100, 50, 200, 100) {
+		t.Errorf("rectangle was not scaled: %v", got)
+	}
+	for i, want := range []image.Point{{200, 100}, {100, 100}} {
+		if got := image.Pt(artboard.Shapes[i].CenterX, artboard.Shapes[i].CenterY); got != want {
+			t.Errorf("shape %d is at %v, want %v", i, got, want)
+		}
+	}
+
+	if _, err := processor.ProcessCommands(bytes.NewBufferString("remove @1,move @2 0.25 0")); err != nil {
+		t.Fatal(err)
+	}
+	if len(artboard.Shapes) != 1 || artboard.Shapes[0].ID != 2 || artboard.Shapes[0].CenterX != 200 {
+		t.Errorf("remove and move by reference did not apply to the referenced figures")
+	}
+
+	for _, input := range []string{"remove @1", "remove 2", "move @x 0 0", "resize 0 100", "resize 100", "resize 100 9000", "resize 1.5 100"} {
+		if _, err := processor.ProcessCommands(bytes.NewBufferString(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
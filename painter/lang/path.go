@@ -0,0 +1,310 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// Path is what the path command draws. Its data stays in normalized coordinates, so it follows canvas resizes
+// without rounding.
+type Path struct {
+	Data   string      // SVG path data
+	Fill   color.Color // Nil if the path is not filled
+	Stroke color.Color // Nil if the path is not stroked
+	Width  float64     // Stroke width in pixels, one if zero
+	Rule   painter.FillRule
+	Op     draw.Op
+
+	segments []pathSegment
+}
+
+// pathSegment is a command of path data converted to absolute coordinates: M, L, Q, C or Z.
+type pathSegment struct {
+	cmd    byte
+	points [][2]float64
+}
+
+// pathArgs is the number of numbers every path data command takes.
+var pathArgs = map[byte]int{'M': 2, 'L': 2, 'H': 1, 'V': 1, 'C': 6, 'Q': 4, 'Z': 0}
+
+// NewPath parses SVG path data with the M, L, H, V, C, Q and Z commands and their relative forms.
+// The data must not contain quotes or control characters, so that it can be written quoted on a script line.
+func NewPath(data string) (*Path, error) {
+	if i := strings.IndexFunc(data, func(r rune) bool { return r == '"' || unicode.IsControl(r) }); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(data[i:])
+		return nil, fmt.Errorf("path data cannot contain %q", r)
+	}
+	segments, err := parsePathData(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Path{Data: data, segments: segments}, nil
+}
+
+// Operation returns the operation that draws the path on a canvas of the given size.
+func (p *Path) Operation(size image.Point) painter.TextureOperation {
+	path := p.scaled(size)
+	var ops painter.CompositeOperation
+	if p.Fill != nil {
+		ops = append(ops, painter.FillPath(path, p.Rule, painter.Paint{Color: p.Fill, Op: p.Op}))
+	}
+	if p.Stroke != nil {
+		ops = append(ops, painter.StrokePath(path, painter.Paint{Color: p.Stroke, Op: p.Op, Width: p.Width}))
+	}
+	return ops
+}
+
+// scaled converts the path to the pixels of a canvas of the given size.
+func (p *Path) scaled(size image.Point) *painter.Path {
+	var (
+		path  painter.Path
+		scale = func(pt [2]float64) painter.Point {
+			return painter.Point{X: pt[0] * float64(size.X), Y: pt[1] * float64(size.Y)}
+		}
+	)
+	for _, s := range p.segments {
+		switch s.cmd {
+		case 'M':
+			path.MoveTo(scale(s.points[0]))
+		case 'L':
+			path.LineTo(scale(s.points[0]))
+		case 'Q':
+			path.QuadTo(scale(s.points[0]), scale(s.points[1]))
+		case 'C':
+			path.CubeTo(scale(s.points[0]), scale(s.points[1]), scale(s.points[2]))
+		case 'Z':
+			path.Close()
+		}
+	}
+	return &path
+}
+
+// parsePathData converts path data into segments with absolute coordinates.
+func parsePathData(data string) ([]pathSegment, error) {
+	var (
+		segments   []pathSegment
+		cur, start [2]float64
+		cmd        byte
+		args       []float64
+	)
+	flush := func() error {
+		if cmd == 0 {
+			return nil
+		}
+		n := pathArgs[cmd&^0x20]
+		if n == 0 {
+			if len(args) > 0 {
+				return fmt.Errorf("path command %c takes no arguments", cmd)
+			}
+			segments = append(segments, pathSegment{cmd: 'Z'})
+			cur = start
+			return nil
+		}
+		if len(args) == 0 || len(args)%n != 0 {
+			return fmt.Errorf("path command %c expects arguments in groups of %d", cmd, n)
+		}
+
+		relative := cmd >= 'a'
+		for i := 0; i < len(args); i += n {
+			// Relative coordinates of all points of a command are relative to its start.
+			base := cur
+			point := func(j int) [2]float64 {
+				if relative {
+					return [2]float64{base[0] + args[i+j], base[1] + args[i+j+1]}
+				}
+				return [2]float64{args[i+j], args[i+j+1]}
+			}
+
+			s := pathSegment{cmd: cmd &^ 0x20}
+			switch s.cmd {
+			case 'M':
+				s.points = [][2]float64{point(0)}
+				start = s.points[0]
+				if i > 0 {
+					s.cmd = 'L' // Pairs after the first one of a move are lines
+				}
+			case 'L':
+				s.points = [][2]float64{point(0)}
+			case 'H':
+				s.cmd, s.points = 'L', [][2]float64{{args[i], cur[1]}}
+				if relative {
+					s.points[0][0] += cur[0]
+				}
+			case 'V':
+				s.cmd, s.points = 'L', [][2]float64{{cur[0], args[i]}}
+				if relative {
+					s.points[0][1] += cur[1]
+				}
+			case 'Q':
+				s.points = [][2]float64{point(0), point(2)}
+			case 'C':
+				s.points = [][2]float64{point(0), point(2), point(4)}
+			}
+			segments = append(segments, s)
+			cur = s.points[len(s.points)-1]
+		}
+		return nil
+	}
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == ' ' || c == ',' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case pathArgs[c&^0x20] > 0 || c == 'Z' || c == 'z':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if cmd == 0 && c != 'M' && c != 'm' {
+				return nil, errors.New("path data must start with a move")
+			}
+			cmd, args = c, args[:0]
+			i++
+		default:
+			end := scanNumber(data, i)
+			v, err := strconv.ParseFloat(data[i:end], 64)
+			if end == i || err != nil {
+				return nil, fmt.Errorf("invalid path data at %q", data[i:])
+			}
+			if cmd == 0 {
+				return nil, errors.New("path data must start with a move")
+			}
+			args = append(args, v)
+			i = end
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("path data is empty")
+	}
+	return segments, nil
+}
+
+// scanNumber returns the end of the number starting at i: an optional sign, digits with an optional decimal
+// point and an optional exponent. Numbers may follow each other without a separator, as in "0.5-0.2" or "0.5.2".
+func scanNumber(s string, i int) int {
+	digits := func() {
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits()
+	if i < len(s) && s[i] == '.' {
+		i++
+		digits()
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			i = j
+			digits()
+		}
+	}
+	return i
+}
+
+// parsePath parses the arguments of the path command: the path data, then fill=COLOR, stroke=COLOR, width=N,
+// rule=nonzero|evenodd and the composite mode. A path with neither fill nor stroke is filled with the default
+// shape color; a width without a stroke color strokes it with that color.
+func parsePath(args []string) (*Path, error) {
+	if len(args) == 0 {
+		return nil, errors.New("path command expects path data")
+	}
+	p, err := NewPath(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args[1:] {
+		name, value, _ := strings.Cut(arg, "=")
+		switch name {
+		case "fill", "stroke":
+			c, err := parseColor(value)
+			if err != nil {
+				return nil, err
+			}
+			if name == "fill" {
+				p.Fill = c
+			} else {
+				p.Stroke = c
+			}
+		case "width":
+			style, err := parseStyle([]string{arg}, true)
+			if err != nil {
+				return nil, err
+			}
+			p.Width = style.width
+		case "rule":
+			if p.Rule, err = parseFillRule(value); err != nil {
+				return nil, err
+			}
+		default:
+			if p.Op, err = parseCompositeMode(arg); err != nil {
+				return nil, fmt.Errorf("unexpected argument %q", arg)
+			}
+		}
+	}
+
+	if p.Stroke == nil && p.Width > 0 {
+		p.Stroke = painter.DefaultShapeColor
+	}
+	if p.Fill == nil && p.Stroke == nil {
+		p.Fill = painter.DefaultShapeColor
+	}
+	return p, nil
+}
+
+// writePath writes the path command that draws the path.
+func writePath(buf *bytes.Buffer, p *Path) {
+	// NewPath rejects quotes and line breaks in path data, so it needs no escaping.
+	fmt.Fprintf(buf, "path \"%s\"", p.Data)
+	if p.Fill != nil {
+		buf.WriteString(" fill=" + formatColor(p.Fill))
+	}
+	if p.Stroke != nil {
+		buf.WriteString(" stroke=" + formatColor(p.Stroke))
+		if p.Width > 0 {
+			buf.WriteString(" width=" + formatFloat(p.Width))
+		}
+	}
+	if p.Rule == painter.EvenOdd {
+		buf.WriteString(" rule=evenodd")
+	}
+	writeStyle(buf, nil, p.Op)
+}
+
+func parseFillRule(s string) (painter.FillRule, error) {
+	switch s {
+	case "", "nonzero":
+		return painter.NonZero, nil
+	case "evenodd":
+		return painter.EvenOdd, nil
+	default:
+		return 0, fmt.Errorf("fill rule %q must be nonzero or evenodd", s)
+	}
+}
+
+func formatFillRule(rule painter.FillRule) string {
+	if rule == painter.EvenOdd {
+		return "evenodd"
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestParsePathData(t *testing.T) {
+	segments, err := parsePathData("m0.1,0.1 0.2 0 V0.5h-.2 q0.1-0.1 0.2 0 C 0.1 0.2 0.3 0.4 0.5 0.6 z M.5.5l0 .1Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pathSegment{
+		{'M', [][2]float64{{0.1, 0.1}}},
+		{'L', [][2]float64{{0.30000000000000004, 0.1}}},
+		{'L', [][2]float64{{0.30000000000000004, 0.5}}},
+		{'L', [][2]float64{{0.10000000000000003, 0.5}}},
+		{'Q', [][2]float64{{0.20000000000000004, 0.4}, {0.30000000000000004, 0.5}}},
+		{'C', [][2]float64{{0.1, 0.2}, {0.3, 0.4}, {0.5, 0.6}}},
+		{'Z', nil},
+		{'M', [][2]float64{{0.5, 0.5}}},
+		{'L', [][2]float64{{0.5, 0.6}}},
+		{'Z', nil},
+	}
+	if !reflect.DeepEqual(segments, want) {
+		t.Errorf("parsePathData() got %v, want %v", segments, want)
+	}
+
+	for _, data := range []string{"", "L 0 0", "M 0", "M 0 0 C 1 1", "M 0 0 Z 1", "M 0 0 X 1 1", "M 0 0 L 1 --1"} {
+		if _, err := parsePathData(data); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestCommandProcessor_ProcessCommands_Path(t *testing.T) {
+	as := NewArtboardState()
+	processor := NewCommandProcessor(as)
+
+	// The quoted path data contains the comma that also separates commands.
+	script := `white,path "M 0.1,0.1 L 0.9,0.1 L 0.9,0.9 L 0.1,0.9 Z M 0.3 0.3 H 0.7 V 0.7 H 0.3 Z" fill=#f00 rule=evenodd,update`
+	if _, err := processor.ProcessCommands(bytes.NewBufferString(script)); err != nil {
+		t.Fatal(err)
+	}
+	if len(as.Primitives) != 1 || as.Primitives[0].Path.Rule != painter.EvenOdd {
+		t.Fatalf("path was not added: %+v", as.Primitives)
+	}
+
+	img := (&Canvas{Artboard: as}).Snapshot()
+	if got := img.RGBAAt(160, 400); got != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("filled part of the path is %v", got)
+	}
+	if got := img.RGBAAt(400, 400); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("even-odd hole of the path is %v", got)
+	}
+
+	for _, input := range []string{`path`, `path "M 0 0 L 1 1`, `path "L 1 1"`, `path "M 0 0 L 1 1" rule=odd`, `path "M 0 0 L 1 1" fill=red`, `path "M 0 0 L 1 1" 0.5`, `path "M 0 0 L 1 1" width=NaN`, `path "M 0 0 L 1 1" width=1e9`} {
+		if _, err := processor.ProcessCommands(bytes.NewBufferString(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestPath_RoundTrip(t *testing.T) {
+	script := "path \"M 0.1 0.1 C 0.2 0.4 0.6 0.4 0.9 0.1 Z\" fill=#ff000080 stroke=#0000ffff width=2 rule=evenodd src\n" +
+		"path \"M0 0l.5 .5\" stroke=#0000ffff\n"
+
+	checkRoundTrip(t, script)
+	for _, script := range []string{
+		"path \"M -4 -4 L 4 4\" stroke=#0000ffff width=8192\n",
+		"path \"M 0 0 L 1 0 L 0 1 Z\" fill=#00000000\n",
+	} {
+		checkRoundTrip(t, script)
+	}
+
+	// Path data from JSON could otherwise break the script lines it is written to.
+	for _, data := range []string{`M 0 0 L 1 1\n`, `M 0 0 L 1 1\r`, `M 0 0 \" L 1 1`, `M 0 0\tL 1 1`} {
+		state := `{"primitives":[{"kind":"path","data":"` + data + `","stroke":"#000000ff"}]}`
+		if err := json.Unmarshal([]byte(state), NewArtboardState()); err == nil {
+			t.Errorf("%s: path data was accepted", data)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"primitives":[{"kind":"path","data":"M 0 0 L 1 1","stroke":"#000000ff","width":1e9}]}`), NewArtboardState()); err == nil {
+		t.Error("huge path width was accepted")
+	}
+}
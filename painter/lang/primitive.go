@@ -0,0 +1,244 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// Primitive is a line, circle, ellipse, arc, polygon, path, text or image drawn by the command of the same name, in
+// artboard pixels.
+type Primitive struct {
+	Kind   string        // line, circle, ellipse, arc, poly, path, text or blit
+	Points []image.Point // Ends of a line, vertices of a polygon, the center of circles, ellipses and arcs, where text is aligned, or the corners of an image
+	Radii  image.Point   // Radii of circles, ellipses and arcs
+	Angles [2]float64    // Start and end of an arc in degrees, clockwise from the positive X axis
+	Paint  painter.Paint // Paint of all kinds but paths
+	Path   *Path         // Path of a path; it is never modified, so copies share it
+	Label  *Label        // Label of a text, which copies share the same way
+	Asset  string        // Name of the image of a blit in the asset store of the artboard
+
+	// Transform maps all kinds but texts and images into the artboard after they are rasterized, strokes
+	// included. The zero value is painter.Identity.
+	Transform painter.Affine
+	// Clips limit the primitive to where they overlap.
+	Clips *ClipStack
+}
+
+// maxRadius is the largest radius in pixels, a few times the largest canvas.
+const maxRadius = 4 * MaxCanvasDimension
+
+// primitiveArgs is the number of numeric arguments of every primitive command; poly takes any number of pairs.
+var primitiveArgs = map[string]int{"line": 4, "circle": 3, "ellipse": 4, "arc": 6, "poly": -1, "path": 0, "text": 2, "blit": 2}
+
+// DrawPrimitive adds the primitive to the artboard. Primitives are drawn over the rectangle, below the figures.
+func (as *ArtboardState) DrawPrimitive(p *Primitive) {
+	as.Primitives = append(as.Primitives, p)
+}
+
+// Operation returns the operation that draws the primitive on a canvas of the given size. Blits draw the images
+// of assets.
+func (p *Primitive) Operation(size image.Point, assets *AssetStore) painter.TextureOperation {
+	if !p.Transform.IsIdentity() {
+		return transformOperation(p.operation(size, assets), p.Transform)
+	}
+	return p.operation(size, assets)
+}
+
+func (p *Primitive) operation(size image.Point, assets *AssetStore) painter.TextureOperation {
+	if p.Kind == "path" {
+		return p.Path.Operation(size)
+	}
+	if p.Kind == "text" {
+		return p.Label.Operation(p.Points[0])
+	}
+	if p.Kind == "blit" {
+		if op := p.blitOperation(assets); op != nil {
+			return op
+		}
+		return painter.CompositeOperation(nil)
+	}
+
+	points := make([]painter.Point, len(p.Points))
+	for i, pt := range p.Points {
+		points[i] = painter.Point{X: float64(pt.X), Y: float64(pt.Y)}
+	}
+	rx, ry := float64(p.Radii.X), float64(p.Radii.Y)
+
+	switch p.Kind {
+	case "line":
+		return painter.DrawLine(points[0], points[1], p.Paint)
+	case "circle", "ellipse":
+		return painter.DrawEllipse(points[0], rx, ry, p.Paint)
+	case "arc":
+		return painter.DrawArc(points[0], rx, ry, p.Angles[0], p.Angles[1], p.Paint)
+	default:
+		return painter.DrawPolygon(points, p.Paint)
+	}
+}
+
+// validate checks that the primitive has the geometry its kind needs.
+func (p *Primitive) validate() error {
+	n, ok := primitiveArgs[p.Kind]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown primitive %q", p.Kind)
+	case (p.Kind == "text" || p.Kind == "blit") && !p.Transform.IsIdentity():
+		return fmt.Errorf("%s cannot be transformed", p.Kind)
+	case !p.Transform.IsIdentity() && !invertible(p.Transform):
+		return errors.New("transform must not collapse the plane")
+	case p.Kind == "path":
+		if p.Path == nil {
+			return errors.New("path command expects path data")
+		}
+	case p.Kind == "text" && p.Label == nil:
+		return errors.New("text command expects a label")
+	case p.Kind == "text" && p.Label.Text == "":
+		return errors.New("label must not be empty")
+	case p.Kind == "blit" && p.Asset == "":
+		return errors.New("blit command expects an asset name")
+	case p.Kind == "blit" && len(p.Points) == 2 && (p.Points[1].X <= p.Points[0].X || p.Points[1].Y <= p.Points[0].Y):
+		return errors.New("image size must be positive")
+	case p.Kind == "blit" && (len(p.Points) == 1 || len(p.Points) == 2):
+	case p.Kind == "poly" && len(p.Points) < 3:
+		return errors.New("poly command expects at least three points")
+	case p.Kind == "line" && len(p.Points) != 2, p.Kind != "line" && p.Kind != "poly" && len(p.Points) != 1:
+		return fmt.Errorf("%s command expects %d arguments", p.Kind, n)
+	case p.Radii.X < 0 || p.Radii.Y < 0:
+		return errors.New("radius must not be negative")
+	case p.Radii.X > maxRadius || p.Radii.Y > maxRadius:
+		return fmt.Errorf("radius must not exceed %d pixels", maxRadius)
+	case !finite(p.Angles[0]) || !finite(p.Angles[1]):
+		return errors.New("angles must be finite")
+	case checkWidth(p.Paint.Width) != nil:
+		return checkWidth(p.Paint.Width)
+	}
+	return nil
+}
+
+// clone returns a copy of the primitive that does not share its points.
+func (p *Primitive) clone() *Primitive {
+	c := *p
+	c.Points = append([]image.Point(nil), p.Points...)
+	return &c
+}
+
+// scale converts the primitive from a canvas of one size to another one.
+func (p *Primitive) scale(from, to image.Point) {
+	scale := func(v, from, to int) int {
+		return int(math.Round(float64(v) * float64(to) / float64(from)))
+	}
+	for i, pt := range p.Points {
+		p.Points[i] = image.Pt(scale(pt.X, from.X, to.X), scale(pt.Y, from.Y, to.Y))
+	}
+	p.Radii = image.Pt(scale(p.Radii.X, from.X, to.X), scale(p.Radii.Y, from.Y, to.Y))
+	p.Transform = rescaleTransform(p.Transform, from, to)
+}
+
+// parsePrimitive parses a primitive command: its normalized coordinates and radii, the angles of an arc in
+// degrees and the drawing style, which may include a stroke width.
+func parsePrimitive(cmdParts []string, size image.Point) (*Primitive, error) {
+	kind, args := cmdParts[0], cmdParts[1:]
+
+	// The numeric arguments end where the style begins.
+	var values []float64
+	for _, arg := range args {
+		v, err := parseFinite(arg)
+		if err != nil {
+			break
+		}
+		values = append(values, v)
+	}
+	style, err := parseStyle(args[len(values):], true)
+	if err != nil {
+		return nil, err
+	}
+
+	n := primitiveArgs[kind]
+	if kind == "poly" && len(values)%2 != 0 {
+		return nil, errors.New("poly command expects pairs of coordinates")
+	}
+	if n >= 0 && len(values) != n {
+		return nil, fmt.Errorf("%s command expects %d arguments", kind, n)
+	}
+
+	coordinates := values
+	if kind == "arc" {
+		coordinates = values[:4]
+	}
+	if err := checkCoordinates(coordinates...); err != nil {
+		return nil, err
+	}
+
+	p := &Primitive{Kind: kind, Paint: painter.Paint{Color: style.color, Op: style.op, Width: style.width, Gradient: style.gradient}}
+	switch kind {
+	case "circle":
+		values = append(values[:3], values[2])
+		fallthrough
+	case "ellipse", "arc":
+		p.Points = []image.Point{{denormalize(values[0], size.X), denormalize(values[1], size.Y)}}
+		p.Radii = image.Pt(denormalize(values[2], size.X), denormalize(values[3], size.Y))
+		if kind == "arc" {
+			p.Angles = [2]float64{values[4], values[5]}
+		}
+	default:
+		for i := 0; i+1 < len(values); i += 2 {
+			p.Points = append(p.Points, image.Pt(denormalize(values[i], size.X), denormalize(values[i+1], size.Y)))
+		}
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// writePrimitive writes the command that draws the primitive on a canvas of the given size.
+func writePrimitive(buf *bytes.Buffer, p *Primitive, size image.Point) error {
+	kind := p.Kind
+	if kind == "blit" {
+		pos := p.Points[0]
+		fmt.Fprintf(buf, "blit %s %s %s", p.Asset, formatCoordinate(pos.X, size.X), formatCoordinate(pos.Y, size.Y))
+		if len(p.Points) == 2 {
+			d := p.Points[1].Sub(pos)
+			fmt.Fprintf(buf, " %s %s", formatCoordinate(d.X, size.X), formatCoordinate(d.Y, size.Y))
+		}
+		buf.WriteByte('\n')
+		return nil
+	}
+	// A circle stays one only while its radius converts back to both radii.
+	if r := normalize(p.Radii.X, size.X); kind == "circle" && denormalize(r, size.Y) != p.Radii.Y {
+		kind = "ellipse"
+	}
+
+	buf.WriteString(kind)
+	for _, pt := range p.Points {
+		fmt.Fprintf(buf, " %s %s", formatCoordinate(pt.X, size.X), formatCoordinate(pt.Y, size.Y))
+	}
+	if kind == "text" {
+		return writeLabel(buf, p.Label, painter.AlignLeft)
+	}
+	switch kind {
+	case "circle":
+		fmt.Fprintf(buf, " %s", formatCoordinate(p.Radii.X, size.X))
+	case "ellipse", "arc":
+		fmt.Fprintf(buf, " %s %s", formatCoordinate(p.Radii.X, size.X), formatCoordinate(p.Radii.Y, size.Y))
+	}
+	if kind == "arc" {
+		fmt.Fprintf(buf, " %s %s", formatFloat(p.Angles[0]), formatFloat(p.Angles[1]))
+	}
+	if p.Paint.Width > 0 {
+		buf.WriteString(" width=" + formatFloat(p.Paint.Width))
+	}
+	writeGradient(buf, p.Paint.Gradient)
+	writeStyle(buf, p.Paint.Color, p.Paint.Op)
+	return nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
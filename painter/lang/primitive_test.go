@@ -0,0 +1,81 @@
+package lang
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCommandProcessor_ProcessCommands_Primitives(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "line 0.1 0.1 0.9 0.5"},
+		{input: "line 0.1 0.1 0.9 0.5 width=3 #f008"},
+		{input: "circle 0.5 0.5 0.25"},
+		{input: "ellipse 0.5 0.5 0.25 0.1 width=2 src"},
+		{input: "arc 0.5 0.5 0.25 0.25 -90 90 #00f"},
+		{input: "poly 0.1 0.1 0.9 0.1 0.5 0.9 #0f0"},
+		{input: "line 0.1 0.1 0.9", wantErr: true},
+		{input: "circle 0.5 0.5", wantErr: true},
+		{input: "circle 0.5 0.5 -0.1", wantErr: true},
+		{input: "arc 0.5 0.5 0.25 0.25 90", wantErr: true},
+		{input: "poly 0.1 0.1 0.9 0.1", wantErr: true},
+		{input: "poly 0.1 0.1 0.9 0.1 0.5", wantErr: true},
+		{input: "circle 0.5 0.5 0.2 width=0", wantErr: true},
+		{input: "circle 0.5 0.5 0.2 thick", wantErr: true},
+		{input: "figure 0.5 0.5 width=2", wantErr: true},
+		{input: "arc 0.5 0.5 0.25 0.25 0 1e13"},
+		{input: "arc 0.5 0.5 0.25 0.25 0 NaN", wantErr: true},
+		{input: "circle 0.5 NaN 0.25", wantErr: true},
+		{input: "circle 0.5 0.5 1e6", wantErr: true},
+		{input: "ellipse 0.5 0.5 0.25 1e300", wantErr: true},
+		{input: "line 0 0 1 1 width=8192"},
+		{input: "line 0 0 1 1 width=NaN", wantErr: true},
+		{input: "ellipse 0.5 0.5 0.1 0.2 width=1e9", wantErr: true},
+		{input: "poly 0.1 0.1 0.9 0.1 0.5 0.9 width=1e9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewCommandProcessor(NewArtboardState()).ProcessCommands(bytes.NewBufferString(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPrimitive_RoundTrip(t *testing.T) {
+	script := "white\n" +
+		"line 0.1 0.1 0.9 0.5 width=3 #ff000088\n" +
+		"circle 0.5 0.5 0.25\n" +
+		"ellipse 0.5 0.5 0.25 0.1 width=2 src\n" +
+		"arc 0.5 0.5 0.25 0.25 -90 90 #0000ffff\n" +
+		"poly 0.1 0.1 0.9 0.1 0.5 0.9\n"
+
+	as := checkRoundTrip(t, script)
+	for _, script := range []string{
+		"circle 0.5 0.5 4\n",
+		"line -4 -4 4 4 width=8192\n",
+		"poly -4 -4 4 -4 4 4 #00000000\n",
+	} {
+		checkRoundTrip(t, script)
+	}
+
+	// A circle on a canvas that is not square becomes an ellipse.
+	as.ResizeArtboard(image.Pt(400, 800))
+	if p := as.Primitives[1]; p.Radii != image.Pt(100, 200) || p.Points[0] != image.Pt(200, 400) {
+		t.Errorf("resize did not scale the circle: %+v", p)
+	}
+	if got, _ := as.MarshalScript(); !bytes.Contains(got, []byte("\ncircle 0.5 0.5 0.25\n")) {
+		t.Errorf("resized circle was not kept: %q", got)
+	}
+}
+
+func TestPrimitive_Snapshot(t *testing.T) {
+	img := snapshotScript(t, "white,circle 0.5 0.5 0.1 #f00,line 0 0.9 1 0.9 width=4")
+
+	// The circle center, a pixel of the line and the background.
+	checkPixels(t, img, map[image.Point]color.RGBA{{400, 400}: {R: 255, A: 255}, {400, 720}: {B: 255, A: 255}, {400, 600}: {255, 255, 255, 255}})
+}
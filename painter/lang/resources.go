@@ -0,0 +1,463 @@
+package lang
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// ResourceHandler exposes the artboard as REST resources: /shapes, /shapes/{id}, /background and /rectangle.
+// Every representation carries an ETag, and writes honour If-Match for optimistic concurrency.
+func ResourceHandler(loop *painter.EventLoop, as *ArtboardState) http.Handler {
+	res := &resources{loop: loop, artboard: as}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /shapes", res.listShapes)
+	mux.HandleFunc("POST /shapes", res.createShape)
+	mux.HandleFunc("GET /shapes/{id}", res.getShape)
+	mux.HandleFunc("PATCH /shapes/{id}", res.patchShape)
+	mux.HandleFunc("DELETE /shapes/{id}", res.deleteShape)
+	mux.HandleFunc("GET /background", res.getBackground)
+	mux.HandleFunc("PUT /background", res.putBackground)
+	mux.HandleFunc("DELETE /background", res.deleteBackground)
+	mux.HandleFunc("GET /rectangle", res.getRectangle)
+	mux.HandleFunc("PUT /rectangle", res.putRectangle)
+	mux.HandleFunc("DELETE /rectangle", res.deleteRectangle)
+	return mux
+}
+
+type resources struct {
+	loop     *painter.EventLoop
+	artboard *ArtboardState
+}
+
+type backgroundJSON struct {
+	Color string `json:"color"`
+}
+
+type shapePatchJSON struct {
+	X         *float64 `json:"x"`
+	Y         *float64 `json:"y"`
+	Kind      *string  `json:"kind"`
+	Size      *int     `json:"size"`
+	Rotation  *float64 `json:"rotation"`
+	Color     *string  `json:"color"`
+	Stroke    *string  `json:"stroke"`
+	Width     *float64 `json:"width"`
+	Composite *string  `json:"composite"`
+
+	Transform *[6]float64 `json:"transform"`
+}
+
+func (res *resources) listShapes(rw http.ResponseWriter, r *http.Request) {
+	var list []shapeJSON
+	res.artboard.View(func(as *ArtboardState) {
+		list = shapeList(as)
+	})
+	writeResource(rw, http.StatusOK, list)
+}
+
+func (res *resources) createShape(rw http.ResponseWriter, r *http.Request) {
+	var body shapePatchJSON
+	if !decodeBody(rw, r, &body) {
+		return
+	}
+	if body.X == nil || body.Y == nil {
+		writeError(rw, http.StatusUnprocessableEntity, "shape requires x and y")
+		return
+	}
+
+	var created shapeJSON
+	err := res.update(func(tx *ArtboardState) error {
+		if err := checkIfMatch(r, shapeList(tx)); err != nil {
+			return err
+		}
+		if err := checkCoordinates(*body.X, *body.Y); err != nil {
+			return &statusError{http.StatusUnprocessableEntity, err.Error()}
+		}
+		shape := &painter.BasicShape{CenterX: denormalize(*body.X, tx.canvasSize().X), CenterY: denormalize(*body.Y, tx.canvasSize().Y)}
+		if err := styleShape(shape, body, tx.canvasSize()); err != nil {
+			return &statusError{http.StatusUnprocessableEntity, err.Error()}
+		}
+		id := tx.PlaceShape(shape)
+		created = shapeResource(tx.FindShape(id), tx.canvasSize())
+		return nil
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+
+	rw.Header().Set("Location", fmt.Sprintf("/shapes/%d", created.ID))
+	writeResource(rw, http.StatusCreated, created)
+}
+
+func (res *resources) getShape(rw http.ResponseWriter, r *http.Request) {
+	var (
+		shape shapeJSON
+		err   error
+	)
+	res.artboard.View(func(as *ArtboardState) {
+		var fig *Figure
+		if fig, err = lookupShape(as, r); err == nil {
+			shape = shapeResource(fig, as.canvasSize())
+		}
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	writeResource(rw, http.StatusOK, shape)
+}
+
+func (res *resources) patchShape(rw http.ResponseWriter, r *http.Request) {
+	var body shapePatchJSON
+	if !decodeBody(rw, r, &body) {
+		return
+	}
+
+	var patched shapeJSON
+	err := res.update(func(tx *ArtboardState) error {
+		fig, err := lookupShape(tx, r)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, shapeResource(fig, tx.canvasSize())); err != nil {
+			return err
+		}
+		for _, v := range []*float64{body.X, body.Y} {
+			if v == nil {
+				continue
+			}
+			if err := checkCoordinates(*v); err != nil {
+				return &statusError{http.StatusUnprocessableEntity, err.Error()}
+			}
+		}
+		if body.X != nil {
+			fig.CenterX = denormalize(*body.X, tx.canvasSize().X)
+		}
+		if body.Y != nil {
+			fig.CenterY = denormalize(*body.Y, tx.canvasSize().Y)
+		}
+		if err := styleShape(fig.BasicShape, body, tx.canvasSize()); err != nil {
+			return &statusError{http.StatusUnprocessableEntity, err.Error()}
+		}
+		patched = shapeResource(fig, tx.canvasSize())
+		return nil
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	writeResource(rw, http.StatusOK, patched)
+}
+
+func (res *resources) deleteShape(rw http.ResponseWriter, r *http.Request) {
+	err := res.update(func(tx *ArtboardState) error {
+		fig, err := lookupShape(tx, r)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, shapeResource(fig, tx.canvasSize())); err != nil {
+			return err
+		}
+		tx.RemoveShape(fig.ID)
+		return nil
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (res *resources) getBackground(rw http.ResponseWriter, r *http.Request) {
+	var (
+		bg  backgroundJSON
+		err error
+	)
+	res.artboard.View(func(as *ArtboardState) {
+		bg, err = backgroundResource(as)
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	writeResource(rw, http.StatusOK, bg)
+}
+
+func (res *resources) putBackground(rw http.ResponseWriter, r *http.Request) {
+	var body backgroundJSON
+	if !decodeBody(rw, r, &body) {
+		return
+	}
+	c, g, err := parseFill(body.Color)
+	if err != nil {
+		writeError(rw, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	var bg backgroundJSON
+	err = res.update(func(tx *ArtboardState) error {
+		if current, err := backgroundResource(tx); err == nil {
+			if err := checkIfMatch(r, current); err != nil {
+				return err
+			}
+		}
+		tx.configureBackgroundFill(c, g)
+		bg, _ = backgroundResource(tx)
+		return nil
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	writeResource(rw, http.StatusOK, bg)
+}
+
+func (res *resources) deleteBackground(rw http.ResponseWriter, r *http.Request) {
+	err := res.update(func(tx *ArtboardState) error {
+		current, err := backgroundResource(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, current); err != nil {
+			return err
+		}
+		tx.ConfigureBackground(nil)
+		return nil
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (res *resources) getRectangle(rw http.ResponseWriter, r *http.Request) {
+	var (
+		rect rectangleJSON
+		err  error
+	)
+	res.artboard.View(func(as *ArtboardState) {
+		rect, err = rectangleResource(as)
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	writeResource(rw, http.StatusOK, rect)
+}
+
+func (res *resources) putRectangle(rw http.ResponseWriter, r *http.Request) {
+	var body rectangleJSON
+	if !decodeBody(rw, r, &body) {
+		return
+	}
+	c, g, err := parseFill(body.Color)
+	if err != nil {
+		writeError(rw, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	op, err := parseCompositeMode(body.Composite)
+	if err != nil {
+		writeError(rw, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	var rect rectangleJSON
+	err = res.update(func(tx *ArtboardState) error {
+		if current, err := rectangleResource(tx); err == nil {
+			if err := checkIfMatch(r, current); err != nil {
+				return err
+			}
+		}
+		if err := checkCoordinates(body.X1, body.Y1, body.X2, body.Y2); err != nil {
+			return &statusError{http.StatusUnprocessableEntity, err.Error()}
+		}
+		size := tx.canvasSize()
+		tx.DefineRectangle(image.Rect(denormalize(body.X1, size.X), denormalize(body.Y1, size.Y), denormalize(body.X2, size.X), denormalize(body.Y2, size.Y)), c)
+		tx.Rectangle.Op = op
+		tx.Rectangle.Gradient = g
+		rect, _ = rectangleResource(tx)
+		return nil
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	writeResource(rw, http.StatusOK, rect)
+}
+
+func (res *resources) deleteRectangle(rw http.ResponseWriter, r *http.Request) {
+	err := res.update(func(tx *ArtboardState) error {
+		current, err := rectangleResource(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, current); err != nil {
+			return err
+		}
+		tx.Rectangle = nil
+		return nil
+	})
+	if err != nil {
+		writeFailure(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// update applies fn as one artboard transaction and enqueues the refreshed artboard on success.
+func (res *resources) update(fn func(tx *ArtboardState) error) error {
+	_, err := res.artboard.Update(res.loop, func(tx *ArtboardState) ([]painter.TextureOperation, error) {
+		if err := fn(tx); err != nil {
+			return nil, err
+		}
+		return tx.RefreshArtboard(), nil
+	})
+	return err
+}
+
+// statusError is an error that maps to a specific HTTP status code.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string { return e.message }
+
+func lookupShape(as *ArtboardState, r *http.Request) (*Figure, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, &statusError{http.StatusBadRequest, "shape id must be an integer"}
+	}
+
+	fig := as.FindShape(id)
+	if fig == nil {
+		return nil, &statusError{http.StatusNotFound, fmt.Sprintf("shape %d not found", id)}
+	}
+	return fig, nil
+}
+
+func shapeList(as *ArtboardState) []shapeJSON {
+	list := make([]shapeJSON, 0, len(as.Shapes))
+	for _, fig := range as.Shapes {
+		list = append(list, shapeResource(fig, as.canvasSize()))
+	}
+	return list
+}
+
+func backgroundResource(as *ArtboardState) (backgroundJSON, error) {
+	if as.Background == nil && as.BackgroundGradient == nil {
+		return backgroundJSON{}, &statusError{http.StatusNotFound, "background is not set"}
+	}
+	return backgroundJSON{Color: formatFill(as.Background, as.BackgroundGradient)}, nil
+}
+
+func rectangleResource(as *ArtboardState) (rectangleJSON, error) {
+	if as.Rectangle == nil {
+		return rectangleJSON{}, &statusError{http.StatusNotFound, "rectangle is not set"}
+	}
+	b, size := as.Rectangle.Bounds, as.canvasSize()
+	return rectangleJSON{
+		X1:        normalize(b.Min.X, size.X),
+		Y1:        normalize(b.Min.Y, size.Y),
+		X2:        normalize(b.Max.X, size.X),
+		Y2:        normalize(b.Max.Y, size.Y),
+		Color:     formatFill(as.Rectangle.Color, as.Rectangle.Gradient),
+		Composite: formatCompositeMode(as.Rectangle.Op),
+	}, nil
+}
+
+func shapeResource(fig *Figure, size image.Point) shapeJSON {
+	s := shapeJSON{ID: fig.ID, X: normalize(fig.CenterX, size.X), Y: normalize(fig.CenterY, size.Y), Size: fig.Size, Rotation: fig.Rotation}
+	if fig.Kind != painter.Cross {
+		s.Kind = formatShapeKind(fig.Kind)
+	}
+	if fig.Color != nil || fig.Gradient != nil {
+		s.Color = formatFill(fig.Color, fig.Gradient)
+	}
+	if fig.Stroke != nil {
+		s.Stroke = formatColor(fig.Stroke)
+		s.Width = fig.StrokeWidth
+	}
+	if !fig.Transform.IsIdentity() {
+		m := affineValues(fig.Transform, size)
+		s.Transform = &m
+	}
+	s.Composite = formatCompositeMode(fig.Op)
+	if fig.Label != nil {
+		label := labelResource(fig.Label)
+		s.Label = &label
+	}
+	s.Clip = clipResources(fig.Clips, size)
+	return s
+}
+
+// etag derives a strong entity tag from the JSON representation of a resource.
+func etag(v any) string {
+	data, _ := json.Marshal(v)
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// checkIfMatch validates the If-Match precondition against the current representation of a resource.
+func checkIfMatch(r *http.Request, current any) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	tag := etag(current)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return nil
+		}
+	}
+	return &statusError{http.StatusPreconditionFailed, "resource has been modified"}
+}
+
+func decodeBody(rw http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(rw, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeResource(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("ETag", etag(v))
+	writeJSON(rw, status, v)
+}
+
+// writeFailure reports err with the status it carries, or as an internal error if it carries none.
+func writeFailure(rw http.ResponseWriter, err error) {
+	var se *statusError
+	if errors.As(err, &se) {
+		writeError(rw, se.status, se.message)
+		return
+	}
+	writeError(rw, http.StatusInternalServerError, err.Error())
+}
+
+func writeError(rw http.ResponseWriter, status int, message string) {
+	writeJSON(rw, status, map[string]string{"error": message})
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,64 @@
+package lang
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestResourceHandler_Shapes(t *testing.T) {
+	var loop painter.EventLoop
+	as := NewArtboardState()
+	handler := ResourceHandler(&loop, as)
+
+	do := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	created := do(http.MethodPost, "/shapes", `{"x":0.5,"y":0.25}`, nil)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("POST /shapes status = %d, body %s", created.Code, created.Body)
+	}
+	if loc := created.Header().Get("Location"); loc != "/shapes/1" {
+		t.Errorf("POST /shapes Location = %q", loc)
+	}
+	if fig := as.FindShape(1); fig == nil || fig.CenterX != 400 || fig.CenterY != 200 {
+		t.Errorf("shape was not placed on the artboard: %+v", fig)
+	}
+
+	tag := created.Header().Get("ETag")
+	moved := do(http.MethodPatch, "/shapes/1", `{"x":0.1}`, http.Header{"If-Match": {tag}})
+	if moved.Code != http.StatusOK {
+		t.Fatalf("PATCH /shapes/1 status = %d, body %s", moved.Code, moved.Body)
+	}
+	if as.FindShape(1).CenterX != 80 {
+		t.Error("PATCH did not move the shape")
+	}
+
+	stale := do(http.MethodDelete, "/shapes/1", "", http.Header{"If-Match": {tag}})
+	if stale.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with stale ETag status = %d", stale.Code)
+	}
+	if ct := stale.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("error Content-Type = %q", ct)
+	}
+
+	if rec := do(http.MethodDelete, "/shapes/1", "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /shapes/1 status = %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/shapes/1", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted shape status = %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/background", `{"color":"nope"}`, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT /background with invalid color status = %d", rec.Code)
+	}
+}
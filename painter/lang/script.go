@@ -0,0 +1,119 @@
+package lang
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/draw"
+	"strconv"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// MarshalScript encodes the artboard as a minimal script in the command language accepted by ProcessCommands.
+// Processing the result against a fresh ArtboardState renders the same picture as the original state.
+func (as *ArtboardState) MarshalScript() ([]byte, error) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	var buf bytes.Buffer
+	size := as.canvasSize()
+
+	if as.BackgroundGradient != nil {
+		buf.WriteString("bg " + formatGradient(as.BackgroundGradient) + "\n")
+	} else if as.Background != nil {
+		switch {
+		case sameColor(as.Background, color.Black):
+			buf.WriteString("reset\n")
+		case sameColor(as.Background, color.White):
+			buf.WriteString("white\n")
+		case sameColor(as.Background, greenColor):
+			buf.WriteString("green\n")
+		default:
+			buf.WriteString("bg " + formatColor(as.Background) + "\n")
+		}
+	}
+
+	// Objects are written under the clips they were placed with, which are switched between them.
+	var clips *ClipStack
+	if r := as.Rectangle; r != nil && !r.Bounds.Empty() {
+		clips = writeClips(&buf, clips, r.Clips, size)
+		fmt.Fprintf(&buf, "bgrect %s %s %s %s",
+			formatCoordinate(r.Bounds.Min.X, size.X), formatCoordinate(r.Bounds.Min.Y, size.Y),
+			formatCoordinate(r.Bounds.Max.X, size.X), formatCoordinate(r.Bounds.Max.Y, size.Y))
+		var c color.Color
+		if r.Color != nil && !sameColor(r.Color, rectangleColor) {
+			c = r.Color
+		}
+		writeGradient(&buf, r.Gradient)
+		writeStyle(&buf, c, r.Op)
+	}
+
+	for _, p := range as.Primitives {
+		clips = writeClips(&buf, clips, p.Clips, size)
+		// Transformed primitives are drawn with their transform as the canvas transform.
+		if !p.Transform.IsIdentity() {
+			buf.WriteString("push\ntransform")
+			writeAffine(&buf, p.Transform, size)
+			buf.WriteByte('\n')
+		}
+		if p.Kind == "path" {
+			writePath(&buf, p.Path)
+		} else if err := writePrimitive(&buf, p, size); err != nil {
+			return nil, err
+		}
+		if !p.Transform.IsIdentity() {
+			buf.WriteString("pop\n")
+		}
+	}
+
+	for _, shape := range as.Shapes {
+		clips = writeClips(&buf, clips, shape.Clips, size)
+		writeFigure(&buf, shape.BasicShape, size)
+	}
+	writeClips(&buf, clips, nil, size)
+
+	// Figures processed against a fresh artboard are numbered from one in the order they are placed.
+	for i, shape := range as.Shapes {
+		if shape.Transform.IsIdentity() {
+			continue
+		}
+		fmt.Fprintf(&buf, "transform @%d", i+1)
+		writeAffine(&buf, shape.Transform, size)
+		buf.WriteByte('\n')
+	}
+	for i, shape := range as.Shapes {
+		if shape.Label == nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "text @%d", i+1)
+		if err := writeLabel(&buf, shape.Label, painter.AlignCenter); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeStyle ends a drawing command with its optional color and composite mode arguments. A nil color is omitted.
+func writeStyle(buf *bytes.Buffer, c color.Color, op draw.Op) {
+	if c != nil {
+		buf.WriteString(" " + formatColor(c))
+	}
+	if mode := formatCompositeMode(op); mode != "" {
+		buf.WriteString(" " + mode)
+	}
+	buf.WriteByte('\n')
+}
+
+// writeGradient writes the gradient argument of a drawing command, if there is a gradient.
+func writeGradient(buf *bytes.Buffer, g painter.Gradient) {
+	if g != nil {
+		buf.WriteString(" " + formatGradient(g))
+	}
+}
+
+// formatCoordinate is the inverse of convertToCoordinates for a single value.
+func formatCoordinate(px, extent int) string {
+	return strconv.FormatFloat(normalize(px, extent), 'f', -1, 64)
+}
@@ -0,0 +1,158 @@
+package lang
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/image/draw"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestArtboardState_MarshalScript(t *testing.T) {
+	as := NewArtboardState()
+	as.ConfigureBackground(greenColor)
+	as.DefineRectangle(image.Rect(40, 40, 760, 760), rectangleColor)
+	as.PlaceShape(&painter.BasicShape{CenterX: 400, CenterY: 80})
+
+	got, err := as.MarshalScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "green\nbgrect 0.05 0.05 0.95 0.95\nfigure 0.5 0.1\n"
+	if string(got) != want {
+		t.Errorf("MarshalScript() got = %q, want %q", got, want)
+	}
+
+	as.Rectangle.Color = color.NRGBA{R: 255, G: 255, A: 64}
+	as.Rectangle.Op = draw.Src
+	as.Shapes[0].Color = color.NRGBA{G: 255, A: 128}
+	if got, _ = as.MarshalScript(); string(got) != "green\nbgrect 0.05 0.05 0.95 0.95 #ffff0040 src\nfigure 0.5 0.1 #00ff0080\n" {
+		t.Errorf("MarshalScript() with colors got = %q", got)
+	}
+}
+
+func TestArtboardState_MarshalScript_RoundTrip(t *testing.T) {
+	backgrounds := []color.Color{nil, color.Black, color.White, greenColor}
+
+	styles := []struct {
+		c  color.Color
+		op draw.Op
+	}{{nil, draw.Over}, {color.NRGBA{R: 10, G: 20, B: 30, A: 40}, draw.Over}, {color.NRGBA{B: 255, A: 0}, draw.Src}}
+
+	// Coordinates range over the pixels of maxCoordinate canvases on both sides of the origin.
+	pixel := func(v int16) int {
+		return int(v) % (maxCoordinate*painter.DefaultCanvasSize.X + 1)
+	}
+	roundTrip := func(bg uint8, withRect bool, x1, y1, x2, y2 int16, centers []int16, style uint8) bool {
+		st := styles[int(style)%len(styles)]
+		original := NewArtboardState()
+		original.ConfigureBackground(backgrounds[int(bg)%len(backgrounds)])
+		if withRect {
+			original.DefineRectangle(image.Rect(pixel(x1), pixel(y1), pixel(x2), pixel(y2)), rectangleColor)
+			if st.c != nil {
+				original.Rectangle.Color, original.Rectangle.Op = st.c, st.op
+			}
+		}
+		for i := 0; i+1 < len(centers); i += 2 {
+			original.PlaceShape(&painter.BasicShape{CenterX: pixel(centers[i]), CenterY: pixel(centers[i+1]), Color: st.c, Op: st.op})
+		}
+
+		script, err := original.MarshalScript()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		parsed := NewArtboardState()
+		if _, err := NewCommandProcessor(parsed).ProcessCommands(bytes.NewReader(script)); err != nil {
+			t.Logf("%s: %s", script, err)
+			return false
+		}
+
+		return reflect.DeepEqual(render(original), render(parsed))
+	}
+
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+
+	// Scripts with coordinates that are not finite or too far away are rejected instead of stored as pixels that
+	// would be written back differently.
+	special := []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1e300, -maxCoordinate - 1e-9, maxCoordinate + 0.5}
+	parse := func(x, y float64, pick uint8) bool {
+		// Random floats are mostly huge, so they are scaled into the bounds and replaced by special values in turn.
+		x, y = math.Mod(x, 2*maxCoordinate), math.Mod(y, 2*maxCoordinate)
+		if i := int(pick) % (2 * len(special)); i < len(special) {
+			x = special[i]
+		}
+		script := fmt.Sprintf("figure %v %v\nbgrect %v 0 0.5 %v\n", x, y, y, x)
+		parsed := NewArtboardState()
+		_, err := NewCommandProcessor(parsed).ProcessCommands(bytes.NewBufferString(script))
+		if valid := checkCoordinates(x, y) == nil; !valid {
+			return err != nil
+		} else if err != nil {
+			t.Logf("%s: %s", script, err)
+			return false
+		}
+
+		written, _ := parsed.MarshalScript()
+		reparsed := NewArtboardState()
+		if _, err := NewCommandProcessor(reparsed).ProcessCommands(bytes.NewReader(written)); err != nil {
+			t.Logf("%s: %s", written, err)
+			return false
+		}
+		again, _ := reparsed.MarshalScript()
+		return bytes.Equal(written, again)
+	}
+	if err := quick.Check(parse, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// render applies the artboard operations to a recording texture and returns the visible fills.
+func render(as *ArtboardState) []fillCall {
+	var tx recordingTexture
+	for _, op := range as.RefreshArtboard() {
+		op.Apply(&tx)
+	}
+	return tx.fills
+}
+
+type fillCall struct {
+	rect       image.Rectangle
+	r, g, b, a uint32
+	op         draw.Op
+}
+
+type recordingTexture struct {
+	fills []fillCall
+}
+
+func (rt *recordingTexture) Release() {}
+
+func (rt *recordingTexture) Size() image.Point { return painter.DefaultCanvasSize }
+
+func (rt *recordingTexture) Bounds() image.Rectangle {
+	return image.Rectangle{Max: rt.Size()}
+}
+
+func (rt *recordingTexture) Upload(image.Point, screen.Buffer, image.Rectangle) {
+	panic("implement me")
+}
+
+func (rt *recordingTexture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
+	if dr.Empty() {
+		return
+	}
+	r, g, b, a := src.RGBA()
+	rt.fills = append(rt.fills, fillCall{rect: dr, r: r, g: g, b: b, a: a, op: op})
+}
@@ -0,0 +1,111 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+var shapeKinds = []string{
+	painter.Cross:    "cross",
+	painter.Square:   "square",
+	painter.Circle:   "circle",
+	painter.Triangle: "triangle",
+	painter.Star:     "star",
+	painter.Arrow:    "arrow",
+}
+
+func parseShapeKind(s string) (painter.ShapeKind, error) {
+	for kind, name := range shapeKinds {
+		if name == s {
+			return painter.ShapeKind(kind), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown figure kind %q", s)
+}
+
+func formatShapeKind(kind painter.ShapeKind) string {
+	if int(kind) < len(shapeKinds) {
+		return shapeKinds[kind]
+	}
+	return shapeKinds[painter.Cross]
+}
+
+// parseFigure parses the arguments of the figure command: the center, an optional kind, then size=N in pixels,
+// rotate=DEG, stroke=COLOR with width=N and the style of the other drawing commands.
+func parseFigure(args []string, size image.Point) (*painter.BasicShape, error) {
+	if len(args) < 2 {
+		return nil, errors.New("figure command expects two arguments")
+	}
+	center, err := convertToCoordinates(args[:2], size)
+	if err != nil {
+		return nil, err
+	}
+	shape := &painter.BasicShape{CenterX: center[0], CenterY: center[1]}
+
+	args = args[2:]
+	if len(args) > 0 {
+		if kind, err := parseShapeKind(args[0]); err == nil {
+			shape.Kind = kind
+			args = args[1:]
+		}
+	}
+
+	var style []string
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		switch name {
+		case "size":
+			if shape.Size, err = strconv.Atoi(value); err != nil || shape.Size <= 0 || shape.Size > MaxCanvasDimension {
+				return nil, fmt.Errorf("invalid size %q", value)
+			}
+		case "rotate":
+			if shape.Rotation, err = parseFinite(value); err != nil {
+				return nil, fmt.Errorf("invalid rotation %q", value)
+			}
+		case "stroke":
+			if shape.Stroke, err = parseColor(value); err != nil {
+				return nil, err
+			}
+		default:
+			style = append(style, arg)
+		}
+	}
+
+	s, err := parseStyle(style, true)
+	if err != nil {
+		return nil, err
+	}
+	if s.width != 0 && shape.Stroke == nil {
+		return nil, errors.New("width requires a stroke color")
+	}
+	shape.Color, shape.Gradient, shape.Op, shape.StrokeWidth = s.color, s.gradient, s.op, s.width
+	return shape, nil
+}
+
+// writeFigure writes the figure command that places the shape.
+func writeFigure(buf *bytes.Buffer, shape *painter.BasicShape, size image.Point) {
+	fmt.Fprintf(buf, "figure %s %s", formatCoordinate(shape.CenterX, size.X), formatCoordinate(shape.CenterY, size.Y))
+	if shape.Kind != painter.Cross {
+		buf.WriteString(" " + formatShapeKind(shape.Kind))
+	}
+	if shape.Size != 0 {
+		fmt.Fprintf(buf, " size=%d", shape.Size)
+	}
+	if shape.Rotation != 0 {
+		buf.WriteString(" rotate=" + formatFloat(shape.Rotation))
+	}
+	if shape.Stroke != nil {
+		buf.WriteString(" stroke=" + formatColor(shape.Stroke))
+		if shape.StrokeWidth != 0 {
+			buf.WriteString(" width=" + formatFloat(shape.StrokeWidth))
+		}
+	}
+	writeGradient(buf, shape.Gradient)
+	writeStyle(buf, shape.Color, shape.Op)
+}
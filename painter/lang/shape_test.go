@@ -0,0 +1,86 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestFigure_Command(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    painter.BasicShape
+		wantErr bool
+	}{
+		{input: "figure 0.5 0.5", want: painter.BasicShape{CenterX: 400, CenterY: 400}},
+		{input: "figure 0.5 0.5 #f00", want: painter.BasicShape{CenterX: 400, CenterY: 400, Color: color.NRGBA{R: 255, A: 255}}},
+		{input: "figure 0.5 0.5 star size=40 rotate=15", want: painter.BasicShape{Kind: painter.Star, CenterX: 400, CenterY: 400, Size: 40, Rotation: 15}},
+		{input: "figure 0.5 0.5 circle stroke=#000 width=3 src", want: painter.BasicShape{Kind: painter.Circle, CenterX: 400, CenterY: 400, Stroke: color.NRGBA{A: 255}, StrokeWidth: 3, Op: draw.Src}},
+		{input: "figure 0.5 0.5 hexagon", wantErr: true},
+		{input: "figure 0.5 0.5 square size=0", wantErr: true},
+		{input: "figure 0.5 0.5 square rotate=up", wantErr: true},
+		{input: "figure 0.5 0.5 square rotate=NaN", wantErr: true},
+		{input: "figure 0.5 0.5 square rotate=-Inf", wantErr: true},
+		{input: "figure 0.5 0.5 width=2", wantErr: true},
+		{input: "figure 0.5 0.5 square stroke=#000000ff width=1e40", wantErr: true},
+		{input: "figure 0.5 0.5 stroke=#000000ff width=1e300", wantErr: true},
+		{input: "figure 0.5 0.5 stroke=#000000ff width=NaN", wantErr: true},
+		{input: "figure 0.5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		as := NewArtboardState()
+		_, err := NewCommandProcessor(as).ProcessCommands(bytes.NewBufferString(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := *as.Shapes[0].BasicShape
+		if got.Kind != tt.want.Kind || got.CenterX != tt.want.CenterX || got.CenterY != tt.want.CenterY ||
+			got.Size != tt.want.Size || got.Rotation != tt.want.Rotation || got.StrokeWidth != tt.want.StrokeWidth ||
+			got.Op != tt.want.Op || !sameOptionalColor(got.Color, tt.want.Color) || !sameOptionalColor(got.Stroke, tt.want.Stroke) {
+			t.Errorf("%q: figure is %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFigure_RoundTrip(t *testing.T) {
+	script := "figure 0.25 0.25\n" +
+		"figure 0.5 0.25 square size=50 rotate=30 #ff0000ff\n" +
+		"figure 0.75 0.25 circle stroke=#000000ff width=2.5\n" +
+		"figure 0.25 0.75 triangle stroke=#00ff00ff src\n" +
+		"figure 0.5 0.75 star size=80 linear(90deg, #ff0000ff 0, #0000ffff 1)\n" +
+		"figure 0.75 0.75 arrow rotate=-90\n"
+
+	checkRoundTrip(t, script)
+	for _, script := range []string{
+		"figure 4 -4 star size=8192 rotate=-359.5 stroke=#000000ff width=8192\n",
+	} {
+		checkRoundTrip(t, script)
+	}
+}
+
+func TestFigure_WideStroke(t *testing.T) {
+	// The outline of the widest stroke reaches far beyond the canvas; drawing it must not take long.
+	img := snapshotScript(t, "white,figure 0.5 0.5 square stroke=#000000ff width=8192")
+	checkPixels(t, img, map[image.Point]color.RGBA{{0, 0}: {A: 255}, {799, 799}: {A: 255}})
+
+	if err := json.Unmarshal([]byte(`{"shapes":[{"x":0.5,"y":0.5,"stroke":"#000000ff","width":1e40}]}`), NewArtboardState()); err == nil {
+		t.Error("huge stroke width was accepted")
+	}
+}
+
+func sameOptionalColor(a, b color.Color) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return sameColor(a, b)
+}
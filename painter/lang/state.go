@@ -1,52 +1,206 @@
 package lang
 
 import (
+	"image"
 	"image/color"
+	"image/draw"
+	"math"
+	"sync"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
+var (
+	greenColor     = color.RGBA{R: 0, G: 128, B: 0, A: 255}
+	rectangleColor = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+)
+
+// Rectangle describes the background rectangle in artboard pixels.
+type Rectangle struct {
+	Bounds image.Rectangle
+	Color  color.Color
+	Op     draw.Op // Composite operator; the zero value, draw.Over, blends translucent colors
+
+	// Gradient, if set, is drawn instead of Color.
+	Gradient painter.Gradient
+	// Clips limit the rectangle to where they overlap.
+	Clips *ClipStack
+}
+
+// Figure is a shape placed on the artboard under a stable identifier.
+type Figure struct {
+	ID int
+	*painter.BasicShape
+
+	// Label, if set, is drawn centered under the shape and follows it when it moves.
+	Label *Label
+	// Clips limit the figure and its label to where they overlap. They stay in place when the figure moves.
+	Clips *ClipStack
+}
+
+// ArtboardState describes what is drawn on the artboard. The mutating methods are not synchronized themselves;
+// use Update and View to access a state that is shared between goroutines.
 type ArtboardState struct {
-	Background painter.TextureFunc
-	Rectangle  painter.TextureFunc
-	Shapes     []*painter.Shape
+	Background color.Color
+	// BackgroundGradient, if set, fills the canvas instead of Background.
+	BackgroundGradient painter.Gradient
+	Rectangle          *Rectangle
+	Shapes             []*Figure
+	Primitives         []*Primitive
+
+	// Size is the canvas size in pixels that normalized coordinates are scaled to, painter.DefaultCanvasSize
+	// if empty. Update keeps it in sync with the event loop.
+	Size image.Point
+
+	// OnUpdate, if set, is called with a read-only snapshot of the state after every successful Update.
+	OnUpdate func(snapshot *ArtboardState)
+	// Assets is the store the blit command draws from; blits are rejected if it is nil.
+	Assets *AssetStore
+
+	lastID int
+	mu     sync.RWMutex
+
+	// transform is the canvas transform that figures and primitives are placed with; transforms holds the ones
+	// saved by PushTransform. They only affect later commands, so they are not encoded.
+	transform  painter.Affine
+	transforms []painter.Affine
+	// clips are the clips that objects are placed with, pushed by PushClip. They are not encoded either.
+	clips *ClipStack
 }
 
 func NewArtboardState() *ArtboardState {
 	return &ArtboardState{}
 }
 
-func (as *ArtboardState) ConfigureBackground(op painter.TextureFunc) {
-	as.Background = op
+func (as *ArtboardState) ConfigureBackground(c color.Color) {
+	as.Background, as.BackgroundGradient = c, nil
+}
+
+// ConfigureBackgroundGradient fills the whole canvas with the gradient instead of a background color.
+func (as *ArtboardState) ConfigureBackgroundGradient(g painter.Gradient) {
+	as.Background, as.BackgroundGradient = nil, g
+}
+
+func (as *ArtboardState) DefineRectangle(bounds image.Rectangle, c color.Color) {
+	as.Rectangle = &Rectangle{Bounds: bounds.Canon(), Color: c}
 }
 
-func (as *ArtboardState) DefineRectangle(op painter.TextureFunc) {
-	as.Rectangle = op
+// configureBackgroundFill sets the background to the gradient if there is one and to the color otherwise.
+func (as *ArtboardState) configureBackgroundFill(c color.Color, g painter.Gradient) {
+	if g != nil {
+		as.ConfigureBackgroundGradient(g)
+	} else {
+		as.ConfigureBackground(c)
+	}
+}
+
+// PlaceShape adds the shape to the artboard and returns the identifier assigned to it.
+func (as *ArtboardState) PlaceShape(s *painter.BasicShape) int {
+	as.lastID++
+	as.Shapes = append(as.Shapes, &Figure{ID: as.lastID, BasicShape: s})
+	return as.lastID
+}
+
+// FindShape returns the figure with the given identifier or nil if there is none.
+func (as *ArtboardState) FindShape(id int) *Figure {
+	for _, fig := range as.Shapes {
+		if fig.ID == id {
+			return fig
+		}
+	}
+	return nil
+}
+
+// RemoveShape deletes the figure with the given identifier and reports whether it was present.
+func (as *ArtboardState) RemoveShape(id int) bool {
+	for i, fig := range as.Shapes {
+		if fig.ID == id {
+			as.Shapes = append(as.Shapes[:i:i], as.Shapes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ResizeArtboard changes the canvas size and scales the rectangle and the shapes so that they keep their
+// normalized positions.
+func (as *ArtboardState) ResizeArtboard(size image.Point) {
+	old := as.canvasSize()
+	clips := make(map[*ClipStack]*ClipStack)
+	scale := func(v, from, to int) int {
+		return int(math.Round(float64(v) * float64(to) / float64(from)))
+	}
+
+	if r := as.Rectangle; r != nil {
+		b := r.Bounds
+		as.Rectangle = &Rectangle{Color: r.Color, Op: r.Op, Gradient: r.Gradient, Clips: rescaleClips(r.Clips, old, size, clips), Bounds: image.Rect(
+			scale(b.Min.X, old.X, size.X), scale(b.Min.Y, old.Y, size.Y),
+			scale(b.Max.X, old.X, size.X), scale(b.Max.Y, old.Y, size.Y))}
+	}
+	for _, fig := range as.Shapes {
+		fig.CenterX = scale(fig.CenterX, old.X, size.X)
+		fig.CenterY = scale(fig.CenterY, old.Y, size.Y)
+		if !fig.Transform.IsIdentity() {
+			// Figures keep their size, only the offset from their center follows the canvas.
+			fig.Transform.E *= float64(size.X) / float64(old.X)
+			fig.Transform.F *= float64(size.Y) / float64(old.Y)
+		}
+		fig.Clips = rescaleClips(fig.Clips, old, size, clips)
+	}
+	for _, p := range as.Primitives {
+		p.scale(old, size)
+		p.Clips = rescaleClips(p.Clips, old, size, clips)
+	}
+	as.transform = rescaleTransform(as.transform, old, size)
+	for i, m := range as.transforms {
+		as.transforms[i] = rescaleTransform(m, old, size)
+	}
+	as.clips = rescaleClips(as.clips, old, size, clips)
+	as.Size = size
 }
 
-func (as *ArtboardState) PlaceShape(s *painter.Shape) {
-	as.Shapes = append(as.Shapes, s)
+// canvasSize returns the canvas size that normalized coordinates are scaled to.
+func (as *ArtboardState) canvasSize() image.Point {
+	if as.Size == (image.Point{}) {
+		return painter.DefaultCanvasSize
+	}
+	return as.Size
 }
 
 func (as *ArtboardState) ClearArtboard() {
-	as.Background = painter.TextureFunc(painter.FillTexture(color.Black))
-	as.Rectangle = painter.DrawRectangle(0, 0, 0, 0, color.RGBA{255, 0, 0, 255})
+	as.ConfigureBackground(color.Black)
+	as.Rectangle = &Rectangle{Color: rectangleColor}
 	as.Shapes = nil
+	as.Primitives = nil
+	as.transform, as.transforms = painter.Affine{}, nil
+	as.clips = nil
 }
 
 func (as *ArtboardState) RefreshArtboard() []painter.TextureOperation {
 	var ops []painter.TextureOperation
 
-	if as.Background != nil {
-		ops = append(ops, as.Background)
+	if as.BackgroundGradient != nil {
+		ops = append(ops, painter.FillGradient(image.Rectangle{Max: as.canvasSize()}, as.BackgroundGradient, draw.Src))
+	} else if as.Background != nil {
+		ops = append(ops, painter.FillTexture(as.Background))
 	}
 
-	if as.Rectangle != nil {
-		ops = append(ops, as.Rectangle)
+	size := as.canvasSize()
+	if r := as.Rectangle; r != nil && r.Gradient != nil {
+		ops = append(ops, clipOperation(painter.FillGradient(r.Bounds, r.Gradient, r.Op), r.Clips, size))
+	} else if r != nil {
+		ops = append(ops, clipOperation(painter.DrawRectangleOp(r.Bounds.Min.X, r.Bounds.Min.Y, r.Bounds.Max.X, r.Bounds.Max.Y, r.Color, r.Op), r.Clips, size))
+	}
+
+	for _, p := range as.Primitives {
+		ops = append(ops, clipOperation(p.Operation(size, as.Assets), p.Clips, size))
 	}
 
 	for _, shape := range as.Shapes {
-		ops = append(ops, shape.DrawShape())
+		ops = append(ops, clipOperation(shape.Draw(), shape.Clips, size))
+		if op := shape.labelOperation(); op != nil {
+			ops = append(ops, clipOperation(op, shape.Clips, size))
+		}
 	}
 
 	ops = append(ops, painter.MarkUpdated)
@@ -54,8 +208,94 @@ func (as *ArtboardState) RefreshArtboard() []painter.TextureOperation {
 	return ops
 }
 
+// Replace makes the artboard an exact copy of other.
+func (as *ArtboardState) Replace(other *ArtboardState) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.replace(other)
+}
+
+func (as *ArtboardState) replace(other *ArtboardState) {
+	as.Background = other.Background
+	as.BackgroundGradient = other.BackgroundGradient
+	as.Rectangle = other.Rectangle
+	as.Shapes = other.Shapes
+	as.Primitives = other.Primitives
+	as.Size = other.Size
+	as.lastID = other.lastID
+	as.transform = other.transform
+	as.transforms = other.transforms
+	as.clips = other.clips
+}
+
+// clone returns a deep copy of the artboard that can be modified without affecting the original.
+func (as *ArtboardState) clone() *ArtboardState {
+	c := &ArtboardState{Background: as.Background, BackgroundGradient: as.BackgroundGradient, Size: as.Size, Assets: as.Assets, lastID: as.lastID}
+	c.transform, c.transforms = as.transform, append([]painter.Affine(nil), as.transforms...)
+	c.clips = as.clips
+	if as.Rectangle != nil {
+		r := *as.Rectangle
+		c.Rectangle = &r
+	}
+	for _, fig := range as.Shapes {
+		s := *fig.BasicShape
+		c.Shapes = append(c.Shapes, &Figure{ID: fig.ID, BasicShape: &s, Label: fig.Label, Clips: fig.Clips})
+	}
+	for _, p := range as.Primitives {
+		c.Primitives = append(c.Primitives, p.clone())
+	}
+	return c
+}
+
+// Update applies fn to a private copy of the artboard while holding the artboard lock. If fn succeeds, the copy
+// becomes the new state and the operations returned by fn are enqueued into loop as one unit before the lock
+// is released, so concurrent updates reach the loop in the order they were applied. If fn fails, the artboard
+// is left untouched. A nil loop only applies the update; otherwise the copy takes its Size from the loop.
+func (as *ArtboardState) Update(loop *painter.EventLoop, fn func(tx *ArtboardState) ([]painter.TextureOperation, error)) ([]painter.TextureOperation, error) {
+	as.mu.Lock()
+
+	tx := as.clone()
+	if loop != nil {
+		tx.Size = loop.CanvasSize()
+	}
+	ops, err := fn(tx)
+	if err != nil {
+		as.mu.Unlock()
+		return nil, err
+	}
+
+	as.replace(tx)
+	if loop != nil && len(ops) > 0 {
+		loop.Enqueue(ops...)
+	}
+	onUpdate := as.OnUpdate
+	as.mu.Unlock()
+
+	// The committed copy shares its data with the artboard, which is never modified in place, so it stays valid.
+	if onUpdate != nil {
+		onUpdate(tx)
+	}
+	return ops, nil
+}
+
+// View calls fn with the artboard locked for reading. fn must not modify the state.
+func (as *ArtboardState) View(fn func(as *ArtboardState)) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	fn(as)
+}
+
 func (as *ArtboardState) RepositionShapes(dx, dy int) {
 	for _, shape := range as.Shapes {
 		shape.Move(dx, dy)
 	}
 }
+
+// sameColor reports whether two colors have identical RGBA values.
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
@@ -0,0 +1,263 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event is a notification published to /events subscribers.
+type Event struct {
+	Type    string          `json:"type"` // "frame", "state", "command" or "error"
+	Frame   uint64          `json:"frame,omitempty"`
+	State   json.RawMessage `json:"state,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// Broadcaster fans out the frames and events of a canvas to stream subscribers. Subscribers that fall behind
+// miss frames and events instead of slowing down the event loop.
+type Broadcaster struct {
+	// OnWatch, if set, is called when the MJPEG stream gets its first subscriber, e.g. to redraw the frame.
+	OnWatch func()
+
+	mu          sync.Mutex
+	frameSubs   map[chan []byte]struct{}
+	eventSubs   map[chan Event]struct{}
+	lastFrame   []byte
+	pending     *image.RGBA
+	pendingCh   chan struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+	jpegQuality int
+}
+
+// NewBroadcaster creates a broadcaster and starts its frame encoder. Call Close to stop it.
+func NewBroadcaster() *Broadcaster {
+	b := &Broadcaster{
+		frameSubs:   make(map[chan []byte]struct{}),
+		eventSubs:   make(map[chan Event]struct{}),
+		pendingCh:   make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+		jpegQuality: 80,
+	}
+	go b.encode()
+	return b
+}
+
+// PresentFrame records a presented frame. The pixels are copied only when someone watches the MJPEG stream,
+// and encoding happens on a separate goroutine where newer frames replace ones that were not encoded yet.
+func (b *Broadcaster) PresentFrame(frame uint64, pixels *image.RGBA) {
+	b.Publish(Event{Type: "frame", Frame: frame})
+
+	b.mu.Lock()
+	watched := len(b.frameSubs) > 0
+	b.mu.Unlock()
+	if !watched || pixels == nil {
+		return
+	}
+
+	snapshot := image.NewRGBA(pixels.Rect)
+	copy(snapshot.Pix, pixels.Pix)
+
+	b.mu.Lock()
+	b.pending = snapshot
+	b.mu.Unlock()
+
+	select {
+	case b.pendingCh <- struct{}{}:
+	default:
+	}
+}
+
+// Publish sends the event to all event subscribers, dropping it for those whose buffer is full.
+func (b *Broadcaster) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.eventSubs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// SubscribeFrames returns a channel of JPEG encoded frames and a function that cancels the subscription.
+func (b *Broadcaster) SubscribeFrames() (<-chan []byte, func()) {
+	ch := make(chan []byte, 1)
+
+	b.mu.Lock()
+	first := len(b.frameSubs) == 0
+	b.frameSubs[ch] = struct{}{}
+	if b.lastFrame != nil {
+		ch <- b.lastFrame
+	}
+	onWatch := b.OnWatch
+	b.mu.Unlock()
+
+	if first && onWatch != nil {
+		onWatch()
+	}
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.frameSubs, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Watched reports whether the MJPEG stream has subscribers.
+func (b *Broadcaster) Watched() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.frameSubs) > 0
+}
+
+// SubscribeEvents returns a channel of events and a function that cancels the subscription.
+func (b *Broadcaster) SubscribeEvents() (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	b.mu.Lock()
+	b.eventSubs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.eventSubs, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Close stops the encoder and ends all streams.
+func (b *Broadcaster) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+}
+
+// Done is closed when the broadcaster is closed.
+func (b *Broadcaster) Done() <-chan struct{} {
+	return b.closed
+}
+
+func (b *Broadcaster) encode() {
+	for {
+		select {
+		case <-b.closed:
+			return
+		case <-b.pendingCh:
+		}
+
+		b.mu.Lock()
+		img := b.pending
+		b.pending = nil
+		b.mu.Unlock()
+		if img == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: b.jpegQuality}); err != nil {
+			log.Printf("Error encoding frame: %s", err)
+			continue
+		}
+		data := buf.Bytes()
+
+		b.mu.Lock()
+		b.lastFrame = data
+		for ch := range b.frameSubs {
+			// Replace a frame the subscriber has not taken yet with the newer one.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- data
+		}
+		b.mu.Unlock()
+	}
+}
+
+// MJPEGHandler streams the frames of the broadcaster as multipart/x-mixed-replace JPEG images.
+func MJPEGHandler(b *Broadcaster) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Streams outlive the server write timeout.
+		_ = http.NewResponseController(rw).SetWriteDeadline(time.Time{})
+
+		frames, cancel := b.SubscribeFrames()
+		defer cancel()
+
+		rw.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-b.Done():
+				return
+			case frame := <-frames:
+				_, err := fmt.Fprintf(rw, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
+				if err == nil {
+					_, err = rw.Write(append(frame[:len(frame):len(frame)], '\r', '\n'))
+				}
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// EventsHandler streams the events of the broadcaster as Server-Sent Events.
+func EventsHandler(b *Broadcaster) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Streams outlive the server write timeout.
+		_ = http.NewResponseController(rw).SetWriteDeadline(time.Time{})
+
+		events, cancel := b.SubscribeEvents()
+		defer cancel()
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-b.Done():
+				return
+			case e := <-events:
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
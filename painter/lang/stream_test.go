@@ -0,0 +1,125 @@
+package lang
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/jpeg"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBroadcaster_Frames(t *testing.T) {
+	b := NewBroadcaster()
+	defer b.Close()
+
+	frames, cancel := b.SubscribeFrames()
+	defer cancel()
+
+	pixels := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range pixels.Pix {
+		pixels.Pix[i] = 0xff
+	}
+	b.PresentFrame(1, pixels)
+
+	select {
+	case frame := <-frames:
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _, _, _ := img.At(8, 8).RGBA(); r < 0xf000 {
+			t.Errorf("unexpected pixel %v", img.At(8, 8))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no frame was encoded")
+	}
+}
+
+func TestBroadcaster_Watched(t *testing.T) {
+	b := NewBroadcaster()
+	defer b.Close()
+	watches := 0
+	b.OnWatch = func() { watches++ }
+
+	_, cancelFirst := b.SubscribeFrames()
+	_, cancelSecond := b.SubscribeFrames()
+	if !b.Watched() || watches != 1 {
+		t.Errorf("Watched() = %t with OnWatch called %d times, want once", b.Watched(), watches)
+	}
+	cancelFirst()
+	cancelSecond()
+	if b.Watched() {
+		t.Error("stream is watched without subscribers")
+	}
+}
+
+func TestBroadcaster_SlowEventSubscriber(t *testing.T) {
+	b := NewBroadcaster()
+	defer b.Close()
+
+	events, cancel := b.SubscribeEvents()
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		// Nobody reads the events, so publishing must drop them instead of blocking.
+		for i := 0; i < 100; i++ {
+			b.PresentFrame(uint64(i), nil)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publishing blocked on a slow subscriber")
+	}
+	if e := <-events; e.Type != "frame" || e.Frame != 0 {
+		t.Errorf("unexpected first event %+v", e)
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	b := NewBroadcaster()
+	as := NewArtboardState()
+	cp := NewCommandProcessor(as)
+	as.OnUpdate = func(*ArtboardState) { b.Publish(Event{Type: "state"}) }
+	cp.OnError = func(err error) { b.Publish(Event{Type: "error", Message: err.Error()}) }
+
+	server := httptest.NewServer(EventsHandler(b))
+	defer server.Close()
+	defer b.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	_, _ = cp.ProcessCommands(strings.NewReader("white"))
+	_, _ = cp.ProcessCommands(strings.NewReader("unknown"))
+	b.PresentFrame(7, nil)
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(lines) < 6 && scanner.Scan() {
+		if scanner.Text() != "" {
+			lines = append(lines, scanner.Text())
+		}
+	}
+
+	want := []string{
+		"event: state", `data: {"type":"state"}`,
+		"event: error", `data: {"type":"error","message":"1:1: unrecognized command"}`,
+		"event: frame", `data: {"type":"frame","frame":7}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got events:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
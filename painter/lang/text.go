@@ -0,0 +1,181 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// Label is a line of text drawn by the text command, either at a point of the artboard or under a figure.
+// Labels are never modified, so copies of the artboard share them.
+type Label struct {
+	Text  string
+	Size  float64 // Size in pixels, painter.DefaultTextSize if zero
+	Align painter.Align
+	Font  string      // Name of a font registered with RegisterFont, the bundled font if empty
+	Color color.Color // painter.DefaultShapeColor if nil
+	Op    draw.Op
+
+	// Gradient, if set, is drawn instead of Color, laid over the pixels the glyphs touch.
+	Gradient painter.Gradient
+}
+
+var (
+	fontsMu sync.RWMutex
+	fonts   = make(map[string]*painter.Font)
+)
+
+// RegisterFont makes the font available to the text command under the given name. Registering a font under
+// a name that is taken replaces it.
+func RegisterFont(name string, f *painter.Font) {
+	fontsMu.Lock()
+	defer fontsMu.Unlock()
+
+	fonts[name] = f
+}
+
+// lookupFont returns the font registered under the name, or nil if there is none.
+func lookupFont(name string) *painter.Font {
+	fontsMu.RLock()
+	defer fontsMu.RUnlock()
+
+	return fonts[name]
+}
+
+// Operation returns the operation that draws the label aligned at pos.
+func (l *Label) Operation(pos image.Point) painter.TextureOperation {
+	var f *painter.Font
+	if l.Font != "" {
+		f = lookupFont(l.Font)
+	}
+	return &painter.Text{
+		Text:  l.Text,
+		Pos:   painter.Point{X: float64(pos.X), Y: float64(pos.Y)},
+		Size:  l.Size,
+		Align: l.Align,
+		Font:  f,
+		Paint: painter.Paint{Color: l.Color, Op: l.Op, Gradient: l.Gradient},
+	}
+}
+
+// labelOperation returns the operation that draws the label of the figure centered under it, or nil if it has
+// no label.
+func (fig *Figure) labelOperation() painter.TextureOperation {
+	if fig.Label == nil {
+		return nil
+	}
+	size := fig.Label.Size
+	if size == 0 {
+		size = painter.DefaultTextSize
+	}
+	return fig.Label.Operation(image.Pt(fig.CenterX, fig.Bounds().Max.Y+int(math.Ceil(size))))
+}
+
+// maxTextSize is the largest size of a label in pixels, which bounds the glyphs a font rasterizes.
+const maxTextSize = 1024
+
+// parseLabel parses the arguments of the text command that follow its position: the label, then size=N,
+// color=FILL, align=left|center|right, font=NAME and the composite mode. The fill is a color or a gradient, which
+// may also be given on its own, as in the other drawing commands.
+func parseLabel(args []string, align painter.Align) (*Label, error) {
+	if len(args) == 0 {
+		return nil, errors.New("text command expects a label")
+	}
+	l := &Label{Text: args[0], Align: align}
+
+	var style []string
+	for _, arg := range args[1:] {
+		name, value, _ := strings.Cut(arg, "=")
+		var err error
+		switch name {
+		case "size":
+			l.Size, err = parseFinite(value)
+			if err != nil || l.Size <= 0 || l.Size > maxTextSize {
+				return nil, fmt.Errorf("size %q must be a number from 0 to %d", value, maxTextSize)
+			}
+		case "color":
+			if l.Color, l.Gradient, err = parseFill(value); err != nil {
+				return nil, err
+			}
+		case "align":
+			if l.Align, err = parseAlign(value); err != nil {
+				return nil, err
+			}
+		case "font":
+			if lookupFont(value) == nil {
+				return nil, fmt.Errorf("font %q is not registered", value)
+			}
+			l.Font = value
+		default:
+			style = append(style, arg)
+		}
+	}
+
+	s, err := parseStyle(style, false)
+	if err != nil {
+		return nil, err
+	}
+	if s.color != nil {
+		l.Color, l.Gradient = s.color, nil
+	}
+	if s.gradient != nil {
+		l.Color, l.Gradient = nil, s.gradient
+	}
+	l.Op = s.op
+	return l, nil
+}
+
+// writeLabel writes the label and its options that differ from the defaults of the text command, align being
+// the default alignment.
+func writeLabel(buf *bytes.Buffer, l *Label, align painter.Align) error {
+	if strings.ContainsAny(l.Text, "\"\r\n") {
+		return fmt.Errorf("label %q has no script representation", l.Text)
+	}
+	fmt.Fprintf(buf, " \"%s\"", l.Text)
+	if l.Size != 0 {
+		buf.WriteString(" size=" + formatFloat(l.Size))
+	}
+	if l.Align != align {
+		buf.WriteString(" align=" + formatAlign(l.Align))
+	}
+	if l.Font != "" {
+		buf.WriteString(" font=" + l.Font)
+	}
+	if l.Color != nil || l.Gradient != nil {
+		buf.WriteString(" color=" + formatFill(l.Color, l.Gradient))
+	}
+	writeStyle(buf, nil, l.Op)
+	return nil
+}
+
+func parseAlign(s string) (painter.Align, error) {
+	switch s {
+	case "left":
+		return painter.AlignLeft, nil
+	case "center":
+		return painter.AlignCenter, nil
+	case "right":
+		return painter.AlignRight, nil
+	default:
+		return 0, fmt.Errorf("alignment %q must be left, center or right", s)
+	}
+}
+
+func formatAlign(a painter.Align) string {
+	switch a {
+	case painter.AlignCenter:
+		return "center"
+	case painter.AlignRight:
+		return "right"
+	default:
+		return "left"
+	}
+}
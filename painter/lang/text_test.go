@@ -0,0 +1,93 @@
+package lang
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestCommandProcessor_ProcessCommands_Text(t *testing.T) {
+	f, err := painter.ParseFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterFont("regular", f)
+
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: `text 0.5 0.5 "Hello, world"`},
+		{input: `text 0.5 0.5 "label" size=16 color=#fff align=center`},
+		{input: `text 0.5 0.5 label #f008 src align=right font=regular`},
+		{input: `figure 0.5 0.5, text @1 "cross" size=20`},
+		{input: `figure 0.5 0.5, text @1 ""`},
+		{input: `text 0.5 0.5`, wantErr: true},
+		{input: `text 0.5 0.5 ""`, wantErr: true},
+		{input: `text 0.5 "label"`, wantErr: true},
+		{input: `text 0.5 0.5 label size=0`, wantErr: true},
+		{input: `text 0.5 0.5 "WWWW" size=1e7`, wantErr: true},
+		{input: `text 0.5 0.5 label size=NaN`, wantErr: true},
+		{input: `text 0.5 0.5 label align=justify`, wantErr: true},
+		{input: `text 0.5 0.5 label font=missing`, wantErr: true},
+		{input: `text 0.5 0.5 label width=2`, wantErr: true},
+		{input: `text @1 "label"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewCommandProcessor(NewArtboardState()).ProcessCommands(bytes.NewBufferString(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+}
+
+func TestText_RoundTrip(t *testing.T) {
+	script := "white\n" +
+		"text 0.1 0.2 \"Hello, world\" size=16 align=center color=#ffffffff\n" +
+		"text 0.5 0.9 \"note\" align=right src\n" +
+		"figure 0.25 0.25\n" +
+		"figure 0.75 0.75 #ff0000ff\n" +
+		"text @2 \"second\" size=20 align=left\n"
+
+	as := checkRoundTrip(t, script)
+	for _, script := range []string{
+		"text -4 4 \"far\" size=1024\n",
+		"text 0.5 0.5 \"\u00e9\u20ac \u0301\"\n",
+	} {
+		checkRoundTrip(t, script)
+	}
+
+	as.Primitives[0].Label = &Label{Text: `say "hi"`}
+	if _, err := as.MarshalScript(); err == nil {
+		t.Error("MarshalScript() accepted a label with quotes")
+	}
+}
+
+func TestText_FigureLabel(t *testing.T) {
+	labelled := func(img *image.RGBA, r image.Rectangle) bool {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if c := img.RGBAAt(x, y); c.R > 128 && c.G < 64 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// The cross reaches 100 pixels below its center; the label is under it.
+	script := `reset,figure 0.5 0.5,text @1 "label" color=#f00 size=26`
+	if !labelled(snapshotScript(t, script), image.Rect(340, 500, 460, 540)) {
+		t.Error("label is not drawn under the figure")
+	}
+
+	img := snapshotScript(t, script+",move @1 0 -0.25")
+	if !labelled(img, image.Rect(340, 300, 460, 340)) || labelled(img, image.Rect(340, 500, 460, 540)) {
+		t.Error("label did not follow the figure")
+	}
+}
@@ -0,0 +1,273 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// maxTransformDepth limits how many canvas transforms push can save.
+const maxTransformDepth = 64
+
+// maxScale limits how much transforms stretch or shrink: neither their linear part nor its inverse has a
+// coefficient beyond it.
+const maxScale = 64
+
+// applyTransform executes the rotate, scale and transform commands. With @id they change the transform of the
+// figure around its center, otherwise the canvas transform that figures and primitives drawn later are placed
+// with. Rotations and scales are combined with the current transform; transform replaces it.
+func applyTransform(artboard *ArtboardState, cmdParts []string) error {
+	name, args := cmdParts[0], cmdParts[1:]
+	var fig *Figure
+	if len(args) > 0 && strings.HasPrefix(args[0], "@") {
+		var err error
+		if fig, err = lookupFigure(artboard, args[0]); err != nil {
+			return err
+		}
+		args = args[1:]
+	}
+
+	var m painter.Affine
+	switch name {
+	case "rotate":
+		if len(args) != 1 {
+			return errors.New("rotate command expects an angle")
+		}
+		deg, err := parseFinite(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid angle %q", args[0])
+		}
+		m = painter.Rotate(deg)
+	case "scale":
+		if len(args) != 2 {
+			return errors.New("scale command expects two factors")
+		}
+		var f [2]float64
+		for i, arg := range args {
+			v, err := parseFinite(arg)
+			if err != nil || v == 0 {
+				return fmt.Errorf("invalid scale factor %q", arg)
+			}
+			f[i] = v
+		}
+		m = painter.Scale(f[0], f[1])
+	default:
+		var err error
+		if m, err = parseAffine(args, artboard.canvasSize()); err != nil {
+			return err
+		}
+	}
+
+	// Rotations and scales that add up may overflow or, with small factors, underflow to the zero value, which
+	// would read as Identity.
+	target := &artboard.transform
+	if fig != nil {
+		target = &fig.Transform
+	}
+	switch {
+	case name == "transform":
+	case fig != nil:
+		m = m.Mul(fig.Transform)
+	default:
+		m = artboard.transform.Mul(m)
+	}
+	if err := checkTransform(m, artboard.canvasSize()); err != nil {
+		return fmt.Errorf("%s would make the transform invalid: %w", name, err)
+	}
+	if fig != nil {
+		prev := fig.Transform
+		fig.Transform = m
+		if err := checkBounds(fig.Bounds(), artboard.canvasSize()); err != nil {
+			fig.Transform = prev
+			return fmt.Errorf("%s would move figure %d too far: %w", name, fig.ID, err)
+		}
+	}
+	*target = m
+	return nil
+}
+
+// PushTransform saves the canvas transform so that PopTransform can restore it.
+func (as *ArtboardState) PushTransform() error {
+	if len(as.transforms) >= maxTransformDepth {
+		return fmt.Errorf("more than %d transforms pushed", maxTransformDepth)
+	}
+	as.transforms = append(as.transforms, as.transform)
+	return nil
+}
+
+// PopTransform restores the canvas transform saved by the matching PushTransform.
+func (as *ArtboardState) PopTransform() error {
+	n := len(as.transforms)
+	if n == 0 {
+		return errors.New("pop without a matching push")
+	}
+	as.transform, as.transforms = as.transforms[n-1], as.transforms[:n-1]
+	return nil
+}
+
+// placeShape moves the shape into place with the canvas transform. The center keeps whole pixels; the rest of
+// the translation goes into the transform of the shape, which the linear part of the canvas transform precedes.
+// It returns an error if the shape would end up too far from the canvas.
+func (as *ArtboardState) placeShape(s *painter.BasicShape) error {
+	if as.transform.IsIdentity() {
+		return nil
+	}
+	c := as.transform.Apply(painter.Point{X: float64(s.CenterX), Y: float64(s.CenterY)})
+	s.CenterX, s.CenterY = int(math.Round(c.X)), int(math.Round(c.Y))
+	residual := painter.Translate(c.X-float64(s.CenterX), c.Y-float64(s.CenterY))
+	s.Transform = residual.Mul(as.transform.Linear()).Mul(s.Transform)
+	size := as.canvasSize()
+	return checkCoordinates(normalize(s.CenterX, size.X), normalize(s.CenterY, size.Y))
+}
+
+// placePrimitive applies the canvas transform and the active clips to the primitive. Texts and images are only
+// moved to where their position is transformed to. It returns an error if a point of the primitive would end up
+// too far from the canvas.
+func (as *ArtboardState) placePrimitive(p *Primitive) error {
+	p.Clips = as.clips
+	if as.transform.IsIdentity() {
+		return nil
+	}
+	size := as.canvasSize()
+	if p.Kind != "text" && p.Kind != "blit" {
+		for _, pt := range p.Points {
+			at := as.transform.Apply(painter.Point{X: float64(pt.X), Y: float64(pt.Y)})
+			if err := checkCoordinates(at.X/float64(size.X), at.Y/float64(size.Y)); err != nil {
+				return err
+			}
+		}
+		p.Transform = as.transform.Mul(p.Transform)
+		return nil
+	}
+	at := as.transform.Apply(painter.Point{X: float64(p.Points[0].X), Y: float64(p.Points[0].Y)})
+	if err := checkCoordinates(at.X/float64(size.X), at.Y/float64(size.Y)); err != nil {
+		return err
+	}
+	delta := image.Pt(int(math.Round(at.X)), int(math.Round(at.Y))).Sub(p.Points[0])
+	for i := range p.Points {
+		p.Points[i] = p.Points[i].Add(delta)
+	}
+	return nil
+}
+
+// transformOperation applies the transform to the rasters the operation is made of.
+func transformOperation(op painter.TextureOperation, m painter.Affine) painter.TextureOperation {
+	switch op := op.(type) {
+	case *painter.Raster:
+		r := *op
+		r.Transform = m.Mul(r.Transform)
+		return &r
+	case painter.CompositeOperation:
+		ops := make(painter.CompositeOperation, len(op))
+		for i, o := range op {
+			ops[i] = transformOperation(o, m)
+		}
+		return ops
+	default:
+		return op
+	}
+}
+
+// rescaleTransform converts a transform in the pixels of a canvas of one size to another one.
+func rescaleTransform(m painter.Affine, from, to image.Point) painter.Affine {
+	if m.IsIdentity() {
+		return m
+	}
+	sx, sy := float64(to.X)/float64(from.X), float64(to.Y)/float64(from.Y)
+	return painter.Scale(sx, sy).Mul(m).Mul(painter.Scale(1/sx, 1/sy))
+}
+
+// parseAffine parses the six numbers of an affine transform as in the SVG matrix(a, b, c, d, e, f). The
+// translation e, f is normalized like coordinates. Transforms that collapse the plane are rejected.
+func parseAffine(args []string, size image.Point) (painter.Affine, error) {
+	if len(args) != 6 {
+		return painter.Affine{}, errors.New("transform command expects six numbers")
+	}
+	var v [6]float64
+	for i, arg := range args {
+		f, err := parseFinite(arg)
+		if err != nil {
+			return painter.Affine{}, fmt.Errorf("invalid transform argument %q", arg)
+		}
+		v[i] = f
+	}
+	return newAffine(v, size)
+}
+
+// newAffine converts the numbers of a transform with a normalized translation to a transform in pixels.
+func newAffine(v [6]float64, size image.Point) (painter.Affine, error) {
+	m := painter.Affine{A: v[0], B: v[1], C: v[2], D: v[3], E: v[4] * float64(size.X), F: v[5] * float64(size.Y)}
+	if err := checkTransform(m, size); err != nil {
+		return painter.Affine{}, err
+	}
+	return m, nil
+}
+
+// checkTransform returns an error unless the transform is invertible, stretches and shrinks by no more than
+// maxScale and translates by no more than maxCoordinate canvases.
+func checkTransform(m painter.Affine, size image.Point) error {
+	if !invertible(m) {
+		return errors.New("transform must not collapse the plane")
+	}
+	det := m.A*m.D - m.B*m.C
+	for _, v := range [...]float64{m.A, m.B, m.C, m.D, m.D / det, m.B / det, m.C / det, m.A / det} {
+		if math.Abs(v) > maxScale {
+			return fmt.Errorf("transform must not scale by more than %d", maxScale)
+		}
+	}
+	if checkCoordinates(m.E/float64(size.X), m.F/float64(size.Y)) != nil {
+		return fmt.Errorf("transform must not translate by more than %d canvases", maxCoordinate)
+	}
+	return nil
+}
+
+// checkBounds returns an error if the bounds in pixels lie entirely more than maxCoordinate canvases away.
+func checkBounds(r image.Rectangle, size image.Point) error {
+	reach := image.Rect(-maxCoordinate*size.X, -maxCoordinate*size.Y, maxCoordinate*size.X, maxCoordinate*size.Y)
+	if !r.Overlaps(reach) {
+		return fmt.Errorf("bounds lie more than %d canvases away", maxCoordinate)
+	}
+	return nil
+}
+
+// affineValues is the inverse of newAffine.
+func affineValues(m painter.Affine, size image.Point) [6]float64 {
+	return [6]float64{m.A, m.B, m.C, m.D, m.E / float64(size.X), m.F / float64(size.Y)}
+}
+
+// writeAffine writes the arguments of the transform command, led by a space.
+func writeAffine(buf *bytes.Buffer, m painter.Affine, size image.Point) {
+	for _, v := range affineValues(m, size) {
+		buf.WriteString(" " + formatFloat(v))
+	}
+}
+
+// invertible reports whether the transform has finite values and an inverse. Unlike Affine.Invert, it does not
+// take the zero value for Identity.
+func invertible(m painter.Affine) bool {
+	for _, v := range [...]float64{m.A, m.B, m.C, m.D, m.E, m.F} {
+		if !finite(v) {
+			return false
+		}
+	}
+	det := m.A*m.D - m.B*m.C
+	return det != 0 && finite(det)
+}
+
+func parseFinite(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err == nil && !finite(v) {
+		err = errors.New("number is not finite")
+	}
+	return v, err
+}
+
+func finite(v float64) bool {
+	return !math.IsInf(v, 0) && !math.IsNaN(v)
+}
@@ -0,0 +1,117 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestTransform_Commands(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "figure 0.5 0.5, rotate @1 45"},
+		{input: "figure 0.5 0.5, scale @1 2 0.5"},
+		{input: "figure 0.5 0.5, transform @1 1 0 0.5 1 0 0"},
+		{input: "push, rotate 30, scale 2 2, figure 0.1 0.1, pop"},
+		{input: "rotate @1 45", wantErr: true},
+		{input: "figure 0.5 0.5, rotate @1", wantErr: true},
+		{input: "figure 0.5 0.5, scale @1 0 1", wantErr: true},
+		{input: "figure 0.5 0.5, transform @1 1 0 0 0 0 0", wantErr: true},
+		{input: "transform 1 0 0 1 0", wantErr: true},
+		{input: "rotate NaN", wantErr: true},
+		{input: "pop", wantErr: true},
+		{input: "push, pop, pop", wantErr: true},
+		{input: "figure 0.5 0.5, scale @1 1e200 1e200, scale @1 1e200 1e200", wantErr: true},
+		{input: "figure 0.5 0.5, scale @1 1e-200 1e-200, scale @1 1e-200 1e-200", wantErr: true},
+		{input: "scale 1e200 1, scale 1e200 1", wantErr: true},
+		{input: "transform 0 0 0 0 0 0", wantErr: true},
+		{input: "figure 0.5 0.5, scale @1 64 64"},
+		{input: "figure 0.5 0.5, scale @1 1e6 1e6", wantErr: true},
+		{input: "figure 0.5 0.5, scale @1 0.01 1", wantErr: true},
+		{input: "figure 0.5 0.5, transform @1 1 0 0 1 1e300 0", wantErr: true},
+		{input: "figure 4 4, transform @1 1 0 0 1 4 4", wantErr: true},
+		{input: "scale 8 8, scale 16 16", wantErr: true},
+		{input: "transform 1 0 0 1 4.5 0", wantErr: true},
+		{input: "transform 1 0 0 1 4 0, figure 0.5 0", wantErr: true},
+		{input: "transform 1 0 0 1 4 0, line 0 0 0.5 0", wantErr: true},
+		{input: "transform 1 0 0 1 4 0, text 0.5 0 far", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewCommandProcessor(NewArtboardState()).ProcessCommands(bytes.NewBufferString(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+	}
+
+	for _, state := range []string{
+		`{"shapes":[{"x":0.5,"y":0.5,"transform":[1,0,0,1,1e300,0]}]}`,
+		`{"shapes":[{"x":0.5,"y":0.5,"transform":[1e6,0,0,1e6,0,0]}]}`,
+		`{"primitives":[{"kind":"line","points":[[0,0],[1,1]],"transform":[1,0,0,1,0,1e300]}]}`,
+	} {
+		if err := json.Unmarshal([]byte(state), NewArtboardState()); err == nil {
+			t.Errorf("%s: transform was accepted", state)
+		}
+	}
+}
+
+func TestTransform_Canvas(t *testing.T) {
+	as := NewArtboardState()
+	script := "push\ntransform 1 0 0 1 0.5 0.5\nrotate 90\nfigure 0.125 0\nline 0 0 0.125 0\npop\nfigure 0.125 0\n"
+	if _, err := NewCommandProcessor(as).ProcessCommands(bytes.NewBufferString(script)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Turned around the middle of the canvas, the figure lands a hundred pixels below it.
+	fig := as.Shapes[0]
+	if fig.CenterX != 400 || fig.CenterY != 500 {
+		t.Errorf("figure is centered at %d, %d", fig.CenterX, fig.CenterY)
+	}
+	if got := fig.Transform.Apply(painter.Point{X: 1}); math.Abs(got.X) > 1e-9 || math.Abs(got.Y-1) > 1e-9 {
+		t.Errorf("figure transform turns (1, 0) into %v", got)
+	}
+	if got := as.Primitives[0].Transform.Apply(painter.Point{X: 100}); math.Abs(got.X-400) > 1e-9 || math.Abs(got.Y-500) > 1e-9 {
+		t.Errorf("line transform moves its end to %v", got)
+	}
+	if fig := as.Shapes[1]; fig.CenterX != 100 || fig.CenterY != 0 || !fig.Transform.IsIdentity() {
+		t.Errorf("pop did not restore the canvas transform: %+v", fig.BasicShape)
+	}
+}
+
+func TestTransform_RoundTrip(t *testing.T) {
+	script := "push\ntransform 0 1 -1 0 0.5 0.25\nline 0 0 0.25 0 width=2\npop\n" +
+		"push\ntransform 2 0 0 1 0 0\npath \"M 0 0 L 0.1 0 L 0 0.1 Z\" fill=#ff0000ff\npop\n" +
+		"figure 0.25 0.25 square size=20\n" +
+		"figure 0.75 0.75\n" +
+		"transform @1 2 0 0 1 0 0\n" +
+		"transform @2 1 0 1 1 0.0125 0\n"
+
+	as := checkRoundTrip(t, script)
+	for _, script := range []string{
+		"figure 0.5 0.5\ntransform @1 64 0 0 64 4 -4\n",
+		"figure 0.5 0.5\ntransform @1 0.015625 0 0 0.015625 0 0\n",
+	} {
+		checkRoundTrip(t, script)
+	}
+
+	// Resizing keeps transformed primitives in place relative to the canvas.
+	as.ResizeArtboard(image.Pt(400, 400))
+	if got := as.Primitives[0].Transform.Apply(painter.Point{X: 100}); math.Abs(got.X-200) > 1e-9 || math.Abs(got.Y-200) > 1e-9 {
+		t.Errorf("after the resize the line ends at %v", got)
+	}
+}
+
+func TestTransform_Draw(t *testing.T) {
+	img := snapshotScript(t, "white\nfigure 0.5 0.5 #000\nrotate @1 45\n")
+
+	// The arms of the rotated cross point to the corners: the diagonal is covered, the axes are not.
+	black, white := color.RGBA{A: 255}, color.RGBA{255, 255, 255, 255}
+	checkPixels(t, img, map[image.Point]color.RGBA{{400, 400}: black, {460, 460}: black, {340, 460}: black, {400, 330}: white, {470, 400}: white})
+}
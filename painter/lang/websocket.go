@@ -0,0 +1,334 @@
+package lang
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// A minimal server side implementation of the WebSocket protocol (RFC 6455), enough for the command channel.
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseInvalidData = 1007
+	wsCloseTooBig      = 1009
+
+	wsMaxMessageSize = 1 << 20
+	wsAckTimeout     = 5 * time.Second
+)
+
+// wsError is a protocol violation that closes the connection with the given status code.
+type wsError struct {
+	code   uint16
+	reason string
+}
+
+func (e *wsError) Error() string { return fmt.Sprintf("websocket: %s", e.reason) }
+
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// upgradeWebSocket performs the opening handshake and takes over the connection.
+func upgradeWebSocket(rw http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		return nil, errors.New("websocket handshake must use GET")
+	case !headerContainsToken(r.Header, "Connection", "upgrade"), !headerContainsToken(r.Header, "Upgrade", "websocket"):
+		return nil, errors.New("not a websocket handshake")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		rw.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, errors.New("unsupported websocket version")
+	case key == "":
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection cannot be hijacked")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The connection outlives the server timeouts.
+	_ = conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	_, err = fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err == nil {
+		err = brw.Flush()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next complete text or binary message. Control frames are handled transparently;
+// io.EOF is returned after the peer closes the connection.
+func (c *wsConn) readMessage() (opcode byte, message []byte, err error) {
+	var buf bytes.Buffer
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			code := uint16(wsCloseNormal)
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+			_ = c.close(code, "")
+			return 0, nil, io.EOF
+		case wsOpText, wsOpBinary:
+			if opcode != 0 {
+				return 0, nil, &wsError{wsCloseProtocol, "new message inside a fragmented message"}
+			}
+			opcode = op
+		case wsOpContinuation:
+			if opcode == 0 {
+				return 0, nil, &wsError{wsCloseProtocol, "continuation without a message"}
+			}
+		default:
+			return 0, nil, &wsError{wsCloseProtocol, fmt.Sprintf("unknown opcode %d", op)}
+		}
+
+		if buf.Len()+len(payload) > wsMaxMessageSize {
+			return 0, nil, &wsError{wsCloseTooBig, "message is too big"}
+		}
+		buf.Write(payload)
+
+		if fin {
+			if opcode == wsOpText && !utf8.Valid(buf.Bytes()) {
+				return 0, nil, &wsError{wsCloseInvalidData, "text message is not valid UTF-8"}
+			}
+			return opcode, buf.Bytes(), nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsError{wsCloseProtocol, "reserved bits are set"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &wsError{wsCloseProtocol, "client frames must be masked"}
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode >= wsOpClose && (!fin || length > 125) {
+		return false, 0, nil, &wsError{wsCloseProtocol, "invalid control frame"}
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, &wsError{wsCloseTooBig, "frame is too big"}
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n <= 125:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+// close sends a close frame and closes the underlying connection.
+func (c *wsConn) close(code uint16, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	_ = c.writeFrame(wsOpClose, append(payload, reason...))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// wsAck acknowledges one message received over the command channel.
+type wsAck struct {
+	Seq    uint64   `json:"seq"`              // 1-based number of the message on the connection
+	Ops    int      `json:"ops"`              // Number of operations enqueued into the event loop
+	Errors []string `json:"errors,omitempty"` // Why the message was rejected; nothing was applied then
+	Frame  uint64   `json:"frame,omitempty"`  // Frame at which the message became visible, if it produced one
+}
+
+// WebSocketHandler serves a command channel over WebSocket. Every text message is a script that is applied and
+// enqueued like a CommandHttpHandler request. Messages are processed in order and each gets a JSON ack.
+func WebSocketHandler(loop *painter.EventLoop, cp *CommandProcessor) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(rw, r)
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		type pendingAck struct {
+			ack     wsAck
+			visible <-chan uint64
+		}
+		acks := make(chan pendingAck, 64)
+		writerDone := make(chan struct{})
+
+		// Acks are written in message order once the frames of the messages are presented.
+		go func() {
+			defer close(writerDone)
+			for p := range acks {
+				if p.visible != nil {
+					select {
+					case frame := <-p.visible:
+						p.ack.Frame = frame
+					case <-time.After(wsAckTimeout):
+					}
+				}
+				data, _ := json.Marshal(p.ack)
+				if err := conn.writeFrame(wsOpText, data); err != nil {
+					_ = conn.close(wsCloseNormal, "")
+					return
+				}
+			}
+		}()
+
+		var seq uint64
+		for {
+			opcode, message, err := conn.readMessage()
+			if err != nil {
+				var we *wsError
+				if errors.As(err, &we) {
+					log.Printf("Closing websocket: %s", err)
+					_ = conn.close(we.code, we.reason)
+				} else if !errors.Is(err, io.EOF) {
+					_ = conn.close(wsCloseNormal, "")
+				}
+				break
+			}
+			if opcode != wsOpText {
+				_ = conn.close(wsCloseUnsupported, "only text messages are supported")
+				break
+			}
+
+			seq++
+			ops, visible, err := cp.SubmitCommands(bytes.NewReader(message), loop)
+			p := pendingAck{ack: wsAck{Seq: seq, Ops: len(ops)}, visible: visible}
+			if err != nil {
+				p.ack.Errors = []string{err.Error()}
+			}
+
+			select {
+			case acks <- p:
+			case <-writerDone:
+				// The writer failed and closed the connection; the next read reports it.
+			}
+		}
+
+		close(acks)
+		<-writerDone
+	})
+}
@@ -0,0 +1,119 @@
+package lang
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestWebSocketHandler(t *testing.T) {
+	var receiver frameReceiver
+	loop := &painter.EventLoop{Receiver: &receiver}
+	loop.Initiate(testScreen{})
+	defer loop.Terminate()
+
+	server := httptest.NewServer(WebSocketHandler(loop, NewCommandProcessor(NewArtboardState())))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, _ = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", resp.StatusCode)
+	}
+	// The accept key for the sample nonce from RFC 6455 section 1.3.
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", accept)
+	}
+
+	writeClientFrame(t, conn, wsOpText, "white\nfigure 0.5 0.5\nupdate")
+	writeClientFrame(t, conn, wsOpPing, "hi")
+	writeClientFrame(t, conn, wsOpText, "move 0.1")
+
+	// The pong may overtake the acks, which wait for their frames, but acks keep the message order.
+	var acks []wsAck
+	pong := false
+	for len(acks) < 2 || !pong {
+		op, payload := readServerFrame(t, br)
+		switch op {
+		case wsOpPong:
+			pong = payload == "hi"
+		case wsOpText:
+			var ack wsAck
+			if err := json.Unmarshal([]byte(payload), &ack); err != nil {
+				t.Fatal(err)
+			}
+			acks = append(acks, ack)
+		default:
+			t.Fatalf("unexpected opcode %d", op)
+		}
+	}
+	first, second := acks[0], acks[1]
+
+	if first.Seq != 1 || first.Ops != 3 || first.Frame != 1 || len(first.Errors) != 0 {
+		t.Errorf("unexpected first ack %+v", first)
+	}
+	if second.Seq != 2 || second.Ops != 0 || second.Frame != 0 || len(second.Errors) != 1 {
+		t.Errorf("unexpected second ack %+v", second)
+	}
+
+	writeClientFrame(t, conn, wsOpClose, "\x03\xe8")
+	if op, _ := readServerFrame(t, br); op != wsOpClose {
+		t.Errorf("got opcode %d, want close", op)
+	}
+}
+
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload string) {
+	t.Helper()
+
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, string) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		_, _ = io.ReadFull(br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, string(payload)
+}
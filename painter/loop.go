@@ -2,65 +2,259 @@ package painter
 
 import (
 	"image"
-	"log"
+	"image/color"
+	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/image/draw"
 )
 
 // TextureReceiver receives a texture that has been prepared as a result of executing operations in the event loop.
+// UpdateTexture must not block. The receiver owns the texture until it calls release, which it must do exactly once,
+// for example after the texture has been copied to a window or when a newer texture replaced it. The event loop
+// does not draw into the texture before that.
 type TextureReceiver interface {
-	UpdateTexture(t screen.Texture)
+	UpdateTexture(t screen.Texture, release func())
 }
 
+// DefaultCanvasSize is the canvas size of an EventLoop that has no Size set.
+var DefaultCanvasSize = image.Pt(800, 800)
+
 // EventLoop manages an event loop for creating textures through executing operations from an internal queue.
 type EventLoop struct {
 	Receiver TextureReceiver
 
-	currentTexture screen.Texture // Texture currently being formed
-	lastTexture    screen.Texture // Texture last sent to the Receiver
+	// Size is the initial canvas size, DefaultCanvasSize if empty. Resize operations change it later;
+	// use CanvasSize to get the current size.
+	Size image.Point
+
+	// Buffers is the number of textures the loop draws into and hands to the Receiver, DefaultBuffers if zero.
+	// With fewer than two, the loop uses two.
+	Buffers int
+
+	// PreserveContents makes every frame start with the pixels of the previous one instead of those of whichever
+	// texture is reused. It needs textures that can be read back, as made by OffscreenScreen and MirrorScreen.
+	PreserveContents bool
+
+	textures       *texturePool
+	currentTexture screen.Texture // Texture currently being formed, nil if none could be allocated
+	lastTexture    screen.Texture // Texture last sent to the Receiver, nil before the first frame
+	skipping       bool           // The frame being formed is dropped because no texture could be allocated
+
+	sizeMu sync.Mutex
+	size   image.Point // Canvas size after the resizes enqueued so far
+
+	pauseMu sync.Mutex
+	resumed chan struct{} // Closed on Resume; nil while the loop is running
 
 	opQueue operationQueue
+	frames  atomic.Uint64 // Number of textures sent to the Receiver
+
+	rateMu     sync.Mutex
+	frameTimes [fpsSamples]time.Time // Times of the latest frames, a ring indexed by the frame number
 
 	stopCh  chan struct{}
 	requestStop bool
 }
 
-var canvasSize = image.Pt(800, 800)
-
 // Initiate starts the event loop. This method should be called before any other methods on it.
 func (el *EventLoop) Initiate(screenProvider screen.Screen) {
-	el.currentTexture, _ = screenProvider.NewTexture(canvasSize)
-	el.lastTexture, _ = screenProvider.NewTexture(canvasSize)
+	buffers := el.Buffers
+	if buffers == 0 {
+		buffers = DefaultBuffers
+	}
+	el.textures = newTexturePool(screenProvider, el.CanvasSize(), buffers)
+	el.acquire()
+	if _, ok := el.currentTexture.(readableTexture); el.PreserveContents && el.currentTexture != nil && !ok {
+		slog.Warn("Textures cannot be read back, frame contents will not be preserved")
+	}
 
 	el.stopCh = make(chan struct{})
 
 	go func() {
 		for !el.requestStop || !el.opQueue.isEmpty() {
+			el.waitResumed()
 			op := el.opQueue.dequeue()
-			ready := op.Apply(el.currentTexture)
+			if r, ok := op.(Resize); ok {
+				el.resize(r.Size)
+				continue
+			}
+			if !el.skipping && el.currentTexture == nil {
+				el.skipping = !el.acquire()
+			}
+			if el.skipping {
+				// Without a texture the whole frame is dropped; a texture is allocated again for the next one.
+				el.skipping = !op.Apply(discardTexture{el.CanvasSize()})
+				continue
+			}
+			ready := applyOn(op, el.currentTexture, el.textures.screen)
 
 			if ready {
 
-				log.Println("Texture updated, calling UpdateTexture")
+				slog.Debug("Texture updated, calling UpdateTexture")
 
-				el.Receiver.UpdateTexture(el.currentTexture)
-				el.currentTexture, el.lastTexture = el.lastTexture, el.currentTexture
+				el.recordFrame(el.frames.Add(1))
+				el.lastTexture = el.currentTexture
+				el.present(el.currentTexture)
+				if el.acquire() && el.PreserveContents {
+					el.textures.copy(el.currentTexture, el.lastTexture)
+				}
 
-				log.Println("Texture swap complete")
+				slog.Debug("Texture swap complete")
 			}
 		}
+		if el.currentTexture != nil {
+			el.textures.release(el.currentTexture)
+		}
+		el.textures.close()
 		close(el.stopCh)
 	}()
 }
 
-// Enqueue adds a new operation to the internal queue.
-func (el *EventLoop) Enqueue(op TextureOperation) {
-	el.opQueue.enqueue(op)
+// Enqueue adds new operations to the internal queue. Operations passed in a single call are queued as one unit,
+// so they are never interleaved with operations enqueued concurrently. Resize operations change the canvas size
+// reported by CanvasSize as soon as they are enqueued.
+func (el *EventLoop) Enqueue(ops ...TextureOperation) {
+	el.sizeMu.Lock()
+	defer el.sizeMu.Unlock()
+
+	for _, op := range ops {
+		if r, ok := op.(Resize); ok {
+			el.size = r.Size
+		}
+	}
+	el.opQueue.enqueue(ops...)
+}
+
+// fpsSamples bounds the frame rate reported by FPS.
+const fpsSamples = 256
+
+func (el *EventLoop) recordFrame(frame uint64) {
+	el.rateMu.Lock()
+	defer el.rateMu.Unlock()
+
+	el.frameTimes[frame%fpsSamples] = time.Now()
+}
+
+// FPS returns the number of frames presented during the last second.
+func (el *EventLoop) FPS() int {
+	el.rateMu.Lock()
+	defer el.rateMu.Unlock()
+
+	since := time.Now().Add(-time.Second)
+	fps := 0
+	for _, t := range el.frameTimes {
+		if t.After(since) {
+			fps++
+		}
+	}
+	return fps
+}
+
+// QueueLength returns the number of operations waiting in the queue.
+func (el *EventLoop) QueueLength() int {
+	return el.opQueue.len()
+}
+
+// CanvasSize returns the size of the canvas the enqueued operations draw on.
+func (el *EventLoop) CanvasSize() image.Point {
+	el.sizeMu.Lock()
+	defer el.sizeMu.Unlock()
+
+	switch {
+	case el.size != image.Point{}:
+		return el.size
+	case el.Size != image.Point{}:
+		return el.Size
+	default:
+		return DefaultCanvasSize
+	}
+}
+
+// present hands the texture over to the Receiver.
+func (el *EventLoop) present(t screen.Texture) {
+	var once sync.Once
+	el.Receiver.UpdateTexture(t, func() {
+		once.Do(func() { el.textures.release(t) })
+	})
+}
+
+// resize replaces the textures with new ones of the given size. Textures the Receiver still owns are destroyed
+// once it releases them.
+func (el *EventLoop) resize(size image.Point) {
+	el.textures.resize(size)
+	if el.currentTexture != nil {
+		el.textures.release(el.currentTexture)
+	}
+	el.acquire()
+}
+
+// acquire takes the texture the next frame is formed on. If the screen fails to allocate one, the loop has no
+// current texture and acquire reports false.
+func (el *EventLoop) acquire() bool {
+	t, err := el.textures.acquire()
+	if err != nil {
+		slog.Error("Failed to allocate a texture, skipping the frame", "err", err)
+	}
+	if mt, ok := t.(*MirroredTexture); ok {
+		mt.startFrame()
+	}
+	el.currentTexture = t
+	return err == nil
+}
+
+// Frame returns the number of textures sent to the Receiver so far. While UpdateTexture runs, it is the number
+// of the frame being presented.
+func (el *EventLoop) Frame() uint64 {
+	return el.frames.Load()
+}
+
+// Pause stops applying operations until Resume is called. Operations enqueued meanwhile wait in the queue.
+func (el *EventLoop) Pause() {
+	el.pauseMu.Lock()
+	defer el.pauseMu.Unlock()
+
+	if el.resumed == nil {
+		el.resumed = make(chan struct{})
+	}
 }
 
-// Terminate signals the event loop to stop and waits for it to finish.
+// Resume continues applying operations after Pause.
+func (el *EventLoop) Resume() {
+	el.pauseMu.Lock()
+	defer el.pauseMu.Unlock()
+
+	if el.resumed != nil {
+		close(el.resumed)
+		el.resumed = nil
+	}
+}
+
+// Paused reports whether the event loop is paused.
+func (el *EventLoop) Paused() bool {
+	el.pauseMu.Lock()
+	defer el.pauseMu.Unlock()
+
+	return el.resumed != nil
+}
+
+func (el *EventLoop) waitResumed() {
+	el.pauseMu.Lock()
+	resumed := el.resumed
+	el.pauseMu.Unlock()
+
+	if resumed != nil {
+		<-resumed
+	}
+}
+
+// Terminate signals the event loop to stop and waits for it to finish. A paused loop is resumed. The textures are
+// destroyed, those owned by the Receiver once it releases them.
 func (el *EventLoop) Terminate() {
+	el.Resume()
 	el.Enqueue(TextureFunc(func(t screen.Texture) {
 		el.requestStop = true
 	}))
@@ -74,11 +268,11 @@ type operationQueue struct {
 	waitCh     chan struct{}
 }
 
-func (oq *operationQueue) enqueue(op TextureOperation) {
+func (oq *operationQueue) enqueue(ops ...TextureOperation) {
 	oq.mutex.Lock()
 	defer oq.mutex.Unlock()
 
-	oq.operations = append(oq.operations, op)
+	oq.operations = append(oq.operations, ops...)
 
 	if oq.waitCh != nil {
 		close(oq.waitCh)
@@ -91,9 +285,10 @@ func (oq *operationQueue) dequeue() TextureOperation {
 	defer oq.mutex.Unlock()
 
 	for len(oq.operations) == 0 {
-		oq.waitCh = make(chan struct{})
+		wait := make(chan struct{})
+		oq.waitCh = wait
 		oq.mutex.Unlock()
-		<-oq.waitCh
+		<-wait
 		oq.mutex.Lock()
 	}
 
@@ -103,9 +298,31 @@ func (oq *operationQueue) dequeue() TextureOperation {
 	return op
 }
 
+func (oq *operationQueue) len() int {
+	oq.mutex.Lock()
+	defer oq.mutex.Unlock()
+
+	return len(oq.operations)
+}
+
 func (oq *operationQueue) isEmpty() bool {
 	oq.mutex.Lock()
 	defer oq.mutex.Unlock()
 
 	return len(oq.operations) == 0
 }
+
+// discardTexture stands in for the texture of a dropped frame. Drawing calls on it do nothing.
+type discardTexture struct {
+	size image.Point
+}
+
+func (discardTexture) Release() {}
+
+func (t discardTexture) Size() image.Point { return t.size }
+
+func (t discardTexture) Bounds() image.Rectangle { return image.Rectangle{Max: t.size} }
+
+func (discardTexture) Upload(image.Point, screen.Buffer, image.Rectangle) {}
+
+func (discardTexture) Fill(image.Rectangle, color.Color, draw.Op) {}
@@ -17,9 +17,13 @@ func TestEventLoop_Initiate(t *testing.T) {
 	}
 	el.Initiate(s)
 
-	if el.currentTexture == nil || el.lastTexture == nil {
+	if el.currentTexture == nil {
 		t.Error("unexpected nil texture")
 	}
+	// The loop owns no texture it has not presented.
+	if el.lastTexture != nil {
+		t.Error("last texture is set before the first frame")
+	}
 
 	el.Terminate()
 }
@@ -50,6 +54,114 @@ func TestEventLoop_Enqueue(t *testing.T) {
 	}
 }
 
+func TestEventLoop_Resize(t *testing.T) {
+	var tr testTextureReceiver
+	el := &EventLoop{Receiver: &tr, Size: image.Pt(100, 50)}
+	if got := el.CanvasSize(); got != image.Pt(100, 50) {
+		t.Errorf("CanvasSize() = %v before Initiate", got)
+	}
+
+	el.Initiate(OffscreenScreen{})
+	el.Enqueue(Resize{Size: image.Pt(30, 40)}, FillTexture(color.White), MarkUpdated)
+	if got := el.CanvasSize(); got != image.Pt(30, 40) {
+		t.Errorf("CanvasSize() = %v after enqueueing a resize", got)
+	}
+	el.Terminate()
+
+	if tr.LastTexture == nil || tr.LastTexture.Size() != image.Pt(30, 40) {
+		t.Fatal("Receiver did not get a texture of the new size")
+	}
+	if el.currentTexture.Size() != image.Pt(30, 40) || len(el.textures.textures) > DefaultBuffers {
+		t.Error("textures of the old size are still in use")
+	}
+}
+
+func TestEventLoop_Handoff(t *testing.T) {
+	hr := make(holdingReceiver, DefaultBuffers)
+	el := &EventLoop{Receiver: hr, Size: image.Pt(1, 1)}
+	el.Initiate(OffscreenScreen{})
+
+	el.Enqueue(FillTexture(color.White), MarkUpdated)
+	held := <-hr
+	el.Enqueue(FillTexture(color.Black), MarkUpdated, FillTexture(color.Black), MarkUpdated)
+	next := <-hr
+
+	if r, g, b, _ := held.t.(*ImageTexture).RGBA().At(0, 0).RGBA(); r == 0 || g == 0 || b == 0 {
+		t.Error("the loop drew into a texture owned by the Receiver")
+	}
+	if next.t == held.t {
+		t.Error("the loop presented a texture owned by the Receiver")
+	}
+
+	// The loop waits for a texture once the Receiver holds all of them, and continues after a release.
+	done := make(chan struct{})
+	go func() {
+		el.Terminate()
+		close(done)
+	}()
+	third := <-hr
+	held.release()
+	next.release()
+	third.release()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the loop did not continue after the textures were released")
+	}
+}
+
+func TestEventLoop_Pause(t *testing.T) {
+	var tr testTextureReceiver
+	el := &EventLoop{Receiver: &tr}
+	el.Initiate(mockScreen{})
+
+	el.Pause()
+	// The loop may be waiting for an operation already, so the first one can still slip through.
+	el.Enqueue(TextureFunc(func(screen.Texture) {}))
+	applied := make(chan struct{})
+	el.Enqueue(TextureFunc(func(screen.Texture) { close(applied) }))
+
+	select {
+	case <-applied:
+		t.Fatal("paused loop applied an operation")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !el.Paused() {
+		t.Error("Paused() = false")
+	}
+
+	el.Resume()
+	select {
+	case <-applied:
+	case <-time.After(time.Second):
+		t.Fatal("resumed loop did not apply the operation")
+	}
+
+	el.Pause()
+	el.Terminate()
+}
+
+func TestEventLoop_Stats(t *testing.T) {
+	var tr testTextureReceiver
+	el := &EventLoop{Receiver: &tr}
+	el.Initiate(mockScreen{})
+
+	el.Pause()
+	el.Enqueue(TextureFunc(func(screen.Texture) {}))
+	el.Enqueue(MarkUpdated, MarkUpdated, MarkUpdated)
+	if n := el.QueueLength(); n < 3 {
+		t.Errorf("QueueLength() = %d while paused", n)
+	}
+	el.Terminate()
+
+	if el.QueueLength() != 0 {
+		t.Errorf("QueueLength() = %d after Terminate", el.QueueLength())
+	}
+	if fps := el.FPS(); fps != 3 {
+		t.Errorf("FPS() = %d, want 3", fps)
+	}
+}
+
 func TestOperationQueue_enqueue_dequeue_isEmpty(t *testing.T) {
 	oq := &operationQueue{}
 	op := &testTextureOperation{}
@@ -110,8 +222,21 @@ type testTextureReceiver struct {
 	LastTexture screen.Texture
 }
 
-func (tr *testTextureReceiver) UpdateTexture(t screen.Texture) {
+func (tr *testTextureReceiver) UpdateTexture(t screen.Texture, release func()) {
 	tr.LastTexture = t
+	release()
+}
+
+// holdingReceiver keeps the presented textures until the test releases them.
+type holdingReceiver chan heldTexture
+
+type heldTexture struct {
+	t       screen.Texture
+	release func()
+}
+
+func (hr holdingReceiver) UpdateTexture(t screen.Texture, release func()) {
+	hr <- heldTexture{t, release}
 }
 
 type testTextureOperation struct {
@@ -143,10 +268,10 @@ type mockTexture struct {
 
 func (m *mockTexture) Release() {}
 
-func (m *mockTexture) Size() image.Point { return canvasSize }
+func (m *mockTexture) Size() image.Point { return DefaultCanvasSize }
 
 func (m *mockTexture) Bounds() image.Rectangle {
-	return image.Rectangle{Max: canvasSize}
+	return image.Rectangle{Max: DefaultCanvasSize}
 }
 
 func (m *mockTexture) Upload(image.Point, screen.Buffer, image.Rectangle) {
@@ -167,8 +292,8 @@ func TestEventLoop_NewTexturesCreated(t *testing.T) {
 	el.Initiate(s)
 	defer el.Terminate()
 
-	if el.currentTexture == nil || el.lastTexture == nil {
-		t.Error("EventLoop did not create new textures on initiation")
+	if el.currentTexture == nil {
+		t.Error("EventLoop did not create a texture on initiation")
 	}
 }
 
@@ -0,0 +1,143 @@
+package painter
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/image/draw"
+)
+
+// OffscreenScreen is a screen.Screen that keeps textures in memory. It lets an EventLoop run without a window.
+type OffscreenScreen struct{}
+
+func (OffscreenScreen) NewBuffer(size image.Point) (screen.Buffer, error) {
+	return &ImageBuffer{rgba: image.NewRGBA(image.Rectangle{Max: size})}, nil
+}
+
+func (OffscreenScreen) NewTexture(size image.Point) (screen.Texture, error) {
+	return &ImageTexture{rgba: image.NewRGBA(image.Rectangle{Max: size})}, nil
+}
+
+func (OffscreenScreen) NewWindow(*screen.NewWindowOptions) (screen.Window, error) {
+	return nil, errors.New("off-screen screen cannot open windows")
+}
+
+// ImageBuffer is a screen.Buffer backed by an in-memory image.
+type ImageBuffer struct {
+	rgba *image.RGBA
+}
+
+func (b *ImageBuffer) Release() {}
+
+func (b *ImageBuffer) Size() image.Point { return b.rgba.Rect.Size() }
+
+func (b *ImageBuffer) Bounds() image.Rectangle { return b.rgba.Rect }
+
+func (b *ImageBuffer) RGBA() *image.RGBA { return b.rgba }
+
+// ImageTexture is a screen.Texture backed by an in-memory image, so its pixels can be read back.
+type ImageTexture struct {
+	rgba *image.RGBA
+}
+
+func (t *ImageTexture) Release() {}
+
+func (t *ImageTexture) Size() image.Point { return t.rgba.Rect.Size() }
+
+func (t *ImageTexture) Bounds() image.Rectangle { return t.rgba.Rect }
+
+// RGBA returns the pixels of the texture. They must not be modified while the texture is owned by an EventLoop.
+func (t *ImageTexture) RGBA() *image.RGBA { return t.rgba }
+
+func (t *ImageTexture) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {
+	draw.Draw(t.rgba, sr.Sub(sr.Min).Add(dp), src.RGBA(), sr.Min, draw.Src)
+}
+
+func (t *ImageTexture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
+	draw.Draw(t.rgba, dr, image.NewUniform(src), image.Point{}, op)
+}
+
+// MirrorScreen wraps a screen so that its textures keep an in-memory copy of their pixels that can be read back.
+type MirrorScreen struct {
+	screen.Screen
+
+	// Active, if set, reports whether the copy is needed. Textures stop and resume mirroring only at the first
+	// drawing call of a frame an EventLoop forms in them or when they are drawn over as a whole, so the copy never
+	// misses part of a frame.
+	Active func() bool
+}
+
+func (ms MirrorScreen) NewTexture(size image.Point) (screen.Texture, error) {
+	t, err := ms.Screen.NewTexture(size)
+	if err != nil {
+		return nil, err
+	}
+	return &MirroredTexture{Texture: t, mirror: &ImageTexture{rgba: image.NewRGBA(image.Rectangle{Max: size})}, active: ms.Active}, nil
+}
+
+// MirroredTexture applies the drawing calls both to the wrapped texture and to an in-memory copy while it is
+// mirroring.
+type MirroredTexture struct {
+	screen.Texture
+	mirror *ImageTexture
+	active func() bool
+	paused bool // The copy misses drawing calls and does not hold the pixels of the texture
+	frame  bool // A frame was started and nothing has been drawn in it yet
+}
+
+// Unwrap returns the texture created by the wrapped screen, e.g. to copy it to a window of that screen.
+func (t *MirroredTexture) Unwrap() screen.Texture { return t.Texture }
+
+// RGBA returns the in-memory copy of the texture pixels. It holds the current pixels only if Mirrored is true.
+func (t *MirroredTexture) RGBA() *image.RGBA { return t.mirror.rgba }
+
+// Mirrored reports whether the in-memory copy holds the current pixels of the texture.
+func (t *MirroredTexture) Mirrored() bool { return !t.paused }
+
+func (t *MirroredTexture) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {
+	t.Texture.Upload(dp, src, sr)
+	if t.mirrors(sr.Sub(sr.Min).Add(dp), draw.Src) {
+		t.mirror.Upload(dp, src, sr)
+	}
+}
+
+func (t *MirroredTexture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
+	t.Texture.Fill(dr, src, op)
+	if t.mirrors(dr, op) {
+		t.mirror.Fill(dr, src, op)
+	}
+}
+
+// mirrors reports whether a drawing call into dr with op is applied to the copy. The first call of a frame and a
+// call that replaces all pixels pause or resume mirroring as Active asks.
+func (t *MirroredTexture) mirrors(dr image.Rectangle, op draw.Op) bool {
+	if t.active != nil && t.frame {
+		// The copy misses what was drawn while mirroring was paused, so a texture that resumes is cleared in both.
+		t.frame = false
+		active := t.active()
+		if active && t.paused {
+			t.Texture.Fill(t.Bounds(), color.Transparent, draw.Src)
+			t.mirror.Fill(t.Bounds(), color.Transparent, draw.Src)
+		}
+		t.paused = !active
+	}
+	if t.active != nil && op == draw.Src && dr.Intersect(t.Bounds()) == t.Bounds() {
+		t.paused = !t.active()
+	}
+	return !t.paused
+}
+
+// startFrame makes the first drawing call of the frame an EventLoop forms in the texture pause or resume
+// mirroring as Active asks.
+func (t *MirroredTexture) startFrame() { t.frame = true }
+
+// readable returns the texture if its pixels can be read back at the moment.
+func readable(t screen.Texture) (readableTexture, bool) {
+	if mt, ok := t.(*MirroredTexture); ok && !mt.Mirrored() {
+		return nil, false
+	}
+	rt, ok := t.(readableTexture)
+	return rt, ok
+}
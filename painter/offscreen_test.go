@@ -0,0 +1,85 @@
+package painter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+func TestMirrorScreen_Active(t *testing.T) {
+	active := true
+	s := MirrorScreen{Screen: OffscreenScreen{}, Active: func() bool { return active }}
+	tx, _ := s.NewTexture(image.Pt(4, 4))
+	mt := tx.(*MirroredTexture)
+	red, green := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}
+	full, part := mt.Bounds(), image.Rect(0, 0, 1, 1)
+
+	steps := []struct {
+		active   bool
+		dr       image.Rectangle
+		c        color.RGBA
+		mirrored bool
+		copied   color.RGBA // Pixel (0, 0) of the copy
+	}{
+		{active: true, dr: full, c: red, mirrored: true, copied: red},
+		// Mirroring stops only when the next frame is drawn over the whole texture.
+		{active: false, dr: part, c: green, mirrored: true, copied: green},
+		{active: false, dr: full, c: red, mirrored: false, copied: green},
+		{active: true, dr: part, c: red, mirrored: false, copied: green},
+		{active: true, dr: full, c: red, mirrored: true, copied: red},
+	}
+	for i, step := range steps {
+		active = step.active
+		mt.Fill(step.dr, step.c, draw.Src)
+		if mt.Mirrored() != step.mirrored {
+			t.Errorf("step %d: Mirrored() = %t", i, mt.Mirrored())
+		}
+		if _, ok := readable(mt); ok != step.mirrored {
+			t.Errorf("step %d: texture readable %t", i, ok)
+		}
+		if got := mt.RGBA().RGBAAt(0, 0); got != step.copied {
+			t.Errorf("step %d: copy has %v", i, got)
+		}
+	}
+}
+
+func TestMirrorScreen_ResumeAtFrame(t *testing.T) {
+	var active atomic.Bool
+	hr := make(holdingReceiver, 1)
+	el := &EventLoop{Receiver: hr, Size: image.Pt(2, 2)}
+	el.Initiate(MirrorScreen{Screen: OffscreenScreen{}, Active: active.Load})
+	defer el.Terminate()
+
+	// Frames without a background draw over part of the texture only.
+	corner := func(p image.Point, c color.Color) TextureOperation {
+		return TextureFunc(func(t screen.Texture) { t.Fill(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))}, c, draw.Over) })
+	}
+	red, green := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}
+
+	el.Enqueue(corner(image.Pt(0, 0), red), MarkUpdated)
+	f := <-hr
+	if f.t.(*MirroredTexture).Mirrored() {
+		t.Error("frame drawn while inactive was mirrored")
+	}
+	f.release()
+
+	active.Store(true)
+	el.Enqueue(corner(image.Pt(1, 1), green), MarkUpdated)
+	f = <-hr
+	defer f.release()
+	mt := f.t.(*MirroredTexture)
+	if !mt.Mirrored() {
+		t.Fatal("mirroring did not resume at the next frame")
+	}
+	if got := mt.RGBA().RGBAAt(1, 1); got != green {
+		t.Errorf("copy has %v, want green", got)
+	}
+	if got, want := mt.Unwrap().(*ImageTexture).RGBA().Pix, mt.RGBA().Pix; !bytes.Equal(got, want) {
+		t.Errorf("texture has %v, copy has %v", got, want)
+	}
+}
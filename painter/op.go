@@ -3,6 +3,7 @@ package painter
 import (
 	"image"
 	"image/color"
+	"image/draw"
 
 	"golang.org/x/exp/shiny/screen"
 )
@@ -30,6 +31,15 @@ type markUpdated struct{}
 
 func (mu markUpdated) Apply(t screen.Texture) bool { return true }
 
+// Resize is an operation that makes the EventLoop replace its textures with new ones of the given size.
+// The new textures are blank, so a resize is followed by the operations that redraw the canvas. Resize must be
+// enqueued on its own rather than inside a CompositeOperation; applied to a texture directly, it does nothing.
+type Resize struct {
+	Size image.Point
+}
+
+func (r Resize) Apply(t screen.Texture) bool { return false }
+
 // TextureFunc wraps a texture update function into a TextureOperation.
 type TextureFunc func(t screen.Texture)
 
@@ -38,47 +48,28 @@ func (tf TextureFunc) Apply(t screen.Texture) bool {
 	return false
 }
 
-// FillTexture creates a TextureFunc that fills the texture with the specified color.
+// FillTexture creates a TextureFunc that fills the texture with the specified color, replacing its pixels.
 func FillTexture(fillColor color.Color) TextureFunc {
-	return func(t screen.Texture) {
-		t.Fill(t.Bounds(), fillColor, screen.Src)
-	}
+	return FillTextureOp(fillColor, draw.Src)
 }
 
-// DrawRectangle creates a TextureFunc that draws a rectangle with the specified coordinates and color.
-func DrawRectangle(x1, y1, x2, y2 int, rectColor color.Color) TextureFunc {
+// FillTextureOp creates a TextureFunc that fills the texture with the specified color using the composite
+// operator op: draw.Src replaces the pixels, draw.Over blends a translucent color over them.
+func FillTextureOp(fillColor color.Color, op draw.Op) TextureFunc {
 	return func(t screen.Texture) {
-		t.Fill(image.Rect(x1, y1, x2, y2), rectColor, screen.Src)
+		t.Fill(t.Bounds(), fillColor, op)
 	}
 }
 
-// Shape represents a drawable shape with a center position.
-type Shape struct {
-	CenterX int
-	CenterY int
+// DrawRectangle creates a TextureFunc that draws a rectangle with the specified coordinates and color,
+// replacing the pixels under it.
+func DrawRectangle(x1, y1, x2, y2 int, rectColor color.Color) TextureFunc {
+	return DrawRectangleOp(x1, y1, x2, y2, rectColor, draw.Src)
 }
 
-// DrawShape creates a TextureFunc that draws the shape at its center position.
-func (s *Shape) DrawShape() TextureFunc {
+// DrawRectangleOp works like DrawRectangle and composites the rectangle using op.
+func DrawRectangleOp(x1, y1, x2, y2 int, rectColor color.Color, op draw.Op) TextureFunc {
 	return func(t screen.Texture) {
-		// Define the size of the cross arms
-		armWidth := 20
-		armLength := 100
-
-		// Calculate the rectangle coordinates for the vertical part of the cross
-		verticalRect := image.Rect(s.CenterX-armWidth, s.CenterY-armLength, s.CenterX+armWidth, s.CenterY+armLength)
-		// Calculate the rectangle coordinates for the horizontal part of the cross
-		horizontalRect := image.Rect(s.CenterX-armLength, s.CenterY-armWidth, s.CenterX+armLength, s.CenterY+armWidth)
-
-		// Draw the vertical part of the cross
-		t.Fill(verticalRect, color.RGBA{B: 255, A: 255}, screen.Src)
-		// Draw the horizontal part of the cross
-		t.Fill(horizontalRect, color.RGBA{B: 255, A: 255}, screen.Src)
+		t.Fill(image.Rect(x1, y1, x2, y2), rectColor, op)
 	}
 }
-
-// Move changes the center position of the shape by the specified offsets.
-func (s *Shape) Move(xOffset, yOffset int) {
-	s.CenterX += xOffset
-	s.CenterY += yOffset
-}
@@ -0,0 +1,30 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestDrawOps_Composite(t *testing.T) {
+	tx, _ := OffscreenScreen{}.NewTexture(image.Pt(300, 300))
+	rgba := tx.(*ImageTexture).RGBA()
+	half := color.NRGBA{R: 255, A: 128}
+
+	FillTexture(color.White).Apply(tx)
+	DrawRectangleOp(0, 0, 10, 10, half, draw.Over).Apply(tx)
+	DrawRectangle(10, 0, 20, 10, half).Apply(tx)
+	(&BasicShape{CenterX: 150, CenterY: 150, Color: half}).Draw().Apply(tx)
+
+	if got := rgba.RGBAAt(5, 5); got.A != 255 || got.G < 120 || got.G > 135 {
+		t.Errorf("Over did not blend the rectangle with the background: %v", got)
+	}
+	if got := rgba.RGBAAt(15, 5); got.A != 128 {
+		t.Errorf("DrawRectangle did not replace the pixels: %v", got)
+	}
+	// The center of the cross must be blended once, like its arms.
+	if center, arm := rgba.RGBAAt(150, 150), rgba.RGBAAt(100, 150); center != arm {
+		t.Errorf("cross center %v differs from its arm %v", center, arm)
+	}
+}
@@ -0,0 +1,185 @@
+package painter
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// FillRule decides which parts of overlapping or self-intersecting contours are inside a filled shape.
+type FillRule int
+
+const (
+	// NonZero fills every point that the contours wind around.
+	NonZero FillRule = iota
+	// EvenOdd fills the points that are crossed an odd number of times by a ray going out of the shape, leaving
+	// holes where contours overlap.
+	EvenOdd
+)
+
+// Path is a sequence of subpaths made of straight and curved segments. Curves are flattened into polylines as
+// they are added.
+type Path struct {
+	subpaths []subpath
+}
+
+type subpath struct {
+	points []Point
+	closed bool
+}
+
+// MoveTo starts a new subpath at p.
+func (p *Path) MoveTo(pt Point) {
+	p.subpaths = append(p.subpaths, subpath{points: []Point{pt}})
+}
+
+// LineTo adds a straight segment from the current point to pt. Without a current point, it starts a subpath.
+func (p *Path) LineTo(pt Point) {
+	if len(p.subpaths) == 0 || p.last().closed {
+		p.MoveTo(p.Current())
+	}
+	s := p.last()
+	s.points = append(s.points, pt)
+}
+
+// QuadTo adds a quadratic Bézier curve from the current point to pt with the control point c.
+func (p *Path) QuadTo(c, pt Point) {
+	from := p.Current()
+	n := curveSegments(from, c, pt)
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		p.LineTo(Point{u*u*from.X + 2*u*t*c.X + t*t*pt.X, u*u*from.Y + 2*u*t*c.Y + t*t*pt.Y})
+	}
+}
+
+// CubeTo adds a cubic Bézier curve from the current point to pt with the control points c1 and c2.
+func (p *Path) CubeTo(c1, c2, pt Point) {
+	from := p.Current()
+	n := curveSegments(from, c1, c2, pt)
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		p.LineTo(Point{
+			u*u*u*from.X + 3*u*u*t*c1.X + 3*u*t*t*c2.X + t*t*t*pt.X,
+			u*u*u*from.Y + 3*u*u*t*c1.Y + 3*u*t*t*c2.Y + t*t*t*pt.Y,
+		})
+	}
+}
+
+// Close closes the current subpath with a straight segment to its start. The next segment starts a new subpath
+// there.
+func (p *Path) Close() {
+	if len(p.subpaths) > 0 {
+		p.last().closed = true
+	}
+}
+
+// Current returns the current point: the end of the last segment, or the start of the last closed subpath.
+func (p *Path) Current() Point {
+	if len(p.subpaths) == 0 {
+		return Point{}
+	}
+	s := p.last()
+	if s.closed {
+		return s.points[0]
+	}
+	return s.points[len(s.points)-1]
+}
+
+func (p *Path) last() *subpath {
+	return &p.subpaths[len(p.subpaths)-1]
+}
+
+// curveSegments returns the number of segments that approximate a curve with the given control polygon with
+// segments of at most about two pixels.
+func curveSegments(points ...Point) int {
+	length := 0.0
+	for i := 1; i < len(points); i++ {
+		length += math.Hypot(points[i].X-points[i-1].X, points[i].Y-points[i-1].Y)
+	}
+	return min(max(int(math.Ceil(length/2)), 1), 1000)
+}
+
+// FillPath creates an operation that fills the path using the fill rule. Open subpaths are filled as if closed.
+// The width of paint is ignored.
+func FillPath(p *Path, rule FillRule, paint Paint) *Raster {
+	r := &Raster{Closed: true, Rule: rule, Paint: paint}
+	r.Paint.Width = 0
+	for _, s := range p.subpaths {
+		r.Contours = append(r.Contours, s.points)
+	}
+	return r
+}
+
+// StrokePath creates an operation that outlines the path with the width of paint, one pixel if it has none.
+func StrokePath(p *Path, paint Paint) *Raster {
+	width := paint.Width
+	if width <= 0 {
+		width = 1
+	}
+	// The outline is filled: subpaths differ in whether they are closed, which a Raster cannot express.
+	r := &Raster{Paint: paint}
+	r.Paint.Width = 0
+	for _, s := range p.subpaths {
+		r.Contours = append(r.Contours, strokePolygons(s.points, s.closed, width)...)
+	}
+	return r
+}
+
+// evenOddSamples is the number of sub-scanlines per pixel row sampled by evenOddMask.
+const evenOddSamples = 16
+
+// evenOddMask rasterizes the polygons into a coverage mask of the extent with the even-odd rule. It samples
+// evenOddSamples sub-scanlines per row and covers every span between crossings exactly along X.
+func evenOddMask(polygons [][]Point, extent image.Rectangle) *image.Alpha {
+	w, h := extent.Dx(), extent.Dy()
+	coverage := make([]float64, w*h)
+	var crossings []float64
+
+	for row := 0; row < h; row++ {
+		acc := coverage[row*w : (row+1)*w]
+		for s := 0; s < evenOddSamples; s++ {
+			y := float64(extent.Min.Y+row) + (float64(s)+0.5)/evenOddSamples
+
+			crossings = crossings[:0]
+			for _, p := range polygons {
+				for i, a := range p {
+					b := p[(i+1)%len(p)]
+					if (a.Y <= y) != (b.Y <= y) {
+						crossings = append(crossings, a.X+(y-a.Y)*(b.X-a.X)/(b.Y-a.Y)-float64(extent.Min.X))
+					}
+				}
+			}
+			sort.Float64s(crossings)
+
+			for i := 0; i+1 < len(crossings); i += 2 {
+				addSpan(acc, crossings[i], crossings[i+1], 1.0/evenOddSamples)
+			}
+		}
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	for i, c := range coverage {
+		mask.Pix[i] = uint8(math.Round(min(c, 1) * 0xff))
+	}
+	return mask
+}
+
+// addSpan adds the weight to the pixels of a row between x0 and x1, in proportion to how much of them is covered.
+func addSpan(row []float64, x0, x1, weight float64) {
+	x0, x1 = max(x0, 0), min(x1, float64(len(row)))
+	if x0 >= x1 {
+		return
+	}
+	first, last := int(x0), int(math.Ceil(x1))-1
+	if first == last {
+		row[first] += (x1 - x0) * weight
+		return
+	}
+	row[first] += (float64(first+1) - x0) * weight
+	for x := first + 1; x < last; x++ {
+		row[x] += weight
+	}
+	row[last] += (x1 - float64(last)) * weight
+}
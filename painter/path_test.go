@@ -0,0 +1,73 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFillPath_Rules(t *testing.T) {
+	// Two nested squares wound the same way: the inner one is a hole only with the even-odd rule.
+	var p Path
+	for _, square := range [][4]Point{
+		{{10, 10}, {90, 10}, {90, 90}, {10, 90}},
+		{{30, 30}, {70, 30}, {70, 70}, {30, 70}},
+	} {
+		p.MoveTo(square[0])
+		for _, pt := range square[1:] {
+			p.LineTo(pt)
+		}
+		p.Close()
+	}
+
+	for _, tt := range []struct {
+		rule FillRule
+		hole bool
+	}{{NonZero, false}, {EvenOdd, true}} {
+		tx, _ := OffscreenScreen{}.NewTexture(image.Pt(100, 100))
+		FillPath(&p, tt.rule, Paint{Color: color.Black}).Apply(tx)
+		img := tx.(*ImageTexture).RGBA()
+
+		if img.RGBAAt(20, 20).A != 0xff {
+			t.Errorf("rule %d did not fill the outer square", tt.rule)
+		}
+		if hole := img.RGBAAt(50, 50).A == 0; hole != tt.hole {
+			t.Errorf("rule %d: hole in the inner square = %t", tt.rule, hole)
+		}
+		if a := img.RGBAAt(5, 5).A; a != 0 {
+			t.Errorf("rule %d covered a pixel outside the path: %d", tt.rule, a)
+		}
+	}
+}
+
+func TestEvenOddMask_Antialiased(t *testing.T) {
+	mask := evenOddMask([][]Point{{{0.5, 0}, {2.25, 0}, {2.25, 1}, {0.5, 1}}}, image.Rect(0, 0, 3, 1))
+	if got := mask.Pix; got[0] != 0x80 || got[1] != 0xff || got[2] != 0x40 {
+		t.Errorf("coverage = %v, want [128 255 64]", got)
+	}
+}
+
+func TestPath_Curves(t *testing.T) {
+	var p Path
+	p.MoveTo(Point{0, 0})
+	p.CubeTo(Point{0, 100}, Point{100, 100}, Point{100, 0})
+	p.QuadTo(Point{150, 50}, Point{200, 0})
+
+	if got := p.Current(); got != (Point{200, 0}) {
+		t.Errorf("current point = %v", got)
+	}
+	points := p.subpaths[0].points
+	if len(points) < 10 {
+		t.Fatalf("curves were flattened into %d points", len(points))
+	}
+	// The cubic curve peaks at 75 halfway.
+	if mid := points[len(points)/3]; mid.Y < 60 || mid.Y > 76 {
+		t.Errorf("point %v is off the curve", mid)
+	}
+
+	p.Close()
+	p.LineTo(Point{50, 50})
+	if len(p.subpaths) != 2 || p.subpaths[1].points[0] != (Point{0, 0}) {
+		t.Error("a segment after Close did not start at the closed subpath start")
+	}
+}
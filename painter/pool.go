@@ -0,0 +1,147 @@
+package painter
+
+import (
+	"image"
+	"image/draw"
+	"log"
+	"sync"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// DefaultBuffers is the number of textures of an EventLoop that has no Buffers set: one shown by the Receiver,
+// one waiting to be shown and one being formed.
+const DefaultBuffers = 3
+
+// minBuffers is the smallest number of textures that lets the loop form a frame while the Receiver shows another.
+const minBuffers = 2
+
+// readableTexture is a texture whose pixels can be read back, like ImageTexture and MirroredTexture.
+type readableTexture interface {
+	screen.Texture
+	RGBA() *image.RGBA
+}
+
+// texturePool recycles the textures of an event loop. It allocates textures lazily up to its limit and waits for
+// released ones after that.
+type texturePool struct {
+	screen screen.Screen
+	limit  int
+
+	mu       sync.Mutex
+	released *sync.Cond              // Signaled when a texture is released
+	size     image.Point             // Size of the pooled textures
+	textures map[screen.Texture]bool // Pooled textures, whether free or not
+	free     []screen.Texture        // Pooled textures nobody uses
+	closed   bool
+
+	buf screen.Buffer // Staging buffer of copy, of the pool size
+}
+
+func newTexturePool(s screen.Screen, size image.Point, limit int) *texturePool {
+	p := &texturePool{
+		screen:   s,
+		limit:    max(limit, minBuffers),
+		size:     size,
+		textures: make(map[screen.Texture]bool),
+	}
+	p.released = sync.NewCond(&p.mu)
+	return p
+}
+
+// acquire returns a texture of the pool size that nobody uses, or the error of the screen if it fails to allocate
+// one.
+func (p *texturePool) acquire() (screen.Texture, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.free) == 0 && len(p.textures) >= p.limit {
+		p.released.Wait()
+	}
+	if n := len(p.free); n > 0 {
+		t := p.free[n-1]
+		p.free = p.free[:n-1]
+		return t, nil
+	}
+
+	t, err := p.screen.NewTexture(p.size)
+	if err != nil {
+		return nil, err
+	}
+	p.textures[t] = true
+	return t, nil
+}
+
+// release returns a texture to the pool. Textures that no longer belong to it, because of a resize or close,
+// are destroyed instead.
+func (p *texturePool) release(t screen.Texture) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || !p.textures[t] {
+		t.Release()
+		return
+	}
+	p.free = append(p.free, t)
+	p.released.Signal()
+}
+
+// resize makes the pool allocate textures of a new size. Free textures are destroyed now, the others once they
+// are released.
+func (p *texturePool) resize(size image.Point) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.destroyFree()
+	p.textures = make(map[screen.Texture]bool)
+	p.size = size
+	p.released.Broadcast()
+}
+
+// close destroys the free textures. Textures in use are destroyed once they are released.
+func (p *texturePool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.destroyFree()
+	p.closed = true
+}
+
+func (p *texturePool) destroyFree() {
+	for _, t := range p.free {
+		t.Release()
+	}
+	p.free = nil
+	if p.buf != nil {
+		p.buf.Release()
+		p.buf = nil
+	}
+}
+
+// copy draws the pixels of src into dst. It does nothing unless src is readable and of the same size as dst.
+// It must not run concurrently with itself.
+func (p *texturePool) copy(dst, src screen.Texture) {
+	rt, ok := readable(src)
+	if !ok || src.Size() != dst.Size() {
+		return
+	}
+
+	p.mu.Lock()
+	buf := p.buf
+	if buf == nil || buf.Size() != dst.Size() {
+		var err error
+		if buf, err = p.screen.NewBuffer(dst.Size()); err != nil {
+			p.mu.Unlock()
+			log.Printf("Failed to allocate a buffer: %s", err)
+			return
+		}
+		if p.buf != nil {
+			p.buf.Release()
+		}
+		p.buf = buf
+	}
+	p.mu.Unlock()
+
+	draw.Draw(buf.RGBA(), buf.Bounds(), rt.RGBA(), image.Point{}, draw.Src)
+	dst.Upload(image.Point{}, buf, buf.Bounds())
+}
@@ -0,0 +1,120 @@
+package painter
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+func TestEventLoop_PreserveContents(t *testing.T) {
+	for _, preserve := range []bool{false, true} {
+		hr := make(holdingReceiver, DefaultBuffers)
+		el := &EventLoop{Receiver: hr, Size: image.Pt(2, 1), PreserveContents: preserve}
+		el.Initiate(OffscreenScreen{})
+
+		// The second frame is formed on a texture the first one was not drawn into.
+		el.Enqueue(FillTexture(color.White), MarkUpdated)
+		first := <-hr
+		first.release()
+		el.Enqueue(TextureFunc(func(t screen.Texture) {
+			t.Fill(image.Rect(1, 0, 2, 1), color.Black, draw.Src)
+		}), MarkUpdated)
+		second := <-hr
+		second.release()
+		el.Terminate()
+
+		got := second.t.(*ImageTexture).RGBA().RGBAAt(0, 0)
+		if want := (got == color.RGBA{255, 255, 255, 255}); want != preserve {
+			t.Errorf("PreserveContents = %t: untouched pixel of the second frame is %v", preserve, got)
+		}
+	}
+}
+
+func TestEventLoop_Buffers(t *testing.T) {
+	var s countingScreen
+	hr := make(holdingReceiver, 4)
+	el := &EventLoop{Receiver: hr, Buffers: 5}
+	el.Initiate(&s)
+
+	var held []heldTexture
+	for range 4 {
+		el.Enqueue(MarkUpdated)
+		held = append(held, <-hr)
+	}
+	if got := s.allocated.Load(); got != 5 {
+		t.Errorf("allocated %d textures, want 5", got)
+	}
+
+	el.Terminate()
+	if got := s.released.Load(); got != 1 {
+		t.Errorf("Terminate released %d textures, want the one the Receiver does not own", got)
+	}
+
+	for _, f := range held {
+		f.release()
+	}
+	if got := s.released.Load(); got != 5 {
+		t.Errorf("released %d of 5 textures after the Receiver released its own", got)
+	}
+}
+
+func TestEventLoop_AllocationFailure(t *testing.T) {
+	s := &failingScreen{}
+	s.failures.Store(2) // Initiate and the first frame fail to allocate
+	hr := make(holdingReceiver, 1)
+	el := &EventLoop{Receiver: hr, Size: image.Pt(2, 1)}
+	el.Initiate(s)
+	defer el.Terminate()
+
+	// The frame enqueued while no texture can be allocated is skipped, the next one is presented.
+	el.Enqueue(FillTexture(color.Black), MarkUpdated)
+	el.Enqueue(FillTexture(color.White), MarkUpdated)
+	f := <-hr
+	defer f.release()
+	if f.t == nil {
+		t.Fatal("a nil texture was presented")
+	}
+	if got := f.t.(*ImageTexture).RGBA().RGBAAt(0, 0); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("presented frame has %v, want white", got)
+	}
+	if el.Frame() != 1 {
+		t.Errorf("presented %d frames, want 1", el.Frame())
+	}
+}
+
+// failingScreen fails to allocate textures until it has been asked for the given number of them.
+type failingScreen struct {
+	OffscreenScreen
+	failures atomic.Int32
+}
+
+func (s *failingScreen) NewTexture(size image.Point) (screen.Texture, error) {
+	if s.failures.Add(-1) >= 0 {
+		return nil, errors.New("out of textures")
+	}
+	return s.OffscreenScreen.NewTexture(size)
+}
+
+// countingScreen counts the textures it allocates and how many of them have been released.
+type countingScreen struct {
+	OffscreenScreen
+	allocated, released atomic.Int32
+}
+
+func (s *countingScreen) NewTexture(size image.Point) (screen.Texture, error) {
+	s.allocated.Add(1)
+	t, _ := s.OffscreenScreen.NewTexture(size)
+	return &countedTexture{ImageTexture: t.(*ImageTexture), released: &s.released}, nil
+}
+
+type countedTexture struct {
+	*ImageTexture
+	released *atomic.Int32
+}
+
+func (t *countedTexture) Release() { t.released.Add(1) }
@@ -0,0 +1,385 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/image/vector"
+)
+
+// ScreenOperation is a TextureOperation that draws through buffers of the screen the texture belongs to.
+// The EventLoop applies it with ApplyScreen instead of Apply.
+type ScreenOperation interface {
+	TextureOperation
+	ApplyScreen(t screen.Texture, s screen.Screen) (ready bool)
+}
+
+// ApplyScreen applies the operations, passing the screen to those that need it.
+func (co CompositeOperation) ApplyScreen(t screen.Texture, s screen.Screen) (ready bool) {
+	for _, op := range co {
+		ready = applyOn(op, t, s) || ready
+	}
+	return
+}
+
+// applyOn applies op to the texture t of the screen s.
+func applyOn(op TextureOperation, t screen.Texture, s screen.Screen) bool {
+	if so, ok := op.(ScreenOperation); ok {
+		return so.ApplyScreen(t, s)
+	}
+	return op.Apply(t)
+}
+
+// Point is a point in texture pixels with subpixel precision.
+type Point struct {
+	X, Y float64
+}
+
+// Paint describes how a rasterized primitive is drawn.
+type Paint struct {
+	Color color.Color // DefaultShapeColor if nil
+	Op    draw.Op
+
+	// Gradient, if set, is drawn instead of Color, laid over the bounds of the primitive.
+	Gradient Gradient
+
+	// Width is the stroke width in pixels. Primitives with a positive width are outlined, the others are filled.
+	Width float64
+}
+
+// source returns the image that paints a primitive with the given bounds.
+func (p Paint) source(box image.Rectangle) image.Image {
+	switch {
+	case p.Gradient != nil:
+		return p.Gradient.Image(box)
+	case p.Color == nil:
+		return image.NewUniform(DefaultShapeColor)
+	default:
+		return image.NewUniform(p.Color)
+	}
+}
+
+// Raster is a TextureOperation that draws anti-aliased contours. Filled contours follow the fill rule. Stroked
+// contours get butt caps and bevel joins.
+type Raster struct {
+	Contours [][]Point
+	Closed   bool     // Whether stroked contours are closed
+	Rule     FillRule // Fill rule of filled contours
+	Paint    Paint
+
+	// Transform maps the contours into the texture after they are stroked, so strokes are transformed too.
+	// The zero value is Identity.
+	Transform Affine
+}
+
+// DrawLine creates an operation that draws a line between two points. Lines are always stroked, with a width of
+// one pixel if paint has none.
+func DrawLine(from, to Point, paint Paint) *Raster {
+	if paint.Width <= 0 {
+		paint.Width = 1
+	}
+	return &Raster{Contours: [][]Point{{from, to}}, Paint: paint}
+}
+
+// DrawPolygon creates an operation that fills or outlines the polygon with the given vertices.
+func DrawPolygon(points []Point, paint Paint) *Raster {
+	return &Raster{Contours: [][]Point{points}, Closed: true, Paint: paint}
+}
+
+// DrawEllipse creates an operation that fills or outlines an axis-aligned ellipse. A circle has equal radii.
+func DrawEllipse(center Point, rx, ry float64, paint Paint) *Raster {
+	return &Raster{Contours: [][]Point{ellipsePoints(center, rx, ry, 0, 360)}, Closed: true, Paint: paint}
+}
+
+// DrawArc creates an operation that strokes the part of an ellipse from the start to the end angle in degrees.
+// Angles grow clockwise from the positive X axis, as Y points down. Arcs are always stroked, with a width of one
+// pixel if paint has none.
+func DrawArc(center Point, rx, ry, start, end float64, paint Paint) *Raster {
+	if paint.Width <= 0 {
+		paint.Width = 1
+	}
+	return &Raster{Contours: [][]Point{ellipsePoints(center, rx, ry, start, end)}, Paint: paint}
+}
+
+// ellipsePoints approximates the part of an ellipse between two angles in degrees with a polyline whose segments
+// are at most about two pixels long, but no more than 1000 of them. Sweeps beyond a full turn are drawn as one.
+func ellipsePoints(c Point, rx, ry, start, end float64) []Point {
+	sweep := min(max(end-start, -360), 360) * math.Pi / 180
+	n := 8
+	if segments := math.Ceil(math.Abs(sweep) * max(math.Abs(rx), math.Abs(ry)) / 2); segments > 8 {
+		n = int(min(segments, 1000))
+	}
+
+	points := make([]Point, 0, n+1)
+	for i := 0; i <= n; i++ {
+		a := start*math.Pi/180 + sweep*float64(i)/float64(n)
+		points = append(points, Point{c.X + rx*math.Cos(a), c.Y + ry*math.Sin(a)})
+	}
+	return points
+}
+
+// Apply draws the primitive with Fill calls, which works with any texture. Pixels covered partially are blended
+// over the texture even with draw.Src, as their previous color is unknown.
+func (r *Raster) Apply(t screen.Texture) bool {
+	if mask, origin, box := r.mask(t.Bounds()); mask != nil {
+		fillMask(t, mask, origin, r.Paint.source(box), r.Paint.Op)
+	}
+	return false
+}
+
+// ApplyScreen draws the primitive into a buffer of s and uploads it into the texture. Textures whose pixels can
+// be read back, such as those of OffscreenScreen and MirrorScreen, are composited exactly; others are drawn
+// like Apply does.
+func (r *Raster) ApplyScreen(t screen.Texture, s screen.Screen) bool {
+	if mask, origin, box := r.mask(t.Bounds()); mask != nil {
+		compositeMask(t, s, mask, origin, r.Paint.source(box), r.Paint.Op)
+	}
+	return false
+}
+
+// compositeMask draws src, in texture pixels, through the mask, whose top left pixel is at origin in the texture,
+// using a buffer of s. Textures that cannot be read back are drawn with fillMask instead.
+func compositeMask(t screen.Texture, s screen.Screen, mask *image.Alpha, origin image.Point, src image.Image, op draw.Op) {
+	rt, ok := readable(t)
+	if !ok {
+		fillMask(t, mask, origin, src, op)
+		return
+	}
+	buf, err := s.NewBuffer(mask.Rect.Size())
+	if err != nil {
+		log.Printf("Failed to allocate a buffer: %s", err)
+		fillMask(t, mask, origin, src, op)
+		return
+	}
+	defer buf.Release()
+
+	dst := buf.RGBA()
+	draw.Draw(dst, dst.Bounds(), rt.RGBA(), origin, draw.Src)
+	draw.DrawMask(dst, dst.Bounds(), src, origin, mask, image.Point{}, op)
+	t.Upload(origin, buf, dst.Bounds())
+}
+
+// mask rasterizes the primitive into a coverage mask of the part of bounds it touches. The mask starts at the
+// origin; origin is the position of its top left pixel in the texture and box the bounds of the whole primitive.
+// It returns nil if nothing is covered.
+func (r *Raster) mask(bounds image.Rectangle) (mask *image.Alpha, origin image.Point, box image.Rectangle) {
+	polygons := r.Contours
+	if r.Paint.Width > 0 {
+		polygons = nil
+		for _, c := range r.Contours {
+			polygons = append(polygons, strokePolygons(c, r.Closed, r.Paint.Width)...)
+		}
+	}
+	if !r.Transform.IsIdentity() {
+		polygons = transformPolygons(polygons, r.Transform)
+	}
+
+	extent := image.Rectangle{}
+	for _, p := range polygons {
+		for _, pt := range p {
+			px := image.Rect(clampPixel(math.Floor(pt.X)), clampPixel(math.Floor(pt.Y)), clampPixel(math.Ceil(pt.X))+1, clampPixel(math.Ceil(pt.Y))+1)
+			extent = extent.Union(px)
+		}
+	}
+	box = extent
+	extent = extent.Intersect(bounds)
+	if extent.Empty() {
+		return nil, image.Point{}, box
+	}
+	// The rasterizer walks every edge in full, so edges far outside the extent would take long or overflow it.
+	clipped := make([][]Point, len(polygons))
+	for i, p := range polygons {
+		clipped[i] = clipPolygon(p, extent.Inset(-1))
+	}
+	polygons = clipped
+
+	if r.Rule == EvenOdd && r.Paint.Width <= 0 {
+		return evenOddMask(polygons, extent), extent.Min, box
+	}
+
+	z := vector.NewRasterizer(extent.Dx(), extent.Dy())
+	for _, p := range polygons {
+		if len(p) < 3 {
+			continue
+		}
+		z.MoveTo(float32(p[0].X-float64(extent.Min.X)), float32(p[0].Y-float64(extent.Min.Y)))
+		for _, pt := range p[1:] {
+			z.LineTo(float32(pt.X-float64(extent.Min.X)), float32(pt.Y-float64(extent.Min.Y)))
+		}
+		z.ClosePath()
+	}
+	mask = image.NewAlpha(z.Bounds())
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	return mask, extent.Min, box
+}
+
+// maxPixel bounds the pixel coordinates mask converts points to, so that points far outside any texture do not
+// overflow an int.
+const maxPixel = 1 << 30
+
+func clampPixel(v float64) int {
+	return int(math.Max(-maxPixel, math.Min(maxPixel, v)))
+}
+
+// clipPolygon returns the part of the polygon inside r by the Sutherland-Hodgman algorithm. Where the polygon
+// leaves r, edges along the borders of r replace it, so the winding numbers of the points inside r are the same.
+func clipPolygon(polygon []Point, r image.Rectangle) []Point {
+	polygon = clipSide(polygon, func(p Point) float64 { return p.X - float64(r.Min.X) })
+	polygon = clipSide(polygon, func(p Point) float64 { return float64(r.Max.X) - p.X })
+	polygon = clipSide(polygon, func(p Point) float64 { return p.Y - float64(r.Min.Y) })
+	return clipSide(polygon, func(p Point) float64 { return float64(r.Max.Y) - p.Y })
+}
+
+// clipSide returns the part of the polygon where the distance d to a border is not negative.
+func clipSide(polygon []Point, d func(Point) float64) []Point {
+	var clipped []Point
+	for i, a := range polygon {
+		b := polygon[(i+1)%len(polygon)]
+		da, db := d(a), d(b)
+		if da >= 0 {
+			clipped = append(clipped, a)
+		}
+		// The crossing is interpolated from the point inside, which is close to it, to keep its precision.
+		switch {
+		case da >= 0 && db < 0:
+			t := da / (da - db)
+			clipped = append(clipped, Point{a.X + t*(b.X-a.X), a.Y + t*(b.Y-a.Y)})
+		case da < 0 && db >= 0:
+			t := db / (db - da)
+			clipped = append(clipped, Point{b.X + t*(a.X-b.X), b.Y + t*(a.Y-b.Y)})
+		}
+	}
+	return clipped
+}
+
+// transformPolygons returns transformed copies of the polygons.
+func transformPolygons(polygons [][]Point, m Affine) [][]Point {
+	transformed := make([][]Point, len(polygons))
+	for i, p := range polygons {
+		transformed[i] = make([]Point, len(p))
+		for j, pt := range p {
+			transformed[i][j] = m.Apply(pt)
+		}
+	}
+	return transformed
+}
+
+// strokePolygons returns polygons whose union is the outline of the polyline with the given width: a quad for
+// every segment and a triangle filling the outer side of every joint. All of them are oriented the same way,
+// so the non-zero rule unites them instead of cancelling overlaps.
+func strokePolygons(points []Point, closed bool, width float64) [][]Point {
+	if closed && len(points) > 1 {
+		points = append(points[:len(points):len(points)], points[0])
+	}
+
+	half := width / 2
+	var (
+		polygons [][]Point
+		first    []Point // Quad of the first segment
+		prev     []Point // Quad of the previous segment
+	)
+	for i := 0; i+1 < len(points); i++ {
+		a, b := points[i], points[i+1]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+		nx, ny := -dy/length*half, dx/length*half
+		quad := []Point{{a.X + nx, a.Y + ny}, {b.X + nx, b.Y + ny}, {b.X - nx, b.Y - ny}, {a.X - nx, a.Y - ny}}
+		polygons = append(polygons, oriented(quad))
+		if prev != nil {
+			polygons = append(polygons, joint(a, prev, quad)...)
+		} else {
+			first = quad
+		}
+		prev = quad
+	}
+	if closed && prev != nil && len(points) > 2 {
+		polygons = append(polygons, joint(points[0], prev, first)...)
+	}
+	return polygons
+}
+
+// joint returns the triangles between the ends of the quads of two segments meeting at p.
+func joint(p Point, from, to []Point) [][]Point {
+	return [][]Point{
+		oriented([]Point{p, from[1], to[0]}),
+		oriented([]Point{p, from[2], to[3]}),
+	}
+}
+
+// oriented returns the polygon with its vertices in clockwise order, as a reversed copy if needed.
+func oriented(polygon []Point) []Point {
+	area := 0.0
+	for i, p := range polygon {
+		q := polygon[(i+1)%len(polygon)]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	if area >= 0 {
+		return polygon
+	}
+	reversed := make([]Point, len(polygon))
+	for i, p := range polygon {
+		reversed[len(polygon)-1-i] = p
+	}
+	return reversed
+}
+
+// fillMask draws src, in texture pixels, through the mask with one Fill call per run of equally colored pixels.
+func fillMask(t screen.Texture, mask *image.Alpha, origin image.Point, src image.Image, op draw.Op) {
+	uniform, isUniform := src.(*image.Uniform)
+	scaled := func(c color.Color, coverage uint8) color.Color {
+		r, g, b, a := c.RGBA()
+		m := uint32(coverage) * 0x101
+		return color.RGBA64{R: uint16(r * m / 0xffff), G: uint16(g * m / 0xffff), B: uint16(b * m / 0xffff), A: uint16(a * m / 0xffff)}
+	}
+	// colorAt returns the color of a mask pixel, full if it is covered entirely.
+	colorAt := func(x, y int) (c color.Color, full bool) {
+		coverage := mask.Pix[y*mask.Stride+x]
+		if isUniform {
+			c = uniform.C
+		} else {
+			c = src.At(x+origin.X, y+origin.Y)
+		}
+		if coverage == 0xff {
+			return c, true
+		}
+		return scaled(c, coverage), false
+	}
+
+	size := mask.Rect.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; {
+			c, full := colorAt(x, y)
+			end := x + 1
+			for end < size.X {
+				next, nextFull := colorAt(end, y)
+				if nextFull != full || !sameRGBA(next, c) {
+					break
+				}
+				end++
+			}
+			if _, _, _, a := c.RGBA(); a > 0 || (full && op == draw.Src) {
+				dr := image.Rect(x, y, end, y+1).Add(origin)
+				if full {
+					t.Fill(dr, c, op)
+				} else {
+					t.Fill(dr, c, draw.Over)
+				}
+			}
+			x = end
+		}
+	}
+}
+
+// sameRGBA reports whether two colors have identical premultiplied values.
+func sameRGBA(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
@@ -0,0 +1,135 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestRaster(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	paint := func(op TextureOperation, screen bool) *image.RGBA {
+		tx, _ := OffscreenScreen{}.NewTexture(image.Pt(100, 100))
+		FillTexture(color.White).Apply(tx)
+		if screen {
+			applyOn(op, tx, OffscreenScreen{})
+		} else {
+			op.Apply(tx)
+		}
+		return tx.(*ImageTexture).RGBA()
+	}
+
+	tests := []struct {
+		name        string
+		op          *Raster
+		on, off     []image.Point
+		antialiased image.Point
+	}{
+		{
+			name:        "Filled circle",
+			op:          DrawEllipse(Point{50, 50}, 20, 20, Paint{Color: red}),
+			on:          []image.Point{{50, 50}, {35, 50}},
+			off:         []image.Point{{50, 25}, {70, 70}},
+			antialiased: image.Pt(64, 64),
+		},
+		{
+			name:        "Stroked square",
+			op:          DrawPolygon([]Point{{20, 20}, {80, 20}, {80, 80}, {20, 80}}, Paint{Color: red, Width: 4}),
+			on:          []image.Point{{50, 20}, {20, 50}, {81, 50}, {50, 81}, {80, 80}},
+			off:         []image.Point{{50, 50}, {10, 10}},
+			antialiased: image.Pt(-1, -1),
+		},
+		{
+			name:        "Diagonal line",
+			op:          DrawLine(Point{10, 10}, Point{90, 50}, Paint{Color: red, Width: 3}),
+			on:          []image.Point{{50, 30}},
+			off:         []image.Point{{50, 40}, {10, 50}},
+			antialiased: image.Pt(50, 32),
+		},
+		{
+			name:        "Arc",
+			op:          DrawArc(Point{50, 50}, 30, 30, 0, 90, Paint{Color: red, Width: 2}),
+			on:          []image.Point{{50, 80}, {80, 50}},
+			off:         []image.Point{{20, 50}, {50, 20}},
+			antialiased: image.Pt(-1, -1),
+		},
+		{
+			name:        "Stroke much wider than the texture",
+			op:          DrawPolygon([]Point{{20, 20}, {80, 20}, {80, 80}, {20, 80}}, Paint{Color: red, Width: 1e9}),
+			on:          []image.Point{{0, 0}, {50, 50}, {99, 99}},
+			antialiased: image.Pt(-1, -1),
+		},
+		{
+			name:        "Line far beyond the texture",
+			op:          DrawLine(Point{-1e12, 50}, Point{1e12, 50}, Paint{Color: red, Width: 4}),
+			on:          []image.Point{{0, 50}, {50, 49}, {99, 51}},
+			off:         []image.Point{{50, 45}, {50, 55}},
+			antialiased: image.Pt(-1, -1),
+		},
+	}
+
+	for _, tt := range tests {
+		for _, screen := range []bool{false, true} {
+			img := paint(tt.op, screen)
+			for _, p := range tt.on {
+				// Curves are approximated by polylines, so their pixels may miss a little coverage.
+				if c := img.RGBAAt(p.X, p.Y); c.R != 255 || c.G > 16 || c.B > 16 {
+					t.Errorf("%s (screen %t): %v is %v, want red", tt.name, screen, p, c)
+				}
+			}
+			for _, p := range tt.off {
+				if img.RGBAAt(p.X, p.Y) != (color.RGBA{255, 255, 255, 255}) {
+					t.Errorf("%s (screen %t): %v is %v, want white", tt.name, screen, p, img.RGBAAt(p.X, p.Y))
+				}
+			}
+			if p := tt.antialiased; p.X >= 0 {
+				if c := img.RGBAAt(p.X, p.Y); c.G == 0 || c.G == 255 {
+					t.Errorf("%s (screen %t): edge pixel %v is %v, want a blend", tt.name, screen, p, c)
+				}
+			}
+		}
+	}
+}
+
+func TestRaster_Composite(t *testing.T) {
+	tx, _ := OffscreenScreen{}.NewTexture(image.Pt(20, 20))
+	FillTexture(color.White).Apply(tx)
+
+	op := DrawPolygon([]Point{{0, 0}, {20, 0}, {20, 20}, {0, 20}}, Paint{Color: color.NRGBA{B: 255, A: 128}, Op: draw.Src})
+	op.ApplyScreen(tx, OffscreenScreen{})
+	if got := tx.(*ImageTexture).RGBA().RGBAAt(10, 10); got.A != 128 {
+		t.Errorf("Src did not replace the pixels: %v", got)
+	}
+
+	op.Paint.Op = draw.Over
+	op.ApplyScreen(tx, OffscreenScreen{})
+	if got := tx.(*ImageTexture).RGBA().RGBAAt(10, 10); got.A < 190 {
+		t.Errorf("Over did not blend over the pixels: %v", got)
+	}
+}
+
+func TestEllipsePoints_Bounded(t *testing.T) {
+	tests := []struct {
+		name          string
+		r, start, end float64
+		wantMax       int
+	}{
+		{name: "Huge sweep", r: 100, start: 0, end: 1e13, wantMax: 1001},
+		{name: "Huge radius", r: 1e12, start: 0, end: 360, wantMax: 1001},
+		{name: "Infinite", r: 100, start: 0, end: math.Inf(1), wantMax: 1001},
+		{name: "Small", r: 1, start: 0, end: 90, wantMax: 9},
+	}
+	for _, tt := range tests {
+		if got := len(ellipsePoints(Point{}, tt.r, tt.r, tt.start, tt.end)); got > tt.wantMax {
+			t.Errorf("%s: %d points, want at most %d", tt.name, got, tt.wantMax)
+		}
+	}
+
+	// A sweep beyond a full turn ends where a full turn does.
+	points := ellipsePoints(Point{}, 100, 100, 0, 1e13)
+	if end := points[len(points)-1]; math.Abs(end.X-100) > 1e-6 || math.Abs(end.Y) > 1e-6 {
+		t.Errorf("sweep ends at %v", end)
+	}
+}
@@ -0,0 +1,247 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// Shape is a figure that can be drawn, moved and picked on the canvas.
+type Shape interface {
+	// Bounds returns the smallest rectangle containing the shape.
+	Bounds() image.Rectangle
+	// Draw creates an operation that draws the shape where it is now. Later calls to Move do not affect it.
+	Draw() TextureOperation
+	// Move changes the position of the shape by the specified offsets.
+	Move(xOffset, yOffset int)
+	// HitTest reports whether the pixel lies on the shape.
+	HitTest(p image.Point) bool
+}
+
+// ShapeKind is the outline of a BasicShape.
+type ShapeKind int
+
+const (
+	Cross ShapeKind = iota
+	Square
+	Circle
+	Triangle
+	Star
+	Arrow
+)
+
+// DefaultShapeColor is the color of a shape that has no Color set.
+var DefaultShapeColor color.Color = color.RGBA{B: 255, A: 255}
+
+// DefaultShapeSize is the size of a BasicShape that has none.
+const DefaultShapeSize = 100
+
+// BasicShape is a Shape of one of the built-in kinds, placed around its center.
+type BasicShape struct {
+	Kind    ShapeKind
+	CenterX int
+	CenterY int
+
+	// Size is the distance in pixels from the center to the sides of the shape before it is rotated and transformed,
+	// DefaultShapeSize if zero. The arms of a cross are a fifth of it wide on each side of the center.
+	Size int
+	// Rotation is the angle in degrees the shape is turned by clockwise around its center.
+	Rotation float64
+	// Transform is applied after Rotation, with the center of the shape as the origin, so a rotation or a scale
+	// keeps the center in place. The zero value is Identity.
+	Transform Affine
+
+	// Color is the color of the shape, DefaultShapeColor if nil.
+	Color color.Color
+	// Op composites the shape over the texture. The zero value is draw.Over, which blends translucent colors
+	// and is the same as draw.Src for opaque ones.
+	Op draw.Op
+	// Gradient, if set, is drawn instead of Color, laid over the bounds of the shape.
+	Gradient Gradient
+
+	// Stroke, if set, outlines the shape with a line StrokeWidth pixels wide, one pixel if zero.
+	Stroke      color.Color
+	StrokeWidth float64
+}
+
+var _ Shape = (*BasicShape)(nil)
+
+// crossRects returns the vertical part of a cross centered at the given point and the left and right arms of the
+// horizontal part. They do not overlap, so translucent colors are blended once everywhere.
+func crossRects(centerX, centerY, size int) [3]image.Rectangle {
+	arm := size / 5
+	return [3]image.Rectangle{
+		image.Rect(centerX-arm, centerY-size, centerX+arm, centerY+size),
+		image.Rect(centerX-size, centerY-arm, centerX-arm, centerY+arm),
+		image.Rect(centerX+arm, centerY-arm, centerX+size, centerY+arm),
+	}
+}
+
+// Draw implements Shape. A cross that is neither transformed nor stroked is drawn with Fill calls, which keeps
+// its edges sharp on any texture; other shapes are rasterized like DrawPolygon, strokes included in the transform.
+func (s *BasicShape) Draw() TextureOperation {
+	if s.Kind == Cross && math.Mod(s.Rotation, 360) == 0 && s.Transform.IsIdentity() && s.Stroke == nil {
+		return s.drawCross()
+	}
+
+	outline, m := s.outline(), s.transform()
+	fill := DrawPolygon(outline, Paint{Color: s.Color, Op: s.Op, Gradient: s.Gradient})
+	fill.Transform = m
+	ops := CompositeOperation{fill}
+	if s.Stroke != nil {
+		stroke := DrawPolygon(outline, Paint{Color: s.Stroke, Op: s.Op, Width: s.strokeWidth()})
+		stroke.Transform = m
+		ops = append(ops, stroke)
+	}
+	return ops
+}
+
+func (s *BasicShape) drawCross() TextureOperation {
+	rects := crossRects(s.CenterX, s.CenterY, s.size())
+	if s.Gradient != nil {
+		ops := make(CompositeOperation, len(rects))
+		for i, r := range rects {
+			ops[i] = &GradientFill{Rect: r, Gradient: s.Gradient, Op: s.Op, Box: s.Bounds()}
+		}
+		return ops
+	}
+	c, op := s.Color, s.Op
+	if c == nil {
+		c = DefaultShapeColor
+	}
+	return TextureFunc(func(t screen.Texture) {
+		for _, r := range rects {
+			t.Fill(r, c, op)
+		}
+	})
+}
+
+// Outline returns the vertices of the shape in texture pixels.
+func (s *BasicShape) Outline() []Point {
+	points, m := s.outline(), s.transform()
+	for i, p := range points {
+		points[i] = m.Apply(p)
+	}
+	return points
+}
+
+// transform returns the transform that places the outline on the texture.
+func (s *BasicShape) transform() Affine {
+	return Translate(float64(s.CenterX), float64(s.CenterY)).Mul(s.Transform).Mul(Rotate(s.Rotation))
+}
+
+// outline returns the vertices of the shape around the origin, clockwise, before it is rotated and transformed.
+func (s *BasicShape) outline() []Point {
+	size := float64(s.size())
+	var points []Point
+	switch s.Kind {
+	case Square:
+		points = []Point{{-size, -size}, {size, -size}, {size, size}, {-size, size}}
+	case Circle:
+		points = ellipsePoints(Point{}, size, size, 0, 360)
+		points = points[:len(points)-1]
+	case Triangle:
+		// Equilateral, pointing up, with its vertices on the circle of radius size.
+		half := size * math.Sqrt(3) / 2
+		points = []Point{{0, -size}, {half, size / 2}, {-half, size / 2}}
+	case Star:
+		// Five points; the inner vertices lie where the lines between the points cross.
+		inner := size * math.Sin(18*math.Pi/180) / math.Sin(126*math.Pi/180)
+		for i := 0; i < 10; i++ {
+			r := size
+			if i%2 == 1 {
+				r = inner
+			}
+			a := (float64(i)*36 - 90) * math.Pi / 180
+			points = append(points, Point{r * math.Cos(a), r * math.Sin(a)})
+		}
+	case Arrow:
+		// Pointing right, with a shaft as wide as the arms of a cross.
+		shaft := float64(s.size() / 5)
+		points = []Point{{-size, -shaft}, {0, -shaft}, {0, -size / 2}, {size, 0}, {0, size / 2}, {0, shaft}, {-size, shaft}}
+	default:
+		arm := float64(s.size() / 5)
+		points = []Point{
+			{-arm, -size}, {arm, -size}, {arm, -arm}, {size, -arm}, {size, arm}, {arm, arm},
+			{arm, size}, {-arm, size}, {-arm, arm}, {-size, arm}, {-size, -arm}, {-arm, -arm},
+		}
+	}
+	return points
+}
+
+// HitTest implements Shape. Pixels hit the shape if their centers lie inside its outline or on its stroke.
+func (s *BasicShape) HitTest(p image.Point) bool {
+	inv, ok := s.transform().Invert()
+	if !ok {
+		return false
+	}
+	pt := inv.Apply(Point{float64(p.X) + 0.5, float64(p.Y) + 0.5})
+	outline := s.outline()
+	if insidePolygon(outline, pt) {
+		return true
+	}
+	if s.Stroke != nil {
+		for _, polygon := range strokePolygons(outline, true, s.strokeWidth()) {
+			if insidePolygon(polygon, pt) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Bounds implements Shape.
+func (s *BasicShape) Bounds() image.Rectangle {
+	polygons := [][]Point{s.outline()}
+	if s.Stroke != nil {
+		polygons = append(polygons, strokePolygons(polygons[0], true, s.strokeWidth())...)
+	}
+	m := s.transform()
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, polygon := range polygons {
+		for _, p := range polygon {
+			p = m.Apply(p)
+			minX, minY = min(minX, p.X), min(minY, p.Y)
+			maxX, maxY = max(maxX, p.X), max(maxY, p.Y)
+		}
+	}
+	// Rounding absorbs the error of rotations by right angles.
+	const eps = 1e-9
+	return image.Rect(int(math.Floor(minX+eps)), int(math.Floor(minY+eps)), int(math.Ceil(maxX-eps)), int(math.Ceil(maxY-eps)))
+}
+
+// Move implements Shape.
+func (s *BasicShape) Move(xOffset, yOffset int) {
+	s.CenterX += xOffset
+	s.CenterY += yOffset
+}
+
+func (s *BasicShape) size() int {
+	if s.Size <= 0 {
+		return DefaultShapeSize
+	}
+	return s.Size
+}
+
+func (s *BasicShape) strokeWidth() float64 {
+	if s.StrokeWidth <= 0 {
+		return 1
+	}
+	return s.StrokeWidth
+}
+
+// insidePolygon reports whether the point lies inside the polygon by the even-odd rule.
+func insidePolygon(polygon []Point, pt Point) bool {
+	inside := false
+	for i, a := range polygon {
+		b := polygon[(i+1)%len(polygon)]
+		if (a.Y > pt.Y) != (b.Y > pt.Y) && pt.X < a.X+(pt.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y) {
+			inside = !inside
+		}
+	}
+	return inside
+}
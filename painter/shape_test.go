@@ -0,0 +1,133 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBasicShape_Geometry(t *testing.T) {
+	tests := []struct {
+		name   string
+		shape  *BasicShape
+		bounds image.Rectangle
+		hit    []image.Point
+		miss   []image.Point
+	}{
+		{
+			name:   "Cross",
+			shape:  &BasicShape{CenterX: 200, CenterY: 200},
+			bounds: image.Rect(100, 100, 300, 300),
+			hit:    []image.Point{{200, 200}, {100, 180}, {219, 299}},
+			miss:   []image.Point{{150, 150}, {220, 299}, {300, 200}},
+		},
+		{
+			name:   "Square",
+			shape:  &BasicShape{Kind: Square, CenterX: 200, CenterY: 200, Size: 50},
+			bounds: image.Rect(150, 150, 250, 250),
+			hit:    []image.Point{{150, 150}, {249, 249}},
+			miss:   []image.Point{{250, 200}, {149, 200}},
+		},
+		{
+			name:   "RotatedSquare",
+			shape:  &BasicShape{Kind: Square, CenterX: 200, CenterY: 200, Size: 50, Rotation: 45},
+			bounds: image.Rect(129, 129, 271, 271),
+			hit:    []image.Point{{200, 135}, {265, 200}},
+			miss:   []image.Point{{152, 152}, {248, 248}},
+		},
+		{
+			name:   "Circle",
+			shape:  &BasicShape{Kind: Circle, CenterX: 200, CenterY: 200, Size: 50},
+			bounds: image.Rect(150, 150, 250, 250),
+			hit:    []image.Point{{200, 151}, {160, 200}},
+			miss:   []image.Point{{152, 152}, {250, 200}},
+		},
+		{
+			name:   "Triangle",
+			shape:  &BasicShape{Kind: Triangle, CenterX: 200, CenterY: 200, Size: 100},
+			bounds: image.Rect(113, 100, 287, 250),
+			hit:    []image.Point{{200, 110}, {120, 248}},
+			miss:   []image.Point{{120, 110}, {200, 251}},
+		},
+		{
+			name:   "Star",
+			shape:  &BasicShape{Kind: Star, CenterX: 200, CenterY: 200, Size: 100},
+			bounds: image.Rect(104, 100, 296, 281),
+			hit:    []image.Point{{200, 105}, {200, 200}},
+			miss:   []image.Point{{200, 270}, {150, 140}},
+		},
+		{
+			name:   "Arrow",
+			shape:  &BasicShape{Kind: Arrow, CenterX: 200, CenterY: 200, Size: 100, Rotation: 90},
+			bounds: image.Rect(150, 100, 250, 300),
+			hit:    []image.Point{{200, 295}, {190, 110}, {240, 205}},
+			miss:   []image.Point{{170, 150}, {240, 250}},
+		},
+		{
+			name:   "Stroked",
+			shape:  &BasicShape{Kind: Square, CenterX: 200, CenterY: 200, Size: 50, Stroke: color.Black, StrokeWidth: 10},
+			bounds: image.Rect(145, 145, 255, 255),
+			hit:    []image.Point{{253, 200}},
+			miss:   []image.Point{{256, 200}},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.shape.Bounds(); got != tt.bounds {
+			t.Errorf("%s: Bounds() = %v, want %v", tt.name, got, tt.bounds)
+		}
+		for _, p := range tt.hit {
+			if !tt.shape.HitTest(p) {
+				t.Errorf("%s: %v does not hit the shape", tt.name, p)
+			}
+		}
+		for _, p := range tt.miss {
+			if tt.shape.HitTest(p) {
+				t.Errorf("%s: %v hits the shape", tt.name, p)
+			}
+		}
+	}
+}
+
+func TestBasicShape_Draw(t *testing.T) {
+	red, white := color.RGBA{R: 255, A: 255}, color.RGBA{255, 255, 255, 255}
+	shapes := []*BasicShape{
+		{CenterX: 200, CenterY: 200, Color: red},
+		{Kind: Star, CenterX: 200, CenterY: 200, Color: red},
+		{Kind: Square, CenterX: 200, CenterY: 200, Size: 60, Rotation: 30, Color: red, Stroke: color.Black, StrokeWidth: 4},
+		{CenterX: 200, CenterY: 200, Rotation: 45, Color: red},
+	}
+
+	for _, shape := range shapes {
+		for _, screen := range []bool{false, true} {
+			tx, _ := OffscreenScreen{}.NewTexture(image.Pt(400, 400))
+			FillTexture(color.White).Apply(tx)
+			if screen {
+				applyOn(shape.Draw(), tx, OffscreenScreen{})
+			} else {
+				shape.Draw().Apply(tx)
+			}
+
+			img := tx.(*ImageTexture).RGBA()
+			b := shape.Bounds()
+			for y := 0; y < 400; y++ {
+				for x := 0; x < 400; x++ {
+					p := image.Pt(x, y)
+					got := img.RGBAAt(x, y)
+					switch {
+					case !p.In(b) && got != white:
+						t.Errorf("%+v (screen %t): %v outside the bounds is %v", shape, screen, p, got)
+						return
+					case shape.HitTest(p) && !p.In(b):
+						t.Errorf("%+v: %v hits the shape outside its bounds", shape, p)
+						return
+					}
+				}
+			}
+			center := img.RGBAAt(shape.CenterX, shape.CenterY)
+			if center != red {
+				t.Errorf("%+v (screen %t): center is %v", shape, screen, center)
+			}
+		}
+	}
+}
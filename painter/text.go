@@ -0,0 +1,169 @@
+package painter
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"os"
+
+	"golang.org/x/exp/shiny/screen"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultTextSize is the size of Text that has none, the native size of the bundled font.
+const DefaultTextSize = 13
+
+// Align tells which part of a text is placed at its position.
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+)
+
+// Font is a TrueType or OpenType font. It is safe for concurrent use.
+type Font struct {
+	f *opentype.Font
+}
+
+// ParseFont parses a TrueType or OpenType font.
+func ParseFont(data []byte) (*Font, error) {
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Font{f: f}, nil
+}
+
+// LoadFont reads a TrueType or OpenType font from a file.
+func LoadFont(path string) (*Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFont(data)
+}
+
+// Text is a TextureOperation that draws a line of UTF-8 text. Glyphs are anti-aliased and drawn with the color
+// or gradient and the composite operator of Paint; its width is ignored.
+type Text struct {
+	Text  string
+	Pos   Point   // Point on the baseline where the text is aligned
+	Size  float64 // Height of the em in pixels, DefaultTextSize if zero
+	Align Align
+	Font  *Font // The bundled 7x13 bitmap font scaled to Size if nil
+	Paint Paint
+}
+
+// Apply draws the text with Fill calls, which works with any texture. See Raster.Apply for its limits.
+func (tx *Text) Apply(t screen.Texture) bool {
+	if glyphs, box := tx.glyphs(t.Bounds()); glyphs != nil {
+		mask, origin := clipMask(glyphs, t.Bounds())
+		fillMask(t, mask, origin, tx.Paint.source(box), tx.Paint.Op)
+	}
+	return false
+}
+
+// ApplyScreen draws the text into a buffer of s and uploads it into the texture, like Raster.ApplyScreen.
+func (tx *Text) ApplyScreen(t screen.Texture, s screen.Screen) bool {
+	if glyphs, box := tx.glyphs(t.Bounds()); glyphs != nil {
+		mask, origin := clipMask(glyphs, t.Bounds())
+		compositeMask(t, s, mask, origin, tx.Paint.source(box), tx.Paint.Op)
+	}
+	return false
+}
+
+// face returns the face that renders the text and the factor its glyphs are scaled by.
+func (tx *Text) face() (font.Face, float64, error) {
+	size := tx.Size
+	if size <= 0 {
+		size = DefaultTextSize
+	}
+	if tx.Font == nil {
+		return basicfont.Face7x13, size / DefaultTextSize, nil
+	}
+	face, err := opentype.NewFace(tx.Font.f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	return face, 1, err
+}
+
+// glyphs renders the part of the glyphs inside bounds into a coverage mask in texture pixels, and returns it
+// with the bounds of the whole text. Only the visible part is allocated, so large texts stay cheap. It returns
+// nil if there is nothing to draw.
+func (tx *Text) glyphs(bounds image.Rectangle) (*image.Alpha, image.Rectangle) {
+	face, scale, err := tx.face()
+	if err != nil {
+		return nil, image.Rectangle{}
+	}
+	defer face.Close()
+
+	extent, advance := font.BoundString(face, tx.Text)
+	if extent.Empty() {
+		return nil, image.Rectangle{}
+	}
+	x := tx.Pos.X - fromFixed(advance)*scale*float64(tx.Align)/2
+
+	if scale == 1 {
+		dot := fixed.Point26_6{X: toFixed(x), Y: toFixed(tx.Pos.Y)}
+		box := pixelRect(extent.Add(dot))
+		visible := box.Intersect(bounds)
+		if visible.Empty() {
+			return nil, box
+		}
+		glyphs := image.NewAlpha(visible)
+		d := font.Drawer{Dst: glyphs, Src: image.Opaque, Face: face, Dot: dot}
+		d.DrawString(tx.Text)
+		return glyphs, box
+	}
+
+	// Bitmap glyphs are drawn at their native size and scaled afterwards.
+	r := pixelRect(extent)
+	box := image.Rect(
+		int(math.Floor(x+float64(r.Min.X)*scale)), int(math.Floor(tx.Pos.Y+float64(r.Min.Y)*scale)),
+		int(math.Ceil(x+float64(r.Max.X)*scale)), int(math.Ceil(tx.Pos.Y+float64(r.Max.Y)*scale)))
+	visible := box.Intersect(bounds)
+	if visible.Empty() {
+		return nil, box
+	}
+	native := image.NewAlpha(r)
+	d := font.Drawer{Dst: native, Src: image.Opaque, Face: face}
+	d.DrawString(tx.Text)
+
+	// Scale would allocate a row of the whole text; Transform only visits the visible pixels. The matrix maps
+	// the native glyphs onto box as Scale does.
+	sx, sy := float64(box.Dx())/float64(r.Dx()), float64(box.Dy())/float64(r.Dy())
+	m := f64.Aff3{sx, 0, float64(box.Min.X) - float64(r.Min.X)*sx, 0, sy, float64(box.Min.Y) - float64(r.Min.Y)*sy}
+	scaled := image.NewAlpha(visible)
+	xdraw.BiLinear.Transform(scaled, m, native, r, xdraw.Src, nil)
+	return scaled, box
+}
+
+// clipMask copies the part of the mask inside bounds into a mask that starts at the origin, and returns it with
+// the position of its top left pixel. It returns nil if they do not intersect.
+func clipMask(mask *image.Alpha, bounds image.Rectangle) (*image.Alpha, image.Point) {
+	r := mask.Rect.Intersect(bounds)
+	if r.Empty() {
+		return nil, image.Point{}
+	}
+	clipped := image.NewAlpha(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(clipped, clipped.Rect, mask, r.Min, draw.Src)
+	return clipped, r.Min
+}
+
+// pixelRect returns the smallest rectangle of whole pixels containing r.
+func pixelRect(r fixed.Rectangle26_6) image.Rectangle {
+	return image.Rect(r.Min.X.Floor(), r.Min.Y.Floor(), r.Max.X.Ceil(), r.Max.Y.Ceil())
+}
+
+func toFixed(v float64) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(v * 64))
+}
+
+func fromFixed(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
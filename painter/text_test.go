@@ -0,0 +1,107 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestText(t *testing.T) {
+	regular, err := ParseFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := color.RGBA{R: 255, A: 255}
+
+	// inked returns the bounds of the pixels that are not white.
+	inked := func(op TextureOperation, screen bool) (image.Rectangle, bool) {
+		tx, _ := OffscreenScreen{}.NewTexture(image.Pt(200, 100))
+		FillTexture(color.White).Apply(tx)
+		if screen {
+			applyOn(op, tx, OffscreenScreen{})
+		} else {
+			op.Apply(tx)
+		}
+		img := tx.(*ImageTexture).RGBA()
+
+		var (
+			b           image.Rectangle
+			antialiased bool
+		)
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 200; x++ {
+				c := img.RGBAAt(x, y)
+				if c.G == 255 {
+					continue
+				}
+				b = b.Union(image.Rect(x, y, x+1, y+1))
+				antialiased = antialiased || c.G != 0
+			}
+		}
+		return b, antialiased
+	}
+
+	for _, font := range []*Font{nil, regular} {
+		for _, screen := range []bool{false, true} {
+			var widths [3]int
+			for _, align := range []Align{AlignLeft, AlignCenter, AlignRight} {
+				op := &Text{Text: "Hello", Pos: Point{100, 60}, Size: 26, Align: align, Font: font, Paint: Paint{Color: red}}
+				b, antialiased := inked(op, screen)
+				if b.Empty() {
+					t.Fatalf("font %v, align %d: nothing drawn", font, align)
+				}
+				if b.Max.Y > 68 || b.Min.Y < 35 {
+					t.Errorf("font %v, align %d: text spans rows %d to %d, want it on the baseline at 60", font, align, b.Min.Y, b.Max.Y)
+				}
+				if !antialiased {
+					t.Errorf("font %v, align %d: glyph edges are not blended", font, align)
+				}
+
+				// The ink is about as wide as the advance, so its middle moves with the alignment.
+				mid := (b.Min.X + b.Max.X) / 2
+				want := map[Align]int{AlignLeft: 100 + b.Dx()/2, AlignCenter: 100, AlignRight: 100 - b.Dx()/2}[align]
+				if mid < want-4 || mid > want+4 {
+					t.Errorf("font %v, align %d: text centered at %d, want %d", font, align, mid, want)
+				}
+				widths[align] = b.Dx()
+			}
+			if widths[0] < 50 {
+				t.Errorf("font %v: text is %d pixels wide, want it scaled to the size", font, widths[0])
+			}
+		}
+	}
+}
+
+func TestText_Visible(t *testing.T) {
+	regular, err := ParseFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The part of a text on a texture is drawn the same as on a wider texture it is moved into.
+	for _, font := range []*Font{nil, regular} {
+		small, _ := OffscreenScreen{}.NewTexture(image.Pt(100, 100))
+		wide, _ := OffscreenScreen{}.NewTexture(image.Pt(300, 100))
+		(&Text{Text: "WWWW", Pos: Point{X: -70, Y: 60}, Size: 40, Font: font, Paint: Paint{Color: color.Black}}).Apply(small)
+		(&Text{Text: "WWWW", Pos: Point{X: 130, Y: 60}, Size: 40, Font: font, Paint: Paint{Color: color.Black}}).Apply(wide)
+		a, b := small.(*ImageTexture).RGBA(), wide.(*ImageTexture).RGBA()
+		inked := false
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 100; x++ {
+				if got, want := a.RGBAAt(x, y), b.RGBAAt(x+200, y); got != want {
+					t.Fatalf("font %v: %d, %d is %v, want %v", font, x, y, got, want)
+				}
+				inked = inked || a.RGBAAt(x, y).A != 0
+			}
+		}
+		if !inked {
+			t.Errorf("font %v: nothing is drawn", font)
+		}
+	}
+
+	// Huge bitmap text only allocates the part on the texture.
+	tx, _ := OffscreenScreen{}.NewTexture(image.Pt(100, 100))
+	(&Text{Text: "WWWW", Pos: Point{X: 50, Y: 50}, Size: 1e7, Paint: Paint{Color: color.Black}}).Apply(tx)
+}
@@ -0,0 +1,87 @@
+package painter
+
+import "math"
+
+// Affine is a 2D affine transform that maps (x, y) to (A·x + C·y + E, B·x + D·y + F), like the SVG
+// matrix(a, b, c, d, e, f). Angles grow clockwise, as Y points down.
+//
+// Fields of this type treat the zero value, which would collapse everything into a point, as Identity.
+type Affine struct {
+	A, B, C, D, E, F float64
+}
+
+// Identity is the transform that leaves points where they are.
+var Identity = Affine{A: 1, D: 1}
+
+// Translate returns the transform that moves points by (x, y).
+func Translate(x, y float64) Affine {
+	return Affine{A: 1, D: 1, E: x, F: y}
+}
+
+// Rotate returns the transform that turns points clockwise around the origin by the angle in degrees.
+func Rotate(degrees float64) Affine {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	return Affine{A: cos, B: sin, C: -sin, D: cos}
+}
+
+// Scale returns the transform that stretches points away from the origin by sx horizontally and sy vertically.
+func Scale(sx, sy float64) Affine {
+	return Affine{A: sx, D: sy}
+}
+
+// Skew returns the transform that slants the X axis by ax and the Y axis by ay degrees.
+func Skew(ax, ay float64) Affine {
+	return Affine{A: 1, B: math.Tan(ay * math.Pi / 180), C: math.Tan(ax * math.Pi / 180), D: 1}
+}
+
+// Mul returns the transform that applies n first and then m.
+func (m Affine) Mul(n Affine) Affine {
+	m, n = m.orIdentity(), n.orIdentity()
+	return Affine{
+		A: m.A*n.A + m.C*n.B,
+		B: m.B*n.A + m.D*n.B,
+		C: m.A*n.C + m.C*n.D,
+		D: m.B*n.C + m.D*n.D,
+		E: m.A*n.E + m.C*n.F + m.E,
+		F: m.B*n.E + m.D*n.F + m.F,
+	}
+}
+
+// Apply returns the transformed point.
+func (m Affine) Apply(p Point) Point {
+	m = m.orIdentity()
+	return Point{m.A*p.X + m.C*p.Y + m.E, m.B*p.X + m.D*p.Y + m.F}
+}
+
+// Linear returns the transform without its translation.
+func (m Affine) Linear() Affine {
+	m = m.orIdentity()
+	m.E, m.F = 0, 0
+	return m
+}
+
+// Invert returns the inverse transform. It returns false if the transform collapses the plane into a line or
+// a point and has none.
+func (m Affine) Invert() (Affine, bool) {
+	m = m.orIdentity()
+	det := m.A*m.D - m.B*m.C
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return Affine{}, false
+	}
+	inv := Affine{A: m.D / det, B: -m.B / det, C: -m.C / det, D: m.A / det}
+	inv.E = -(inv.A*m.E + inv.C*m.F)
+	inv.F = -(inv.B*m.E + inv.D*m.F)
+	return inv, true
+}
+
+// IsIdentity reports whether the transform leaves points where they are.
+func (m Affine) IsIdentity() bool {
+	return m.orIdentity() == Identity
+}
+
+func (m Affine) orIdentity() Affine {
+	if m == (Affine{}) {
+		return Identity
+	}
+	return m
+}
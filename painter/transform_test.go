@@ -0,0 +1,99 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestAffine(t *testing.T) {
+	near := func(a, b Point) bool { return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9 }
+
+	tests := []struct {
+		name string
+		m    Affine
+		p    Point
+		want Point
+	}{
+		{name: "Zero", m: Affine{}, p: Point{3, 4}, want: Point{3, 4}},
+		{name: "Translate", m: Translate(10, -5), p: Point{3, 4}, want: Point{13, -1}},
+		{name: "Rotate", m: Rotate(90), p: Point{1, 0}, want: Point{0, 1}},
+		{name: "Scale", m: Scale(2, 3), p: Point{3, 4}, want: Point{6, 12}},
+		{name: "Skew", m: Skew(45, 0), p: Point{0, 2}, want: Point{2, 2}},
+		{name: "Order", m: Translate(10, 0).Mul(Rotate(90)), p: Point{1, 0}, want: Point{10, 1}},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Apply(tt.p); !near(got, tt.want) {
+			t.Errorf("%s: Apply(%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+		inv, ok := tt.m.Invert()
+		if !ok {
+			t.Errorf("%s: no inverse", tt.name)
+		} else if got := inv.Apply(tt.want); !near(got, tt.p) {
+			t.Errorf("%s: inverse maps %v to %v, want %v", tt.name, tt.want, got, tt.p)
+		}
+	}
+
+	if _, ok := Scale(1, 0).Invert(); ok {
+		t.Error("a transform that collapses the plane has an inverse")
+	}
+	if !(Affine{}).IsIdentity() || !Identity.Mul(Identity).IsIdentity() || Rotate(90).IsIdentity() {
+		t.Error("identity is not recognized")
+	}
+}
+
+func TestRaster_Transform(t *testing.T) {
+	red, white := color.RGBA{R: 255, A: 255}, color.RGBA{255, 255, 255, 255}
+	square := []Point{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+
+	// A 10x10 square scaled to 40x20 and moved to (50, 60); its stroke is scaled as well.
+	fill := DrawPolygon(square, Paint{Color: red})
+	fill.Transform = Translate(50, 60).Mul(Scale(4, 2))
+	stroke := DrawPolygon(square, Paint{Color: color.Black, Width: 2})
+	stroke.Transform = fill.Transform
+
+	for _, screen := range []bool{false, true} {
+		tx, _ := OffscreenScreen{}.NewTexture(image.Pt(200, 200))
+		FillTexture(color.White).Apply(tx)
+		if screen {
+			applyOn(CompositeOperation{fill, stroke}, tx, OffscreenScreen{})
+		} else {
+			CompositeOperation{fill, stroke}.Apply(tx)
+		}
+		img := tx.(*ImageTexture).RGBA()
+		for p, want := range map[image.Point]color.RGBA{
+			{70, 70}: red, {60, 70}: red,
+			{51, 70}: {A: 255}, {70, 61}: {A: 255}, {92, 70}: {A: 255},
+			{45, 70}: white, {70, 83}: white, {95, 70}: white,
+		} {
+			if got := img.RGBAAt(p.X, p.Y); got != want {
+				t.Errorf("screen %t: %v is %v, want %v", screen, p, got, want)
+			}
+		}
+	}
+}
+
+func TestBasicShape_Transform(t *testing.T) {
+	shape := &BasicShape{Kind: Square, CenterX: 100, CenterY: 100, Size: 10, Transform: Scale(3, 1)}
+	if got, want := shape.Bounds(), image.Rect(70, 90, 130, 110); got != want {
+		t.Errorf("Bounds() = %v, want %v", got, want)
+	}
+	if !shape.HitTest(image.Pt(125, 100)) || shape.HitTest(image.Pt(100, 112)) {
+		t.Error("HitTest ignores the transform")
+	}
+
+	// Skewing keeps the center and slants the sides.
+	shape.Transform = Skew(45, 0)
+	if got, want := shape.Bounds(), image.Rect(80, 90, 120, 110); got != want {
+		t.Errorf("skewed Bounds() = %v, want %v", got, want)
+	}
+	if !shape.HitTest(image.Pt(117, 108)) || shape.HitTest(image.Pt(83, 108)) {
+		t.Error("HitTest ignores the skew")
+	}
+
+	shape.Transform = Scale(0, 1)
+	if shape.HitTest(image.Pt(100, 100)) {
+		t.Error("a collapsed shape is hit")
+	}
+}
@@ -3,6 +3,7 @@ const dmButton = document.querySelector(".dm-script");
 
 // Base URL for HTTP requests
 const baseURL = "http://127.0.0.1:17000/";
+const wsURL = "ws://127.0.0.1:17000/ws";
 
 // Selectors remain unchanged
 const form = document.querySelector("form");
@@ -53,19 +54,25 @@ gfButton.addEventListener("click", async () => {
 });
 
 // Event listener for 'Draw and Move' button
+// The moves go through one WebSocket so they are applied in order; every message is acknowledged.
 dmButton.addEventListener("click", () => {
-  const urlToDraw = buildURL(["white", "figure 0.1 0.1", "update"]);
-  sendHTTPRequest(urlToDraw)
-    .then((response) => console.log(response))
-    .catch((error) => console.error(error));
+  const moves = 9;
+  const socket = new WebSocket(wsURL);
+  let acks = 0;
 
-  for (let i = 0; i < 9; i++) {
-    setTimeout(() => {
-      console.log(`Request: ${i + 1}`);
-      const urlToMove = buildURL(["move 0.1 0.1", "update"]);
-      sendHTTPRequest(urlToMove)
-        .then((response) => console.log(response))
-        .catch((error) => console.error(error));
-    }, (i + 1) * 1000);
-  }
+  socket.addEventListener("message", (e) => {
+    console.log("Ack:", JSON.parse(e.data));
+    if (++acks === moves + 1) socket.close();
+  });
+  socket.addEventListener("error", (error) => console.error(error));
+
+  socket.addEventListener("open", () => {
+    socket.send(["white", "figure 0.1 0.1", "update"].join("\n"));
+    for (let i = 0; i < moves; i++) {
+      setTimeout(() => {
+        console.log(`Request: ${i + 1}`);
+        socket.send(["move 0.1 0.1", "update"].join("\n"));
+      }, (i + 1) * 1000);
+    }
+  });
 });
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Stats describes the displayed canvas in the debug overlay.
+type Stats struct {
+	Frame       uint64 // Number of the last presented frame
+	FPS         int    // Frames presented during the last second
+	QueueLength int    // Operations waiting in the event loop queue
+	LastScript  string // Last applied command batch
+}
+
+const (
+	hudColumns = 48
+	hudLines   = 4
+	hudPadding = 4
+	hudMargin  = 8
+
+	hudRefreshInterval = 250 * time.Millisecond
+)
+
+var (
+	hudFace       = basicfont.Face7x13
+	hudBackground = color.RGBA{A: 176} // Translucent black, premultiplied
+	hudSize       = image.Pt(hudColumns*hudFace.Advance+2*hudPadding, hudLines*hudFace.Height+2*hudPadding)
+)
+
+// hud draws the debug overlay on the window. It keeps its own buffer and texture, so the canvas texture is
+// never modified.
+type hud struct {
+	buf screen.Buffer
+	tex screen.Texture
+}
+
+// hudText formats the overlay lines. Pointer is the mouse position in canvas pixels, if it is known.
+func hudText(stats Stats, canvas image.Point, pointer *[2]float64) []string {
+	script := strings.Join(strings.Fields(strings.ReplaceAll(stats.LastScript, ",", ", ")), " ")
+	lines := []string{
+		fmt.Sprintf("frame %d  fps %d  queue %d", stats.Frame, stats.FPS, stats.QueueLength),
+		"last " + script,
+		"mouse -",
+		fmt.Sprintf("canvas %dx%d", canvas.X, canvas.Y),
+	}
+	if pointer != nil {
+		x, y := pointer[0], pointer[1]
+		lines[2] = fmt.Sprintf("mouse %.3f %.3f  (%d, %d px)", x/float64(canvas.X), y/float64(canvas.Y), int(math.Floor(x)), int(math.Floor(y)))
+	}
+	for i, line := range lines {
+		// Long lines are cut between runes, so that a script with non-ASCII text stays valid UTF-8.
+		if runes := []rune(line); len(runes) > hudColumns {
+			lines[i] = string(runes[:hudColumns-3]) + "..."
+		}
+	}
+	return lines
+}
+
+// draw renders the lines into the top left corner of the window.
+func (h *hud) draw(s screen.Screen, w screen.Window, window image.Rectangle, lines []string) {
+	if h.tex == nil {
+		var err error
+		if h.buf, err = s.NewBuffer(hudSize); err == nil {
+			h.tex, err = s.NewTexture(hudSize)
+		}
+		if err != nil {
+			log.Printf("Failed to allocate the debug overlay: %s", err)
+			h.release()
+			return
+		}
+	}
+
+	img := h.buf.RGBA()
+	draw.Draw(img, img.Bounds(), image.NewUniform(hudBackground), image.Point{}, draw.Src)
+	d := font.Drawer{Dst: img, Src: image.White, Face: hudFace}
+	for i, line := range lines {
+		d.Dot = fixed.P(hudPadding, hudPadding+i*hudFace.Height+hudFace.Ascent)
+		d.DrawString(line)
+	}
+
+	h.tex.Upload(image.Point{}, h.buf, h.buf.Bounds())
+	w.Copy(window.Min.Add(image.Pt(hudMargin, hudMargin)), h.tex, h.tex.Bounds(), draw.Over, nil)
+}
+
+func (h *hud) release() {
+	if h.buf != nil {
+		h.buf.Release()
+		h.buf = nil
+	}
+	if h.tex != nil {
+		h.tex.Release()
+		h.tex = nil
+	}
+}
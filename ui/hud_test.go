@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestHudText(t *testing.T) {
+	stats := Stats{Frame: 42, FPS: 60, QueueLength: 3, LastScript: "white,\nfigure 0.5 0.5," + strings.Repeat("update,", 10)}
+
+	lines := hudText(stats, image.Pt(800, 400), &[2]float64{200.5, 100})
+	want := []string{
+		"frame 42  fps 60  queue 3",
+		"last white, figure 0.5 0.5, update, update, u...",
+		"mouse 0.251 0.250  (200, 100 px)",
+		"canvas 800x400",
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+
+	if lines := hudText(Stats{}, image.Pt(800, 800), nil); lines[2] != "mouse -" {
+		t.Errorf("unknown pointer is shown as %q", lines[2])
+	}
+
+	lines = hudText(Stats{LastScript: "text 0 0 \"" + strings.Repeat("ж", 60) + "\""}, image.Pt(800, 800), nil)
+	if want := "last text 0 0 \"" + strings.Repeat("ж", 30) + "..."; lines[1] != want {
+		t.Errorf("line with runes = %q, want %q", lines[1], want)
+	}
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mobile/event/key"
+)
+
+// Chord is a key pressed together with modifiers, such as Ctrl+Z.
+type Chord struct {
+	Modifiers key.Modifiers
+	Code      key.Code
+}
+
+// KeyMap binds key chords to the actions passed to Visualizer.OnAction.
+type KeyMap map[Chord]string
+
+// DefaultKeyMap returns the bindings used when Visualizer.Keys is nil.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		{Code: key.CodeLeftArrow}:                    "nudge-left",
+		{Code: key.CodeRightArrow}:                   "nudge-right",
+		{Code: key.CodeUpArrow}:                      "nudge-up",
+		{Code: key.CodeDownArrow}:                    "nudge-down",
+		{Code: key.CodeDeleteForward}:                "delete",
+		{Modifiers: key.ModControl, Code: key.CodeZ}: "undo",
+		{Modifiers: key.ModControl, Code: key.CodeY}: "redo",
+		{Code: key.CodeR}:                            "reset",
+		{Code: key.CodeS}:                            "snapshot",
+		{Code: key.CodeSpacebar}:                     "pause",
+	}
+}
+
+var (
+	modifierNames = []struct {
+		mod  key.Modifiers
+		name string
+	}{
+		{key.ModControl, "Ctrl"},
+		{key.ModAlt, "Alt"},
+		{key.ModShift, "Shift"},
+		{key.ModMeta, "Meta"},
+	}
+
+	keyNames = map[key.Code]string{
+		key.CodeLeftArrow:       "Left",
+		key.CodeRightArrow:      "Right",
+		key.CodeUpArrow:         "Up",
+		key.CodeDownArrow:       "Down",
+		key.CodeDeleteForward:   "Delete",
+		key.CodeDeleteBackspace: "Backspace",
+		key.CodeSpacebar:        "Space",
+		key.CodeReturnEnter:     "Enter",
+		key.CodeTab:             "Tab",
+		key.CodeHome:            "Home",
+		key.CodeEnd:             "End",
+		key.CodePageUp:          "PageUp",
+		key.CodePageDown:        "PageDown",
+	}
+)
+
+func init() {
+	for c := key.CodeA; c <= key.CodeZ; c++ {
+		keyNames[c] = string(rune('A' + c - key.CodeA))
+	}
+	for c := key.Code1; c <= key.Code9; c++ {
+		keyNames[c] = string(rune('1' + c - key.Code1))
+	}
+	keyNames[key.Code0] = "0"
+	for c := key.CodeF1; c <= key.CodeF12; c++ {
+		keyNames[c] = fmt.Sprintf("F%d", c-key.CodeF1+1)
+	}
+}
+
+// ParseChord parses a chord such as "Ctrl+Z", "Shift+Left" or "Space". Names are case-insensitive.
+func ParseChord(s string) (Chord, error) {
+	parts := strings.Split(s, "+")
+	var c Chord
+
+parts:
+	for _, part := range parts[:len(parts)-1] {
+		for _, m := range modifierNames {
+			if strings.EqualFold(part, m.name) {
+				c.Modifiers |= m.mod
+				continue parts
+			}
+		}
+		return c, fmt.Errorf("unknown modifier %q in key %q", part, s)
+	}
+
+	name := parts[len(parts)-1]
+	for code, n := range keyNames {
+		if strings.EqualFold(name, n) {
+			c.Code = code
+			return c, nil
+		}
+	}
+	return c, fmt.Errorf("unknown key %q", s)
+}
+
+func (c Chord) String() string {
+	var b strings.Builder
+	for _, m := range modifierNames {
+		if c.Modifiers&m.mod != 0 {
+			b.WriteString(m.name + "+")
+		}
+	}
+	if name, ok := keyNames[c.Code]; ok {
+		b.WriteString(name)
+	} else {
+		fmt.Fprintf(&b, "Code(%d)", c.Code)
+	}
+	return b.String()
+}
+
+// chordOf returns the chord of a key event.
+func chordOf(e key.Event) Chord {
+	var mods key.Modifiers
+	for _, m := range modifierNames {
+		mods |= e.Modifiers & m.mod
+	}
+	return Chord{Modifiers: mods, Code: e.Code}
+}
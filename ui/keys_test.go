@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestParseChord(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Chord
+	}{
+		{"ctrl+z", Chord{Modifiers: key.ModControl, Code: key.CodeZ}},
+		{"Shift+Left", Chord{Modifiers: key.ModShift, Code: key.CodeLeftArrow}},
+		{"Space", Chord{Code: key.CodeSpacebar}},
+		{"F5", Chord{Code: key.CodeF5}},
+		{"0", Chord{Code: key.Code0}},
+	}
+	for _, tt := range tests {
+		got, err := ParseChord(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseChord(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+		if again, _ := ParseChord(got.String()); again != got {
+			t.Errorf("%v does not round-trip through String(): %q", got, got.String())
+		}
+	}
+
+	for _, in := range []string{"Hyper+Z", "Ctrl+", "Banana"} {
+		if _, err := ParseChord(in); err == nil {
+			t.Errorf("ParseChord(%q): expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// ScaleMode defines how the canvas is scaled to the window size.
+type ScaleMode int
+
+const (
+	ScaleFit     ScaleMode = iota // Show the whole canvas keeping its aspect ratio, letterboxed
+	ScaleFill                     // Cover the whole window keeping the aspect ratio, cropping the canvas
+	ScaleStretch                  // Cover the whole window with the whole canvas, ignoring the aspect ratio
+)
+
+var scaleModeNames = [...]string{ScaleFit: "fit", ScaleFill: "fill", ScaleStretch: "stretch"}
+
+func (m ScaleMode) String() string {
+	if m < 0 || int(m) >= len(scaleModeNames) {
+		return fmt.Sprintf("ScaleMode(%d)", int(m))
+	}
+	return scaleModeNames[m]
+}
+
+func (m ScaleMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText parses "fit", "fill" or "stretch".
+func (m *ScaleMode) UnmarshalText(text []byte) error {
+	for mode, name := range scaleModeNames {
+		if string(text) == name {
+			*m = ScaleMode(mode)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown scale mode %q, expected fit, fill or stretch", text)
+}
+
+// viewport maps the canvas onto the window: the src part of the canvas is drawn into the dst part of the window.
+type viewport struct {
+	src, dst image.Rectangle
+}
+
+func newViewport(mode ScaleMode, canvas image.Point, window image.Rectangle) viewport {
+	v := viewport{src: image.Rectangle{Max: canvas}, dst: window}
+	if canvas.X <= 0 || canvas.Y <= 0 || window.Empty() {
+		return v
+	}
+
+	sx := float64(window.Dx()) / float64(canvas.X)
+	sy := float64(window.Dy()) / float64(canvas.Y)
+	switch mode {
+	case ScaleFit:
+		scale := math.Min(sx, sy)
+		size := image.Pt(int(math.Round(float64(canvas.X)*scale)), int(math.Round(float64(canvas.Y)*scale)))
+		v.dst = centered(size, window)
+	case ScaleFill:
+		scale := math.Max(sx, sy)
+		size := image.Pt(int(math.Round(float64(window.Dx())/scale)), int(math.Round(float64(window.Dy())/scale)))
+		v.src = centered(size, v.src)
+	}
+	return v
+}
+
+// centered returns a rectangle of the given size in the middle of r.
+func centered(size image.Point, r image.Rectangle) image.Rectangle {
+	min := r.Min.Add(r.Size().Sub(size).Div(2))
+	return image.Rectangle{Min: min, Max: min.Add(size)}
+}
+
+// covers reports whether the canvas covers the whole window, so no letterboxing is needed.
+func (v viewport) covers(window image.Rectangle) bool {
+	return window.In(v.dst)
+}
+
+// toCanvas maps a point in the window to the pixel of the canvas under it. Points outside of dst map outside of src.
+func (v viewport) toCanvas(x, y float32) image.Point {
+	cx, cy := v.toCanvasF(x, y)
+	return image.Pt(int(math.Floor(cx)), int(math.Floor(cy)))
+}
+
+// toCanvasF maps a point in the window to the canvas without rounding it to a pixel.
+func (v viewport) toCanvasF(x, y float32) (float64, float64) {
+	if v.dst.Empty() {
+		return 0, 0
+	}
+	return float64(v.src.Min.X) + float64(x-float32(v.dst.Min.X))*float64(v.src.Dx())/float64(v.dst.Dx()),
+		float64(v.src.Min.Y) + float64(y-float32(v.dst.Min.Y))*float64(v.src.Dy())/float64(v.dst.Dy())
+}
+
+// toWindow maps a rectangle on the canvas to the window.
+func (v viewport) toWindow(r image.Rectangle) image.Rectangle {
+	if v.src.Empty() {
+		return image.Rectangle{}
+	}
+	mapX := func(x int) int {
+		return v.dst.Min.X + int(math.Round(float64(x-v.src.Min.X)*float64(v.dst.Dx())/float64(v.src.Dx())))
+	}
+	mapY := func(y int) int {
+		return v.dst.Min.Y + int(math.Round(float64(y-v.src.Min.Y)*float64(v.dst.Dy())/float64(v.src.Dy())))
+	}
+	return image.Rect(mapX(r.Min.X), mapY(r.Min.Y), mapX(r.Max.X), mapY(r.Max.Y))
+}
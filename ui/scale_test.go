@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"image"
+	"testing"
+)
+
+func TestNewViewport(t *testing.T) {
+	canvas := image.Pt(800, 400)
+	window := image.Rect(0, 0, 400, 400)
+
+	tests := []struct {
+		mode     ScaleMode
+		src, dst image.Rectangle
+	}{
+		{ScaleFit, image.Rect(0, 0, 800, 400), image.Rect(0, 100, 400, 300)},
+		{ScaleFill, image.Rect(200, 0, 600, 400), image.Rect(0, 0, 400, 400)},
+		{ScaleStretch, image.Rect(0, 0, 800, 400), image.Rect(0, 0, 400, 400)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			v := newViewport(tt.mode, canvas, window)
+			if v.src != tt.src || v.dst != tt.dst {
+				t.Errorf("got src %v dst %v, want src %v dst %v", v.src, v.dst, tt.src, tt.dst)
+			}
+			if got := v.toWindow(v.src); got != v.dst {
+				t.Errorf("toWindow(src) = %v, want %v", got, v.dst)
+			}
+		})
+	}
+}
+
+func TestViewport_toCanvas(t *testing.T) {
+	fit := newViewport(ScaleFit, image.Pt(800, 400), image.Rect(0, 0, 400, 400))
+	if got := fit.toCanvas(200, 200); got != image.Pt(400, 200) {
+		t.Errorf("window center maps to %v", got)
+	}
+	if got := fit.toCanvas(0, 50); got.Y >= 0 {
+		t.Errorf("letterbox point maps inside the canvas: %v", got)
+	}
+
+	fill := newViewport(ScaleFill, image.Pt(800, 400), image.Rect(0, 0, 400, 400))
+	if got := fill.toCanvas(0, 399.5); got != image.Pt(200, 399) {
+		t.Errorf("bottom left corner maps to %v", got)
+	}
+}
+
+func TestScaleMode_UnmarshalText(t *testing.T) {
+	for _, name := range []string{"fit", "fill", "stretch"} {
+		var m ScaleMode
+		if err := m.UnmarshalText([]byte(name)); err != nil || m.String() != name {
+			t.Errorf("%q parsed as %v, %v", name, m, err)
+		}
+	}
+	var m ScaleMode
+	if err := m.UnmarshalText([]byte("zoom")); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
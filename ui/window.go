@@ -4,6 +4,8 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"sync"
+	"time"
 
 	"golang.org/x/exp/shiny/driver"
 	"golang.org/x/exp/shiny/screen"
@@ -13,48 +15,151 @@ import (
 	"golang.org/x/mobile/event/mouse"
 	"golang.org/x/mobile/event/paint"
 	"golang.org/x/mobile/event/size"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
 type Visualizer struct {
 	Title         string
 	Debug         bool
+	Size          image.Point // Window size, the canvas size; 800×800 if empty
+	Scale         ScaleMode   // How the canvas is scaled when the window size differs from it
 	OnScreenReady func(s screen.Screen)
 
-	w    screen.Window
-	tx   chan screen.Texture
-	done chan struct{}
+	// OnMouse, if set, receives the mouse events over a canvas texture. X and y are normalized canvas coordinates,
+	// as in scripts; they lie outside of [0, 1] when the pointer is outside of the canvas.
+	OnMouse func(x, y float64, button mouse.Button, dir mouse.Direction)
+
+	// Keys binds key chords to actions passed to OnAction; DefaultKeyMap is used if it is nil. Esc always
+	// closes the window.
+	Keys     KeyMap
+	OnAction func(action string)
+
+	// Stats, if set, provides the numbers shown in the debug overlay drawn over the canvas when Debug is on.
+	Stats func() Stats
+
+	s     screen.Screen
+	w     screen.Window
+	ready chan struct{} // Closed once the window is open
+	done  chan struct{} // Closed once the window is closed
+
+	// The latest texture waits in a mailbox until the window takes it, so UpdateTexture never blocks the loop.
+	mailMu  sync.Mutex
+	pending *frame        // Texture not taken by the window yet
+	closed  bool          // The window is closed and takes no more textures
+	wake    chan struct{} // Signaled when a texture is put into the mailbox
 
-	sz  size.Event
-	pos image.Rectangle
+	sz       size.Event
+	pos      image.Rectangle
 	mousePos image.Point
+
+	hud          hud
+	pointer      [2]float32 // Last mouse position in the window
+	pointerKnown bool
+}
+
+// frame is a texture owned by the window until release is called.
+type frame struct {
+	t       screen.Texture
+	release func()
+}
+
+// NewVisualizer creates a visualizer ready to receive textures and be closed, even before Main opens the window.
+func NewVisualizer() *Visualizer {
+	return &Visualizer{
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+		wake:  make(chan struct{}, 1),
+	}
 }
 
+// Main opens the window and handles its events until it is closed. The visualizer must be created with
+// NewVisualizer.
 func (pw *Visualizer) Main() {
-	pw.tx = make(chan screen.Texture)
-	pw.done = make(chan struct{})
+	if pw.Keys == nil {
+		pw.Keys = DefaultKeyMap()
+	}
+	if pw.Size.X <= 0 || pw.Size.Y <= 0 {
+		pw.Size = painter.DefaultCanvasSize
+	}
 
 	pw.pos.Max.X = 200
 	pw.pos.Max.Y = 200
-	pw.pos = image.Rect(300, 300, 500, 500) // Center the shape
-	pw.mousePos = image.Point{400, 400}
+	pw.mousePos = pw.Size.Div(2)
+	pw.pos = image.Rect(pw.mousePos.X-100, pw.mousePos.Y-100, pw.mousePos.X+100, pw.mousePos.Y+100) // Center the shape
 	driver.Main(pw.run)
 }
 
-func (pw *Visualizer) UpdateTexture(t screen.Texture) {
+// UpdateTexture puts the texture into the mailbox of the window. A texture the window has not taken yet is
+// released and replaced, since only the latest one is worth painting. The window keeps the texture it paints
+// until it takes a newer one.
+func (pw *Visualizer) UpdateTexture(t screen.Texture, release func()) {
+	pw.mailMu.Lock()
+	if pw.closed {
+		pw.mailMu.Unlock()
+		// Nobody will paint the texture.
+		release()
+		return
+	}
+	replaced := pw.pending
+	pw.pending = &frame{t: t, release: release}
+	pw.mailMu.Unlock()
 
-	pw.tx <- t
+	if replaced != nil {
+		replaced.release()
+	}
+	select {
+	case pw.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeTexture returns the texture waiting in the mailbox, if any.
+func (pw *Visualizer) takeTexture() *frame {
+	pw.mailMu.Lock()
+	defer pw.mailMu.Unlock()
+
+	f := pw.pending
+	pw.pending = nil
+	return f
+}
+
+// closeMailbox releases the textures held by the window and makes it reject new ones.
+func (pw *Visualizer) closeMailbox(current *frame) {
+	pw.mailMu.Lock()
+	pw.closed = true
+	pending := pw.pending
+	pw.pending = nil
+	pw.mailMu.Unlock()
+
+	for _, f := range []*frame{current, pending} {
+		if f != nil {
+			f.release()
+		}
+	}
+}
+
+// Close asks the window to close. Main returns once it is closed. If the window is not open yet, it is closed
+// as soon as it opens.
+func (pw *Visualizer) Close() {
+	select {
+	case <-pw.ready:
+		pw.w.Send(lifecycle.Event{To: lifecycle.StageDead})
+	case <-pw.done:
+	}
 }
 
 func (pw *Visualizer) run(s screen.Screen) {
 	w, err := s.NewWindow(&screen.NewWindowOptions{
-		Title: pw.Title,
-		Height: 800,
-		Width: 800,
+		Title:  pw.Title,
+		Height: pw.Size.Y,
+		Width:  pw.Size.X,
 	})
 	if err != nil {
 		log.Fatal("Failed to initialize the app window:", err)
 	}
 	defer func() {
+		pw.hud.release()
 		w.Release()
 		close(pw.done)
 	}()
@@ -63,7 +168,9 @@ func (pw *Visualizer) run(s screen.Screen) {
 		pw.OnScreenReady(s)
 	}
 
+	pw.s = s
 	pw.w = w
+	close(pw.ready)
 
 	events := make(chan any)
 	go func() {
@@ -80,18 +187,41 @@ func (pw *Visualizer) run(s screen.Screen) {
 		}
 	}()
 
-	var t screen.Texture
+	var current *frame
+	defer func() { pw.closeMailbox(current) }()
+
+	// The debug overlay is refreshed even if no frames arrive.
+	var refresh <-chan time.Time
+	if pw.Debug {
+		ticker := time.NewTicker(hudRefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
 
 	for {
 		select {
+		case <-refresh:
+			w.Send(paint.Event{})
+
 		case e, ok := <-events:
 			if !ok {
 				return
 			}
+			var t screen.Texture
+			if current != nil {
+				t = current.t
+			}
 			pw.handleEvent(e, t)
 
-		case t = <-pw.tx:
-			w.Send(paint.Event{})
+		case <-pw.wake:
+			if f := pw.takeTexture(); f != nil {
+				// The window paints on this goroutine, so the replaced texture is not being copied now.
+				if current != nil {
+					current.release()
+				}
+				current = f
+				w.Send(paint.Event{})
+			}
 		}
 	}
 }
@@ -116,53 +246,136 @@ func (pw *Visualizer) handleEvent(e any, t screen.Texture) {
 
 	case size.Event:
 		pw.sz = e
-	case paint.Event:
-		if t != nil {
-			// Use the texture received from the update.
-			pw.w.Copy(pw.sz.Bounds().Min, t, t.Bounds(), draw.Src, nil)
-		} else {
-			// If there is no texture, draw the default UI.
-			pw.drawDefaultUI()
+	case key.Event:
+		// Repeats of a held key come without a direction.
+		if e.Direction == key.DirRelease || pw.OnAction == nil {
+			break
+		}
+		if action, ok := pw.Keys[chordOf(e)]; ok {
+			pw.OnAction(action)
 		}
+	case paint.Event:
+		pw.paint(t)
 		pw.w.Publish() // Publish the window contents to the screen.
 
 	case mouse.Event:
-		if e.Button == mouse.ButtonRight {
-			pw.mousePos = image.Point{
-				X: int(e.X),
-				Y: int(e.Y),}
+		pw.pointer, pw.pointerKnown = [2]float32{e.X, e.Y}, true
+		if pw.Debug {
+			pw.w.Send(paint.Event{})
+		}
+		if t != nil {
+			if pw.OnMouse != nil {
+				x, y := pw.viewport(t).toCanvasF(e.X, e.Y)
+				size := t.Size()
+				pw.OnMouse(x/float64(size.X), y/float64(size.Y), e.Button, e.Direction)
+			}
+		} else if e.Button == mouse.ButtonRight {
+			// Mouse positions are kept in canvas coordinates, so they stay correct when the window is scaled.
+			pw.mousePos = pw.viewport(t).toCanvas(e.X, e.Y)
 			pw.w.Send(paint.Event{})
 		}
 
+	}
+}
 
+// viewport maps the canvas shown by t, or the default UI if t is nil, onto the window.
+func (pw *Visualizer) viewport(t screen.Texture) viewport {
+	canvas := pw.Size
+	if t != nil {
+		canvas = t.Size()
 	}
+	return newViewport(pw.Scale, canvas, pw.sz.Bounds())
 }
-func (pw *Visualizer) drawDefaultUI() {
 
+func (pw *Visualizer) paint(t screen.Texture) {
+	window := pw.sz.Bounds()
+	v := pw.viewport(t)
+	if !v.covers(window) {
+		// Letterbox the canvas.
+		pw.w.Fill(window, color.Black, draw.Src)
+	}
 
-	x, y := pw.mousePos.X, pw.mousePos.Y
+	if m, ok := t.(interface{ Unwrap() screen.Texture }); ok {
+		// Mirrored textures wrap a texture of this screen.
+		pw.w.Scale(v.dst, m.Unwrap(), v.src, draw.Src, nil)
+	} else if img, ok := t.(interface{ RGBA() *image.RGBA }); ok {
+		// Off-screen canvases keep their pixels in memory, so they are uploaded through a buffer.
+		pw.uploadImage(img.RGBA(), v)
+	} else if t != nil {
+		// Use the texture received from the update.
+		pw.w.Scale(v.dst, t, v.src, draw.Src, nil)
+	} else {
+		// If there is no texture, draw the default UI.
+		pw.drawDefaultUI(v)
+	}
 
+	if pw.Debug {
+		pw.drawHUD(t, v)
+	}
+}
 
-	pw.w.Fill(pw.sz.Bounds(), color.RGBA{G: 255, A: 255}, draw.Src)
+func (pw *Visualizer) drawHUD(t screen.Texture, v viewport) {
+	var stats Stats
+	if pw.Stats != nil {
+		stats = pw.Stats()
+	}
+	canvas := pw.Size
+	if t != nil {
+		canvas = t.Size()
+	}
+
+	var pointer *[2]float64
+	if pw.pointerKnown {
+		x, y := v.toCanvasF(pw.pointer[0], pw.pointer[1])
+		pointer = &[2]float64{x, y}
+	}
+	pw.hud.draw(pw.s, pw.w, pw.sz.Bounds(), hudText(stats, canvas, pointer))
+}
+
+func (pw *Visualizer) uploadImage(img *image.RGBA, v viewport) {
+	b, err := pw.s.NewBuffer(img.Rect.Size())
+	if err != nil {
+		log.Printf("Failed to allocate an upload buffer: %s", err)
+		return
+	}
+	defer b.Release()
+
+	draw.Draw(b.RGBA(), b.Bounds(), img, img.Rect.Min, draw.Src)
+
+	// Windows cannot scale buffers, so the pixels go through a texture.
+	t, err := pw.s.NewTexture(b.Size())
+	if err != nil {
+		log.Printf("Failed to allocate an upload texture: %s", err)
+		return
+	}
+	defer t.Release()
+
+	t.Upload(image.Point{}, b, b.Bounds())
+	pw.w.Scale(v.dst, t, v.src, draw.Src, nil)
+}
+
+func (pw *Visualizer) drawDefaultUI(v viewport) {
+
+	x, y := pw.mousePos.X, pw.mousePos.Y
+
+	pw.w.Fill(v.dst, color.RGBA{G: 255, A: 255}, draw.Src)
 
 	pw.pos = image.Rect(
 		x-100, y-100,
 		x+100, y+100,
 	)
-	pw.drawShape(pw.w, pw.pos)
+	pw.drawShape(pw.w, pw.pos, v)
 }
 
+// drawShape draws the cross at pos given in canvas coordinates.
+func (pw *Visualizer) drawShape(w screen.Window, pos image.Rectangle, v viewport) {
 
-func (pw *Visualizer) drawShape(w screen.Window, pos image.Rectangle) {
-
-
-
-	w.Fill(image.Rect(
+	w.Fill(v.toWindow(image.Rect(
 		pos.Min.X, pos.Min.Y+80,
 		pos.Max.X, pos.Min.Y+120,
-	),  color.RGBA{B: 255, A: 255}, draw.Src)
-	w.Fill(image.Rect(
+	)).Intersect(v.dst), color.RGBA{B: 255, A: 255}, draw.Src)
+	w.Fill(v.toWindow(image.Rect(
 		pos.Min.X+80, pos.Min.Y,
 		pos.Min.X+120, pos.Max.Y,
-	), color.RGBA{B: 255, A: 255}, draw.Src)
+	)).Intersect(v.dst), color.RGBA{B: 255, A: 255}, draw.Src)
 }